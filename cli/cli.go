@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"scaleflixapi/config"
+	"scaleflixapi/data"
+	"scaleflixapi/logger"
+	"scaleflixapi/server"
+)
+
+//Usage usage of scaleflixapi binary
+const Usage = `usage: scaleflixapi <command> [arguments]
+
+commands:
+  serve                                               starts API server, default command
+  migrate up|down [steps]|status                      applies, rolls back or lists schema migrations
+  user create -name NAME -email EMAIL [-role ROLE]    adds user, password is read from -password or first line of stdin
+  user list [-page N] [-pageSize N]                   lists users
+  user set-role ID user|admin                         changes role of user
+  media import [-dry-run] IMDBID                      imports movie or series with seasons and episodes from OMDb unless it exists
+  media export [-type all|movie|series] [-output F]   writes movies and series as JSON, - writes to stdout
+  config print                                        prints config, secrets are masked
+`
+
+//OpenStore opens storage backend of user and media commands
+var OpenStore = func() data.Store {
+	return server.SetupStore(config.Storage, config.DBName)
+}
+
+//Stdin reader of passwords
+var Stdin io.Reader = os.Stdin
+
+//usageError definition of invalid command line, usage is printed with it
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+//Run runs command given arguments without binary name, no arguments start API server, returns exit code
+func Run(args []string, out, errOut io.Writer) int {
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+	var err error
+	switch args[0] {
+	case "serve":
+		err = serve(args[1:])
+	case "migrate":
+		err = migrate(args[1:], out)
+	case "user":
+		err = withManager(func(manager data.Manager) error { return userCommand(manager, args[1:], out) })
+	case "media":
+		err = withManager(func(manager data.Manager) error { return mediaCommand(manager, args[1:], out) })
+	case "config":
+		err = printConfig(args[1:], out)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(out, Usage)
+	default:
+		err = usageError{fmt.Sprintf("unknown command %s", args[0])}
+	}
+	var usage usageError
+	switch {
+	case errors.As(err, &usage):
+		fmt.Fprintf(errOut, "%v\n\n%s", err, Usage)
+		return 2
+	case err != nil:
+		fmt.Fprintln(errOut, err)
+		return 1
+	}
+	return 0
+}
+
+//serve starts API server until it is stopped
+func serve(args []string) error {
+	if len(args) > 0 {
+		return usageError{"serve has no arguments"}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Fatal.Printf("Failed: (%v)", r)
+			server.CloseDB()
+		}
+	}()
+	server.NewServer()
+	return nil
+}
+
+//withManager calls fn with manager of opened store and closes the store
+func withManager(fn func(manager data.Manager) error) error {
+	store := OpenStore()
+	defer store.Close()
+	return fn(data.New(store))
+}
+
+//printConfig prints config values as environment variables, secrets are masked
+func printConfig(args []string, out io.Writer) error {
+	if len(args) != 1 || args[0] != "print" {
+		return usageError{"usage: scaleflixapi config print"}
+	}
+	for _, setting := range config.Settings() {
+		value := setting.Value
+		if setting.Secret && value != "" {
+			value = "*****"
+		}
+		fmt.Fprintf(out, "%s=%s\n", setting.Env, value)
+	}
+	return nil
+}
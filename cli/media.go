@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"scaleflixapi/config"
+	"scaleflixapi/data"
+	"scaleflixapi/metadata"
+	"scaleflixapi/service"
+)
+
+//mediaUsage usage of media command
+const mediaUsage = "usage: scaleflixapi media import|export"
+
+//mediaCommand runs media import or export command
+func mediaCommand(manager data.Manager, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return usageError{mediaUsage}
+	}
+	switch args[0] {
+	case "import":
+		return importMedia(manager, args[1:], out)
+	case "export":
+		return exportMedia(manager, args[1:], out)
+	}
+	return usageError{mediaUsage}
+}
+
+//importMedia fetches movie or series given IMDb id from OMDb and adds it unless it exists, -dry-run only prints what would be added
+func importMedia(manager data.Manager, args []string, out io.Writer) error {
+	flags := newFlagSet("media import")
+	dryRun := flags.Bool("dry-run", false, "print media that would be added without adding it")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || flags.Arg(0) == "" {
+		return usageError{"usage: scaleflixapi media import [-dry-run] IMDBID"}
+	}
+	imdbID := flags.Arg(0)
+	suggestion, err := service.FetchMedia(context.Background(), manager, metadata.New(), "", imdbID)
+	if err != nil {
+		return err
+	}
+	for _, failure := range suggestion.Failures {
+		fmt.Fprintf(out, "season %d episode %s failed: %s\n", failure.Season, failure.Episode, failure.Error)
+	}
+	if len(suggestion.Failures) > 0 && !*dryRun {
+		return fmt.Errorf("%d lookups failed, %s is not imported", len(suggestion.Failures), imdbID)
+	}
+	result, err := manager.ImportMedia(suggestion.Media, *dryRun)
+	if err != nil {
+		return err
+	}
+	switch result.Status {
+	case data.ImportCreated:
+		fmt.Fprintf(out, "imported %s %s with %d seasons and %d episodes as %d\n", result.Media.Type, result.Media.Title, result.Seasons, result.Episodes, result.Media.ID)
+	case data.ImportExists:
+		fmt.Fprintf(out, "%s %s exists as %d\n", result.Media.Type, result.Media.Title, result.Media.ID)
+	default:
+		fmt.Fprintf(out, "would import %s %s with %d seasons and %d episodes\n", result.Media.Type, result.Media.Title, result.Seasons, result.Episodes)
+	}
+	return nil
+}
+
+//exportMedia writes movies and series with seasons and episodes as JSON array to output file
+func exportMedia(manager data.Manager, args []string, out io.Writer) error {
+	flags := newFlagSet("media export")
+	mediaType := flags.String("type", "all", "exported media, all, movie or series")
+	output := flags.String("output", filepath.Join(config.ExportFilePath, "media.json"), "output file, - writes to stdout")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	exports := map[string]struct {
+		list func(data.MediaFilter, data.Sort, data.Page) (data.MediaList, error)
+		get  func(string) (data.Media, error)
+	}{
+		"movie":  {manager.GetMovies, manager.GetMovieByID},
+		"series": {manager.GetSeries, manager.GetSeriesByID},
+	}
+	names := []string{"movie", "series"}
+	if *mediaType != "all" {
+		if _, ok := exports[*mediaType]; !ok {
+			return usageError{fmt.Sprintf("type must be all, movie or series, %s", *mediaType)}
+		}
+		names = []string{*mediaType}
+	}
+	result := []data.Media{}
+	for _, name := range names {
+		export := exports[name]
+		for number := 1; ; number++ {
+			page, err := data.NewPage(number, data.MaxPageSize())
+			if err != nil {
+				return err
+			}
+			list, err := export.list(data.MediaFilter{}, data.Sort{}, page)
+			if err != nil {
+				return err
+			}
+			for _, item := range list.Items {
+				media, err := export.get(strconv.Itoa(int(item.ID)))
+				if err != nil {
+					return err
+				}
+				result = append(result, media)
+			}
+			if len(list.Items) == 0 || page.Offset+len(list.Items) >= list.Total {
+				break
+			}
+		}
+	}
+	body, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *output == "-" {
+		_, err = fmt.Fprintln(out, string(body))
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(*output), 0755); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(*output, body, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "exported %d media to %s\n", len(result), *output)
+	return nil
+}
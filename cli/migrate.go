@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"scaleflixapi/config"
+	"scaleflixapi/data"
+	"scaleflixapi/server"
+)
+
+//migrateUsage usage of migrate command
+const migrateUsage = "usage: scaleflixapi migrate up|down [steps]|status"
+
+//migrate runs migrate command with args up, down [steps] or status against postgres database
+func migrate(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return usageError{migrateUsage}
+	}
+	steps := 1
+	switch {
+	case args[0] == "down" && len(args) == 2:
+		var err error
+		if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+			return usageError{fmt.Sprintf("steps must be a positive number, %s", args[1])}
+		}
+	case len(args) != 1 || (args[0] != "up" && args[0] != "down" && args[0] != "status"):
+		return usageError{migrateUsage}
+	}
+	if config.Storage != data.PostgresStore {
+		return fmt.Errorf("migrations need %s storage, storage is %s", data.PostgresStore, config.Storage)
+	}
+	db := server.SetupDB(config.DBName)
+	defer db.Close()
+	migrator := data.NewMigrator(db)
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+	case "down":
+		rolledBack, err := migrator.Down(steps)
+		for _, migration := range rolledBack {
+			fmt.Fprintf(out, "rolled back %d %s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(rolledBack) == 0 {
+			fmt.Fprintln(out, "no applied migrations")
+		}
+		return err
+	}
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(out, "%-8d %-28s %s\n", status.Version, status.Name, applied)
+	}
+	return nil
+}
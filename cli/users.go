@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"scaleflixapi/data"
+)
+
+//userUsage usage of user command
+const userUsage = "usage: scaleflixapi user create|list|set-role"
+
+//userCommand runs user create, list or set-role command
+func userCommand(manager data.Manager, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return usageError{userUsage}
+	}
+	switch args[0] {
+	case "create":
+		return createUser(manager, args[1:], out)
+	case "list":
+		return listUsers(manager, args[1:], out)
+	case "set-role":
+		return setRole(manager, args[1:], out)
+	}
+	return usageError{userUsage}
+}
+
+//createUser registers user with name, email and password, role is set after registration
+func createUser(manager data.Manager, args []string, out io.Writer) error {
+	flags := newFlagSet("user create")
+	name := flags.String("name", "", "name of user")
+	email := flags.String("email", "", "email of user")
+	password := flags.String("password", "", "password of user, first line of stdin when empty")
+	role := flags.String("role", data.RoleUser, "role of user, user or admin")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *role != data.RoleUser && *role != data.RoleAdmin {
+		return usageError{fmt.Sprintf("role must be %s or %s, %s", data.RoleUser, data.RoleAdmin, *role)}
+	}
+	if *password == "" {
+		line, err := bufio.NewReader(Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+	body, _ := json.Marshal(data.Registration{Name: *name, Email: *email, Password: *password})
+	created, err := manager.RegisterUser(body)
+	if err != nil {
+		return err
+	}
+	if *role != data.RoleUser {
+		body, _ = json.Marshal(data.UserUpdate{Role: role})
+		if created, err = manager.UpdateUser(strconv.Itoa(int(created.ID)), body); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "created user %d %s %s\n", created.ID, created.Email, created.Role)
+	return nil
+}
+
+//listUsers prints page of users as table
+func listUsers(manager data.Manager, args []string, out io.Writer) error {
+	flags := newFlagSet("user list")
+	number := flags.Int("page", 1, "page number")
+	size := flags.Int("pageSize", data.MaxPageSize(), "page size")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	page, err := data.NewPage(*number, *size)
+	if err != nil {
+		return err
+	}
+	users, err := manager.GetUsers(page)
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tEMAIL\tNAME\tROLE\tACTIVE")
+	for _, user := range users.Items {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%t\n", user.ID, user.Email, user.Name, user.Role, user.DeactivatedAt == nil)
+	}
+	table.Flush()
+	fmt.Fprintf(out, "page %d of %d users\n", users.Page, users.Total)
+	return nil
+}
+
+//setRole changes role of user given id
+func setRole(manager data.Manager, args []string, out io.Writer) error {
+	if len(args) != 2 {
+		return usageError{"usage: scaleflixapi user set-role ID user|admin"}
+	}
+	body, _ := json.Marshal(data.UserUpdate{Role: &args[1]})
+	updated, err := manager.UpdateUser(args[0], body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "user %d %s is %s\n", updated.ID, updated.Email, updated.Role)
+	return nil
+}
+
+//newFlagSet creates flag set of command, errors are returned instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	return flags
+}
+
+//parseFlags parses flags of command, invalid flags and positional arguments are usage errors
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return usageError{fmt.Sprintf("%s: %v", flags.Name(), err)}
+	}
+	if flags.NArg() > 0 {
+		return usageError{fmt.Sprintf("%s: unexpected argument %s", flags.Name(), flags.Arg(0))}
+	}
+	return nil
+}
@@ -9,6 +9,10 @@ var (
 	ExportFilePath = utils.GetEnv("EXPORT_FILE_PATH", "./output")
 	//APIPort definition
 	APIPort = utils.GetEnv("API_PORT", ":8080")
+	//Storage definition, postgres or memory
+	Storage = utils.GetEnv("STORAGE", "postgres")
+	//StorageTest definition, postgres or memory
+	StorageTest = utils.GetEnv("STORAGE_TEST", "memory")
 	//DBHost definition
 	DBHost = utils.GetEnv("DB_HOST", "localhost")
 	//DBPort definition
@@ -23,8 +27,70 @@ var (
 	PageSize = utils.GetEnv("PAGE_SIZE", "10")
 	//SecretKey definition
 	SecretKey = utils.GetEnv("SECRET_KEY", "secretkeyjwt")
+	//JWTKeys definition, comma separated kid=path list of RSA or EC PEM keys, empty uses SecretKey
+	JWTKeys = utils.GetEnv("JWT_KEYS", "")
+	//JWTSigningKeyID definition, kid of key signing new tokens, default is first of JWTKeys
+	JWTSigningKeyID = utils.GetEnv("JWT_SIGNING_KEY_ID", "")
+	//AccessTokenTTL definition, duration like 30m
+	AccessTokenTTL = utils.GetEnv("ACCESS_TOKEN_TTL", "30m")
+	//RefreshTokenTTL definition, duration like 720h
+	RefreshTokenTTL = utils.GetEnv("REFRESH_TOKEN_TTL", "720h")
+	//AutoMigrate definition, true applies pending migrations when server starts with postgres storage
+	AutoMigrate = utils.GetEnv("AUTO_MIGRATE", "true")
 	//DBNameTest definition
 	DBNameTest = utils.GetEnv("DB_DBNAME_TEST", "postgrestest")
 	//APIKey definition
 	APIKey = utils.GetEnv("API_KEY", "*****")
+	//OMDbURL definition, base url of OMDb API
+	OMDbURL = utils.GetEnv("OMDB_URL", "http://www.omdbapi.com/")
+	//OMDbTimeout definition, duration like 10s limiting each OMDb request
+	OMDbTimeout = utils.GetEnv("OMDB_TIMEOUT", "10s")
+	//OMDbConnectTimeout definition, duration like 5s limiting connecting to OMDb
+	OMDbConnectTimeout = utils.GetEnv("OMDB_CONNECT_TIMEOUT", "5s")
+	//OMDbWorkers definition, count of concurrent OMDb lookups of seasons and episodes of a series
+	OMDbWorkers = utils.GetEnv("OMDB_WORKERS", "4")
+	//OMDbCacheSize definition, count of OMDb lookups cached in memory, 0 disables the cache
+	OMDbCacheSize = utils.GetEnv("OMDB_CACHE_SIZE", "1000")
+	//OMDbCacheTTL definition, duration like 24h OMDb lookups are cached
+	OMDbCacheTTL = utils.GetEnv("OMDB_CACHE_TTL", "24h")
+	//OMDbCacheDir definition, directory persisting cached OMDb lookups, empty caches in memory only
+	OMDbCacheDir = utils.GetEnv("OMDB_CACHE_DIR", "")
 )
+
+//Setting definition of config value with its environment variable, secret values are masked when printed
+type Setting struct {
+	Env    string
+	Value  string
+	Secret bool
+}
+
+//Settings returns config values in declaration order
+func Settings() []Setting {
+	return []Setting{
+		{Env: "EXPORT_FILE_PATH", Value: ExportFilePath},
+		{Env: "API_PORT", Value: APIPort},
+		{Env: "STORAGE", Value: Storage},
+		{Env: "STORAGE_TEST", Value: StorageTest},
+		{Env: "DB_HOST", Value: DBHost},
+		{Env: "DB_PORT", Value: DBPort},
+		{Env: "DB_USER", Value: DBUser},
+		{Env: "DB_PASSWORD", Value: DBPassword, Secret: true},
+		{Env: "DB_DBNAME", Value: DBName},
+		{Env: "PAGE_SIZE", Value: PageSize},
+		{Env: "SECRET_KEY", Value: SecretKey, Secret: true},
+		{Env: "JWT_KEYS", Value: JWTKeys},
+		{Env: "JWT_SIGNING_KEY_ID", Value: JWTSigningKeyID},
+		{Env: "ACCESS_TOKEN_TTL", Value: AccessTokenTTL},
+		{Env: "REFRESH_TOKEN_TTL", Value: RefreshTokenTTL},
+		{Env: "AUTO_MIGRATE", Value: AutoMigrate},
+		{Env: "DB_DBNAME_TEST", Value: DBNameTest},
+		{Env: "API_KEY", Value: APIKey, Secret: true},
+		{Env: "OMDB_URL", Value: OMDbURL},
+		{Env: "OMDB_TIMEOUT", Value: OMDbTimeout},
+		{Env: "OMDB_CONNECT_TIMEOUT", Value: OMDbConnectTimeout},
+		{Env: "OMDB_WORKERS", Value: OMDbWorkers},
+		{Env: "OMDB_CACHE_SIZE", Value: OMDbCacheSize},
+		{Env: "OMDB_CACHE_TTL", Value: OMDbCacheTTL},
+		{Env: "OMDB_CACHE_DIR", Value: OMDbCacheDir},
+	}
+}
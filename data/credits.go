@@ -0,0 +1,177 @@
+package data
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+)
+
+//CreditRole definition of role of person in media
+type CreditRole string
+
+const (
+	//CreditDirector director of media
+	CreditDirector CreditRole = "director"
+	//CreditWriter writer of media
+	CreditWriter CreditRole = "writer"
+	//CreditStar star of media
+	CreditStar CreditRole = "star"
+)
+
+//Person definition
+type Person struct {
+	gorm.Model
+	Name string `gorm:"not null;unique_index" json:"name"`
+}
+
+//Genre definition, slug is unique lowercase name used in urls
+type Genre struct {
+	gorm.Model
+	Name string `gorm:"not null" json:"name"`
+	Slug string `gorm:"not null;unique_index" json:"slug"`
+}
+
+//Credit definition of person in media with role, position keeps order of names in media fields
+type Credit struct {
+	gorm.Model
+	MediaID  *uint      `gorm:"not null;index" json:"mediaId"`
+	PersonID *uint      `gorm:"not null;index" json:"personId"`
+	Role     CreditRole `gorm:"not null" json:"role"`
+	Position int        `json:"position"`
+	Person   *Person    `json:"person,omitempty"`
+	Media    *Media     `json:"media,omitempty"`
+}
+
+//MediaGenre definition of genre of media, position keeps order of names in genre field
+type MediaGenre struct {
+	MediaID  uint `gorm:"primary_key;auto_increment:false"`
+	GenreID  uint `gorm:"primary_key;auto_increment:false"`
+	Position int
+}
+
+//creditName definition of person name parsed from media fields
+type creditName struct {
+	Role     CreditRole
+	Name     string
+	Position int
+}
+
+//mediaCredits parses director, writer and stars fields of media to person names
+func mediaCredits(media *Media) []creditName {
+	result := []creditName{}
+	for _, field := range []struct {
+		role  CreditRole
+		value string
+	}{{CreditDirector, media.Director}, {CreditWriter, media.Writer}, {CreditStar, media.Stars}} {
+		for i, name := range splitNames(field.value) {
+			result = append(result, creditName{Role: field.role, Name: name, Position: i})
+		}
+	}
+	return result
+}
+
+//mediaGenres parses genre field of media to genres, genres with same slug are kept once
+func mediaGenres(media *Media) []Genre {
+	result := []Genre{}
+	seen := map[string]bool{}
+	for _, name := range splitNames(media.Genre) {
+		slug := Slugify(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		result = append(result, Genre{Name: name, Slug: slug})
+	}
+	return result
+}
+
+//splitNames splits comma separated names, blank, N/A and repeated names are skipped
+func splitNames(value string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "N/A" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return result
+}
+
+//Slugify converts name to lowercase slug with letters, numbers and dashes, e.g. Sci-Fi to sci-fi
+func Slugify(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			if dash && slug.Len() > 0 {
+				slug.WriteRune('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return slug.String()
+}
+
+//applyCredits sets director, writer, stars and genre fields from loaded credits and genres, fields without links are kept
+func applyCredits(media *Media) {
+	names := map[CreditRole][]string{}
+	for _, credit := range media.Credits {
+		if credit.Person != nil {
+			names[credit.Role] = append(names[credit.Role], credit.Person.Name)
+		}
+	}
+	if len(names[CreditDirector]) > 0 {
+		media.Director = strings.Join(names[CreditDirector], ", ")
+	}
+	if len(names[CreditWriter]) > 0 {
+		media.Writer = strings.Join(names[CreditWriter], ", ")
+	}
+	if len(names[CreditStar]) > 0 {
+		media.Stars = strings.Join(names[CreditStar], ", ")
+	}
+	if len(media.Genres) > 0 {
+		genres := make([]string, len(media.Genres))
+		for i, genre := range media.Genres {
+			genres[i] = genre.Name
+		}
+		media.Genre = strings.Join(genres, ", ")
+	}
+}
+
+//eachMedia calls fn for media and content of its episodes
+func eachMedia(media *Media, fn func(*Media) error) error {
+	if err := fn(media); err != nil {
+		return err
+	}
+	for _, season := range media.Seasons {
+		if err := eachEpisodeMedia(season, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//eachEpisodeMedia calls fn for content of episodes of season
+func eachEpisodeMedia(season *Seasons, fn func(*Media) error) error {
+	for _, episode := range season.Episode {
+		if episode.Media != nil {
+			if err := eachMedia(episode.Media, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//clearCredits removes credits and genres given in request body, they are created from media fields
+func clearCredits(media *Media) error {
+	media.Credits, media.Genres = nil, nil
+	return nil
+}
@@ -3,13 +3,13 @@ package data
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"scaleflixapi/config"
 	types "scaleflixapi/errors"
 	"scaleflixapi/logger"
 	"strconv"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/jinzhu/gorm"
 
 	//all time imports
@@ -19,19 +19,42 @@ import (
 //Manager interface for data
 type Manager interface {
 	AddMovie([]byte) error
-	GetMovies(name, genre string) ([]Media, error)
+	GetMovies(filter MediaFilter, order Sort, page Page) (MediaList, error)
 	GetMovieByID(id string) (Media, error)
 	AddSeries([]byte) error
-	DeleteMediaByID(key string) error
-	GetSeries(name, genre string) ([]Media, error)
+	DeleteMediaByID(key string, ifMatch string) error
+	GetSeries(filter MediaFilter, order Sort, page Page) (MediaList, error)
 	GetSeriesByID(id string) (Media, error)
+	Search(text string, mediaTypes []MediaType, page Page) (SearchList, error)
 	ConvertToMedia(fromAPIContent MediaAPIContent, fromAPISeasons []SeasonsAPIContent) *Media
+	ImportMedia(media *Media, dryRun bool) (ImportResult, error)
 	ConvertToAPIContent(body []byte) (MediaAPIContent, error)
 	ConvertToAPISeasonsContent(body []byte) (SeasonsAPIContent, error)
 	GetToken(body []byte) (Token, error)
-	AddFavorite([]byte) error
-	DeleteFavoriteByID(key string) error
-	GetFavorites(userID, name, genre string) ([]UserMedia, error)
+	RefreshTokens(body []byte) (Token, error)
+	Logout(claims TokenClaims) error
+	VerifyToken(tokenString string) (TokenClaims, error)
+	JWKS() JWKSet
+	ChangePassword(email string, body []byte) error
+	CreatePasswordReset(body []byte) (PasswordResetToken, error)
+	ResetPassword(body []byte) error
+	RegisterUser(body []byte) (User, error)
+	GetUsers(page Page) (UserList, error)
+	GetUserByID(id string) (User, error)
+	UpdateUser(id string, body []byte) (User, error)
+	DeactivateUser(id string) error
+	AddFavorite(userID uint, body []byte) (UserMedia, error)
+	DeleteFavoriteByID(userID uint, key string) error
+	GetFavorites(userID string, filter MediaFilter, order Sort, page Page) (FavoriteList, error)
+	UpdateMedia(mediaType MediaType, id string, body []byte, merge bool, ifMatch string) (Media, error)
+	GetSeason(seriesID, number string) (Seasons, error)
+	SaveSeason(seriesID, number string, body []byte, merge bool, ifMatch string) (Seasons, bool, error)
+	DeleteSeason(seriesID, number, ifMatch string) error
+	GetEpisode(seriesID, seasonNumber, number string) (Episodes, error)
+	SaveEpisode(seriesID, seasonNumber, number string, body []byte, merge bool, ifMatch string) (Episodes, bool, error)
+	DeleteEpisode(seriesID, seasonNumber, number, ifMatch string) error
+	GetPerson(id string, page Page) (CreditList, error)
+	GetGenre(slug string, page Page) (GenreMediaList, error)
 }
 
 //MediaType definition
@@ -48,7 +71,8 @@ const (
 
 //Data definition
 type Data struct {
-	DB *gorm.DB
+	Store Store
+	Keys  *KeySet
 }
 
 //MediaAPIContent definition
@@ -59,7 +83,7 @@ type MediaAPIContent struct {
 	ImdbRating   string `json:"imdbRating"`
 	Director     string `json:"Director"`
 	Writer       string `json:"Writer"`
-	Aktors       string `json:"Aktors"`
+	Actors       string `json:"Actors"`
 	Released     string `json:"Released"`
 	Runtime      string `json:"Runtime"`
 	ImdbID       string `json:"imdbID"`
@@ -87,29 +111,35 @@ type EpisodesAPIContent struct {
 //Media definition
 type Media struct {
 	gorm.Model
-	Type        MediaType  `json:"type"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Rating      string     `json:"rating"`
-	Director    string     `json:"director"`
-	Writer      string     `json:"writer"`
-	Stars       string     `json:"stars"`
-	ReleaseDate time.Time  `json:"releasedate"`
-	Duration    string     `json:"duration"`
-	ImdbID      string     `json:"imdbid"`
-	Year        string     `json:"year"`
-	Genre       string     `json:"genre"`
-	Audio       string     `json:"audio"`
-	Subtitles   string     `json:"subtitles"`
-	Seasons     []*Seasons `gorm:"onDelete:CASCADE" json:"seasons"`
+	Type            MediaType  `json:"type"`
+	Title           string     `json:"title" validate:"required"`
+	Description     string     `json:"description"`
+	Rating          string     `json:"rating" validate:"rating"`
+	RatingValue     *float64   `json:"ratingValue" validate:"min=0,max=10"`
+	Director        string     `json:"director"`
+	Writer          string     `json:"writer"`
+	Stars           string     `json:"stars"`
+	ReleaseDate     *time.Time `json:"releasedate"`
+	Duration        string     `json:"duration"`
+	DurationMinutes *int       `json:"durationMinutes" validate:"min=0"`
+	ImdbID          string     `json:"imdbid"`
+	Year            string     `json:"year" validate:"year"`
+	YearFrom        *int       `json:"yearFrom" validate:"min=1"`
+	YearTo          *int       `json:"yearTo" validate:"min=1"`
+	Genre           string     `json:"genre"`
+	Audio           string     `json:"audio"`
+	Subtitles       string     `json:"subtitles"`
+	Seasons         []*Seasons `gorm:"onDelete:CASCADE" json:"seasons" validate:"unique=season,dive"`
+	Credits         []*Credit  `json:"credits,omitempty"`
+	Genres          []*Genre   `gorm:"-" json:"genres,omitempty"`
 }
 
 //Seasons definition
 type Seasons struct {
 	gorm.Model
-	Season       int         `json:"season"`
+	Season       int         `json:"season" validate:"min=1"`
 	TotalSeasons int         `json:"totalSeasons"`
-	Episode      []*Episodes `gorm:"onDelete:CASCADE" json:"episodes"`
+	Episode      []*Episodes `gorm:"onDelete:CASCADE" json:"episodes" validate:"unique=episode,dive"`
 	MediaID      *uint       `gorm:"not null" json:"mediaId"`
 	Media        *Media
 }
@@ -117,8 +147,8 @@ type Seasons struct {
 //Episodes definition
 type Episodes struct {
 	gorm.Model
-	Episode   string `json:"episode"`
-	Media     *Media `gorm:"onDelete:CASCADE" json:"content"`
+	Episode   string `json:"episode" validate:"required"`
+	Media     *Media `gorm:"onDelete:CASCADE" json:"content" validate:"required,dive"`
 	MediaID   *uint  `gorm:"not null" json:"mediaId"`
 	SeasonsID *uint  `gorm:"not null" json:"seasonsId"`
 	Seasons   *Seasons
@@ -127,16 +157,17 @@ type Episodes struct {
 //User definition
 type User struct {
 	gorm.Model
-	Name     string `json:"name"`
-	Email    string `gorm:"unique" json:"email"`
-	Password string `json:"password"`
-	Role     string `json:"role"`
+	Name          string     `json:"name"`
+	Email         string     `gorm:"unique" json:"email"`
+	Password      string     `json:"-"`
+	Role          string     `json:"role"`
+	DeactivatedAt *time.Time `json:"deactivatedAt"`
 }
 
 //UserMedia definition
 type UserMedia struct {
 	gorm.Model
-	MediaID *uint `gorm:"not null" json:"mediaId"`
+	MediaID *uint `gorm:"not null" json:"mediaId" validate:"required"`
 	UserID  *uint `gorm:"not null" json:"userId"`
 	Media   *Media
 }
@@ -147,17 +178,22 @@ type Authentication struct {
 	Password string `json:"password"`
 }
 
-//Token definition
+//Token definition, token is access token
 type Token struct {
-	Role        string `json:"role"`
-	Email       string `json:"email"`
-	TokenString string `json:"token"`
+	Role         string `json:"role"`
+	Email        string `json:"email"`
+	TokenString  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
 }
 
-//New creates new service
-func New(db *gorm.DB) Manager {
-	db.AutoMigrate(&User{}, &Seasons{}, &Episodes{}, &Media{}, &UserMedia{})
-	return &Data{DB: db}
+//New creates new data manager with given storage backend
+func New(store Store) Manager {
+	keys, err := LoadKeySet(config.JWTKeys, config.JWTSigningKeyID, config.SecretKey)
+	if err != nil {
+		logger.Fatal.Fatalf("error, signing keys are not loaded, %v", err)
+	}
+	return &Data{Store: store, Keys: keys}
 }
 
 //AddMovie adds movie to datastore
@@ -166,38 +202,28 @@ func (d *Data) AddMovie(body []byte) error {
 	err := json.Unmarshal(body, &post)
 	if err != nil {
 		logger.Error.Println(err)
+		return types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
+	}
+	if err = validateMedia(&post, Movie); err != nil {
 		return err
 	}
-
-	err = d.DB.Create(&post).Error
+	eachMedia(&post, normalizeNew)
+	err = d.Store.CreateMedia(&post)
 	if err != nil {
 		logger.Error.Println(err)
-		return err
 	}
-	d.DB.Save(&post)
 	return err
 }
 
 //GetMovies gets all movies from datastore with given filters
-func (d *Data) GetMovies(name, genre string) ([]Media, error) {
-	result := []Media{}
-
-	if name != "" {
-		d.DB.Where("title = ?", name)
-	}
-	if genre != "" {
-		d.DB.Where("genre LIKE ?", "%"+genre+"%")
-	}
-	err := d.DB.Where("type = ?", Movie).Find(&result).Limit(config.PageSize).Error
-
-	return result, err
+func (d *Data) GetMovies(filter MediaFilter, order Sort, page Page) (MediaList, error) {
+	items, total, err := d.Store.FindMedia(Movie, filter, order, page)
+	return MediaList{Items: items, Total: total, Page: page.Number(), PageSize: page.Size}, err
 }
 
 //GetMovieByID gets movie from datastore with given id
 func (d *Data) GetMovieByID(id string) (Media, error) {
-	result := Media{}
-	err := d.DB.Where("type = ?", Movie).Where("id = ?", id).Find(&result).Error
-	return result, err
+	return d.findMedia(Movie, id)
 }
 
 //AddSeries adds series to datastore
@@ -206,78 +232,73 @@ func (d *Data) AddSeries(body []byte) error {
 	err := json.Unmarshal(body, &post)
 	if err != nil {
 		logger.Error.Println(err)
+		return types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
+	}
+	if err = validateMedia(&post, Series); err != nil {
 		return err
 	}
-	err = d.DB.Create(&post).Error
+	eachMedia(&post, normalizeNew)
+	err = d.Store.CreateMedia(&post)
 	if err != nil {
 		logger.Error.Println(err)
-		return err
 	}
-	d.DB.Save(&post)
 	return err
 }
 
-//DeleteMediaByID deletes series from datasource
-func (d *Data) DeleteMediaByID(key string) error {
-	err := d.DB.Transaction(func(tx *gorm.DB) error {
-		result := Media{}
-		id, err := strconv.Atoi(key)
-		if err != nil {
-			logger.Error.Println(err)
-			return err
+//DeleteMediaByID deletes series from datasource, non empty ifMatch must match ETag of movie or series
+func (d *Data) DeleteMediaByID(key string, ifMatch string) error {
+	id, err := parseID(key)
+	if err != nil {
+		return err
+	}
+	var version time.Time
+	if ifMatch != "" {
+		media, err := d.findMedia(Movie, key)
+		if errors.Is(err, ErrNotFound) {
+			media, err = d.findMedia(Series, key)
 		}
-		err = d.DB.Preload("Seasons").Preload("Seasons.Episode").Preload("Seasons.Episode.Media").Where("id = ?", id).Find(&result).Error
 		if err != nil {
-			logger.Error.Println(err)
 			return err
 		}
-		if result.Seasons != nil && len(result.Seasons) > 0 {
-			for i := 0; i < len(result.Seasons); i++ {
-				for j := 0; j < len(result.Seasons[i].Episode); j++ {
-					err = d.DB.Delete(&Media{Model: gorm.Model{ID: *result.Seasons[i].Episode[j].MediaID}}).Error
-					if err != nil {
-						logger.Error.Println(err)
-						return err
-					}
-				}
-				err = d.DB.Where("seasons_id = ?", result.Seasons[i].ID).Delete(&Episodes{}).Error
-				if err != nil {
-					logger.Error.Println(err)
-					return err
-				}
-			}
-			err = d.DB.Where("media_id = ?", *result.Seasons[0].MediaID).Delete(&Seasons{}).Error
-			if err != nil {
-				logger.Error.Println(err)
-				return err
-			}
+		if version, err = checkETag(media, ifMatch, key); err != nil {
+			return err
 		}
-		return d.DB.Delete(&Media{Model: gorm.Model{ID: uint(id)}}).Error
-	})
-	return err
-}
-
-//GetSeries gets all series from datastore with given filters
-func (d *Data) GetSeries(name, genre string) ([]Media, error) {
-	result := []Media{}
-
-	if name != "" {
-		d.DB.Where("title = ?", name)
 	}
-	if genre != "" {
-		d.DB.Where("genre LIKE ?", "%"+genre+"%")
+	err = d.Store.DeleteMedia(id, version)
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrModified) {
+		logger.Error.Println(err)
 	}
+	return modified(notFound(err, key), key)
+}
 
-	err := d.DB.Where("type = ?", Series).Find(&result).Limit(config.PageSize).Error
-	return result, err
+//GetSeries gets all series from datastore with given filters
+func (d *Data) GetSeries(filter MediaFilter, order Sort, page Page) (MediaList, error) {
+	items, total, err := d.Store.FindMedia(Series, filter, order, page)
+	return MediaList{Items: items, Total: total, Page: page.Number(), PageSize: page.Size}, err
 }
 
 //GetSeriesByID gets series from datastore with given id
 func (d *Data) GetSeriesByID(id string) (Media, error) {
-	result := Media{}
+	return d.findMedia(Series, id)
+}
 
-	err := d.DB.Preload("Seasons").Preload("Seasons.Episode").Preload("Seasons.Episode.Media").Where("type = ?", Series).Where("id = ?", id).Find(&result).Error
-	return result, err
+//findMedia finds media of type given id, missing media returns not found error
+func (d *Data) findMedia(mediaType MediaType, id string) (Media, error) {
+	key, err := parseID(id)
+	if err != nil {
+		return Media{}, err
+	}
+	media, err := d.Store.FindMediaByID(mediaType, key)
+	return media, notFound(err, id)
+}
+
+//Search searches movies, series and episodes from datastore ranked by relevance
+func (d *Data) Search(text string, mediaTypes []MediaType, page Page) (SearchList, error) {
+	if len(mediaTypes) == 0 {
+		mediaTypes = []MediaType{Movie, Series, Episode}
+	}
+	items, total, err := d.Store.SearchMedia(text, mediaTypes, page)
+	return SearchList{Items: items, Total: total, Page: page.Number(), PageSize: page.Size}, err
 }
 
 //ConvertToMedia coverts response to madia
@@ -298,10 +319,12 @@ func (d *Data) ConvertToMedia(fromAPIContent MediaAPIContent, fromAPISeasons []S
 	media.Director = fromAPIContent.Director
 	media.Writer = fromAPIContent.Writer
 	media.Duration = fromAPIContent.Runtime
+	media.ReleaseDate = parseReleased(fromAPIContent.Released)
 	media.ImdbID = fromAPIContent.ImdbID
 	media.Rating = fromAPIContent.ImdbRating
 	media.Year = fromAPIContent.Year
-	media.Stars = fromAPIContent.Aktors
+	media.Stars = fromAPIContent.Actors
+	normalizeMedia(media, nil)
 	if len(fromAPISeasons) > 0 {
 		for i := 0; i < len(fromAPISeasons); i++ {
 			seasons := &Seasons{}
@@ -346,46 +369,52 @@ func (d *Data) ConvertToAPISeasonsContent(body []byte) (SeasonsAPIContent, error
 	return result, err
 }
 
-//AddFavorite adds series to datastore
-func (d *Data) AddFavorite(body []byte) error {
+//AddFavorite adds media given mediaId to favorites of user
+func (d *Data) AddFavorite(userID uint, body []byte) (UserMedia, error) {
 	post := UserMedia{}
 	err := json.Unmarshal(body, &post)
 	if err != nil {
 		logger.Error.Println(err)
-		return err
+		return UserMedia{}, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
 	}
-	err = d.DB.Create(&post).Error
-	if err != nil {
+	if err = validateFields(post); err != nil {
+		return UserMedia{}, err
+	}
+	favorite := UserMedia{UserID: &userID, MediaID: post.MediaID}
+	err = d.Store.CreateFavorite(&favorite)
+	if errors.Is(err, ErrNotFound) {
+		return UserMedia{}, types.NewValidation(types.CodeMediaNotFound, fmt.Sprintf(types.MediaNotFound, *post.MediaID))
+	}
+	if err != nil && !errors.Is(err, ErrFavoriteExists) {
 		logger.Error.Println(err)
-		return err
 	}
-	d.DB.Save(&post)
-	return err
+	return favorite, err
 }
 
-//DeleteFavoriteByID adds series to datastore
-func (d *Data) DeleteFavoriteByID(key string) error {
-	id, err := strconv.Atoi(key)
+//DeleteFavoriteByID deletes favorite of user, favorites of other users are not found
+func (d *Data) DeleteFavoriteByID(userID uint, key string) error {
+	id, err := parseID(key)
 	if err != nil {
 		return err
 	}
-	err = d.DB.Delete(&UserMedia{Model: gorm.Model{ID: uint(id)}}).Error
-	return err
+	favorite, err := d.Store.FindFavorite(id)
+	if err != nil {
+		return notFound(err, key)
+	}
+	if favorite.UserID == nil || *favorite.UserID != userID {
+		return notFound(ErrNotFound, key)
+	}
+	return d.Store.DeleteFavorite(favorite.ID)
 }
 
 //GetFavorites gets favorites medias from datastore with given user id
-func (d *Data) GetFavorites(userID, name, genre string) ([]UserMedia, error) {
-	result := []UserMedia{}
-
-	if name != "" {
-		d.DB.Where("title = ?", name)
-	}
-	if genre != "" {
-		d.DB.Where("genre LIKE ?", "%"+genre+"%")
+func (d *Data) GetFavorites(userID string, filter MediaFilter, order Sort, page Page) (FavoriteList, error) {
+	id, err := parseID(userID)
+	if err != nil {
+		return FavoriteList{}, err
 	}
-
-	err := d.DB.Preload("Media").Where("user_id = ?", userID).Find(&result).Limit(config.PageSize).Error
-	return result, err
+	items, total, err := d.Store.FindFavorites(id, filter, order, page)
+	return FavoriteList{Items: items, Total: total, Page: page.Number(), PageSize: page.Size}, err
 }
 
 //GetToken gets token for given valid user information
@@ -394,54 +423,133 @@ func (d *Data) GetToken(body []byte) (Token, error) {
 	err := json.Unmarshal(body, &authDetails)
 	if err != nil {
 		logger.Error.Println(err)
-		return Token{}, err
+		return Token{}, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
 	}
 
-	var authUser User
-	err = d.DB.Where("email =   ?", authDetails.Email).First(&authUser).Error
+	authUser, err := d.Store.FindUserByEmail(authDetails.Email)
 
+	if errors.Is(err, ErrNotFound) {
+		return Token{}, types.NewUnauthorized(types.CodeInvalidCredentials, types.UsernamePasswordError)
+	}
 	if err != nil {
 		logger.Error.Println(err)
 		return Token{}, err
 	}
 
-	check := checkPasswordHash(authDetails.Password, authUser.Password)
+	check, rehash := checkPasswordHash(authDetails.Password, authUser.Password)
 
 	if !check {
-		return Token{}, errors.New(types.UsernamePasswordError)
+		return Token{}, types.NewUnauthorized(types.CodeInvalidCredentials, types.UsernamePasswordError)
+	}
+	if authUser.DeactivatedAt != nil {
+		return Token{}, types.NewForbidden(types.CodeUserDeactivated, types.UserDeactivated)
+	}
+	if rehash {
+		d.migratePassword(authUser.ID, authDetails.Password)
 	}
 
-	validToken, err := generateJWT(authUser.Email, authUser.Role)
+	token, err := d.issueTokens(authUser, newTokenID())
 	if err != nil {
 		logger.Error.Println(err)
-		return Token{}, err
 	}
-
-	var token Token
-	token.Email = authUser.Email
-	token.Role = authUser.Role
-	token.TokenString = validToken
 	return token, err
 }
 
-func generateJWT(email, role string) (string, error) {
-	var mySigningKey = []byte(config.SecretKey)
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["authorized"] = true
-	claims["email"] = email
-	claims["role"] = role
-	claims["exp"] = time.Now().Add(time.Minute * 30).Unix()
+//migratePassword hashes plaintext password of user after successful login
+func (d *Data) migratePassword(id uint, password string) {
+	hash, err := HashPassword(password)
+	if err == nil {
+		err = d.Store.UpdateUserPassword(id, hash)
+	}
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
+
+//ChangePassword changes password of user after checking current password
+func (d *Data) ChangePassword(email string, body []byte) error {
+	var change ChangePassword
+	err := json.Unmarshal(body, &change)
+	if err != nil {
+		logger.Error.Println(err)
+		return types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
+	}
+	user, err := d.Store.FindUserByEmail(email)
+	if errors.Is(err, ErrNotFound) {
+		return types.NewUnauthorized(types.CodeInvalidCredentials, types.UsernamePasswordError)
+	}
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if check, _ := checkPasswordHash(change.CurrentPassword, user.Password); !check {
+		return types.NewUnauthorized(types.CodeInvalidCredentials, types.UsernamePasswordError)
+	}
+	return d.setPassword(user.ID, change.NewPassword)
+}
 
-	tokenString, err := token.SignedString(mySigningKey)
+//CreatePasswordReset creates one-time password reset token for user given email
+func (d *Data) CreatePasswordReset(body []byte) (PasswordResetToken, error) {
+	var request PasswordResetRequest
+	err := json.Unmarshal(body, &request)
+	if err != nil {
+		logger.Error.Println(err)
+		return PasswordResetToken{}, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
+	}
+	user, err := d.Store.FindUserByEmail(request.Email)
+	if errors.Is(err, ErrNotFound) {
+		return PasswordResetToken{}, types.NewNotFound(types.CodeNotFound, fmt.Sprintf(types.KeyNotFound, "email"))
+	}
 	if err != nil {
-		return "", err
+		logger.Error.Println(err)
+		return PasswordResetToken{}, err
+	}
+	token, hash, err := newResetToken()
+	if err != nil {
+		logger.Error.Println(err)
+		return PasswordResetToken{}, err
 	}
+	reset := PasswordReset{UserID: &user.ID, TokenHash: hash, ExpiresAt: time.Now().Add(resetTokenTTL)}
+	err = d.Store.CreatePasswordReset(&reset)
+	if err != nil {
+		logger.Error.Println(err)
+		return PasswordResetToken{}, err
+	}
+	return PasswordResetToken{Email: user.Email, Token: token, ExpiresAt: reset.ExpiresAt}, nil
+}
 
-	return tokenString, nil
+//ResetPassword sets new password with one-time password reset token
+func (d *Data) ResetPassword(body []byte) error {
+	var reset ResetPassword
+	err := json.Unmarshal(body, &reset)
+	if err != nil {
+		logger.Error.Println(err)
+		return types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
+	}
+	if len(reset.NewPassword) < MinPasswordLength {
+		return types.NewValidation(types.CodePasswordTooShort, fmt.Sprintf(types.PasswordTooShort, MinPasswordLength))
+	}
+	used, err := d.Store.UsePasswordReset(hashResetToken(reset.Token))
+	if err != nil {
+		logger.Error.Println(err)
+		return types.NewValidation(types.CodeInvalidResetToken, types.InvalidResetToken)
+	}
+	return d.setPassword(*used.UserID, reset.NewPassword)
 }
 
-//compare plain password with hash password
-func checkPasswordHash(password, hash string) bool {
-	return password == hash
+//setPassword validates and stores hash of new password and ends sessions of user
+func (d *Data) setPassword(id uint, password string) error {
+	if len(password) < MinPasswordLength {
+		return types.NewValidation(types.CodePasswordTooShort, fmt.Sprintf(types.PasswordTooShort, MinPasswordLength))
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if err = d.Store.UpdateUserPassword(id, hash); err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	return d.endSessions(id)
 }
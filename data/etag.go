@@ -0,0 +1,43 @@
+package data
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+//ETag returns strong entity tag of media, derived from UpdatedAt of media, its seasons, episodes and their content
+func (m Media) ETag() string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d:%d", m.ID, m.UpdatedAt.UnixNano())
+	for _, season := range m.Seasons {
+		fmt.Fprintf(hash, "|s%d:%d", season.ID, season.UpdatedAt.UnixNano())
+		for _, episode := range season.Episode {
+			fmt.Fprintf(hash, "|e%d:%d", episode.ID, episode.UpdatedAt.UnixNano())
+			if episode.Media != nil {
+				fmt.Fprintf(hash, "|c%d:%d", episode.Media.ID, episode.Media.UpdatedAt.UnixNano())
+			}
+		}
+	}
+	return fmt.Sprintf(`"%x"`, hash.Sum64())
+}
+
+//MatchETag reports whether If-Match or If-None-Match header matches etag, weak comparison ignores W/ prefixes
+func MatchETag(header, etag string, weak bool) bool {
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimSpace(value)
+		if value == "*" {
+			return true
+		}
+		if strings.HasPrefix(value, "W/") {
+			if !weak {
+				continue
+			}
+			value = strings.TrimPrefix(value, "W/")
+		}
+		if value != "" && value == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
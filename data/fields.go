@@ -0,0 +1,135 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//durationPattern matches runtime in minutes like 148 min or 148
+var durationPattern = regexp.MustCompile(`^(\d+)\s*(min)?$`)
+
+//releasedLayouts layouts of release dates, OMDb returns dates like 16 Jul 2010
+var releasedLayouts = []string{"02 Jan 2006", "2 Jan 2006", "2006-01-02"}
+
+//normalizeMedia sets typed duration, rating and years of media from raw strings or raw strings from changed typed fields, changed raw strings win, previous is nil for new media
+func normalizeMedia(media, previous *Media) {
+	if previous == nil {
+		previous = &Media{}
+	}
+	if parseRaw(media.Duration, previous.Duration, !equalInt(media.DurationMinutes, previous.DurationMinutes)) {
+		media.DurationMinutes = parseDuration(media.Duration)
+	} else {
+		media.Duration = formatDuration(media.DurationMinutes)
+	}
+	if parseRaw(media.Rating, previous.Rating, !equalFloat(media.RatingValue, previous.RatingValue)) {
+		media.RatingValue = parseRating(media.Rating)
+	} else {
+		media.Rating = formatRating(media.RatingValue)
+		media.RatingValue = parseRating(media.Rating)
+	}
+	if parseRaw(media.Year, previous.Year, !equalInt(media.YearFrom, previous.YearFrom) || !equalInt(media.YearTo, previous.YearTo)) {
+		media.YearFrom, media.YearTo = parseYears(media.Year)
+	} else {
+		media.Year = formatYears(media.YearFrom, media.YearTo, media.Type)
+	}
+}
+
+//normalizeNew normalizes fields of new media, it never fails and returns error only to be called by eachMedia
+func normalizeNew(media *Media) error {
+	normalizeMedia(media, nil)
+	return nil
+}
+
+//parseRaw reports whether typed field is parsed from raw string, otherwise raw string is formatted from changed typed field
+func parseRaw(raw, previous string, typedChanged bool) bool {
+	return !typedChanged || (raw != previous && strings.TrimSpace(raw) != "")
+}
+
+//parseDuration parses runtime like 148 min to minutes, unknown runtimes return nil
+func parseDuration(value string) *int {
+	match := durationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return nil
+	}
+	minutes, err := strconv.Atoi(match[1])
+	if err != nil {
+		return nil
+	}
+	return &minutes
+}
+
+//formatDuration formats minutes like 148 min
+func formatDuration(minutes *int) string {
+	if minutes == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d min", *minutes)
+}
+
+//parseRating parses rating like 8.8, N/A and invalid ratings return nil
+func parseRating(value string) *float64 {
+	rating, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || rating < 0 || rating > 10 {
+		return nil
+	}
+	return &rating
+}
+
+//formatRating formats rating with one decimal like IMDb ratings
+func formatRating(rating *float64) string {
+	if rating == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*rating, 'f', 1, 64)
+}
+
+//parseYears parses year like 2010 or year range of series like 2011–2019, open ranges like 2011– have no last year
+func parseYears(value string) (*int, *int) {
+	match := yearPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return nil, nil
+	}
+	from, _ := strconv.Atoi(match[1])
+	switch {
+	case match[2] == "":
+		return &from, &from
+	case match[3] == "":
+		return &from, nil
+	}
+	to, _ := strconv.Atoi(match[3])
+	return &from, &to
+}
+
+//formatYears formats years like 2010 or 2011–2019, series without last year are formatted as open range
+func formatYears(from, to *int, mediaType MediaType) string {
+	switch {
+	case from == nil:
+		return ""
+	case to == nil && mediaType == Series:
+		return fmt.Sprintf("%d–", *from)
+	case to == nil || *to == *from:
+		return strconv.Itoa(*from)
+	}
+	return fmt.Sprintf("%d–%d", *from, *to)
+}
+
+//parseReleased parses release date like 16 Jul 2010, N/A and invalid dates return nil
+func parseReleased(value string) *time.Time {
+	for _, layout := range releasedLayouts {
+		if released, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return &released
+		}
+	}
+	return nil
+}
+
+func equalInt(a, b *int) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func equalFloat(a, b *float64) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
@@ -0,0 +1,108 @@
+package data
+
+import (
+	"strings"
+)
+
+//MediaFilter definition for media listing queries, empty fields are not applied
+type MediaFilter struct {
+	Title          string
+	Genres         []string
+	MatchAllGenres bool
+	YearFrom       int
+	YearTo         int
+	MinRating      float64
+	MinDuration    int
+	MaxDuration    int
+	Director       string
+	Writer         string
+	Star           string
+	Audio          string
+	Subtitle       string
+}
+
+//Match checks media with loaded credits and genres matches all filters, title and people are matched partially and case-insensitive,
+//genres by slug. Years of media overlap the year range, series without YearTo are still running and other media span YearFrom only.
+func (f MediaFilter) Match(media Media) bool {
+	if !containsFold(media.Title, f.Title) ||
+		!hasCredit(media, CreditDirector, f.Director) ||
+		!hasCredit(media, CreditWriter, f.Writer) ||
+		!hasCredit(media, CreditStar, f.Star) ||
+		!containsFold(media.Audio, f.Audio) ||
+		!containsFold(media.Subtitles, f.Subtitle) {
+		return false
+	}
+	if len(f.Genres) > 0 {
+		slugs := f.genreSlugs()
+		matched := 0
+		for _, slug := range slugs {
+			for _, genre := range media.Genres {
+				if genre.Slug == slug {
+					matched++
+					break
+				}
+			}
+		}
+		if matched == 0 || (f.MatchAllGenres && matched != len(slugs)) {
+			return false
+		}
+	}
+	if f.YearFrom > 0 || f.YearTo > 0 {
+		from, to := media.YearFrom, media.YearTo
+		if to == nil && media.Type != Series {
+			to = from
+		}
+		if from == nil || (f.YearTo > 0 && *from > f.YearTo) || (f.YearFrom > 0 && to != nil && *to < f.YearFrom) {
+			return false
+		}
+	}
+	if f.MinRating > 0 && (media.RatingValue == nil || *media.RatingValue < f.MinRating) {
+		return false
+	}
+	if f.MinDuration > 0 || f.MaxDuration > 0 {
+		duration := media.DurationMinutes
+		if duration == nil || (f.MinDuration > 0 && *duration < f.MinDuration) || (f.MaxDuration > 0 && *duration > f.MaxDuration) {
+			return false
+		}
+	}
+	return true
+}
+
+//genreSlugs returns slugs of filtered genres, repeated and blank slugs are skipped
+func (f MediaFilter) genreSlugs() []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, genre := range f.Genres {
+		slug := Slugify(genre)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		result = append(result, slug)
+	}
+	return result
+}
+
+//hasCredit checks media has credit of role with person name containing name case-insensitive, empty name always matches
+func hasCredit(media Media, role CreditRole, name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, credit := range media.Credits {
+		if credit.Role == role && credit.Person != nil && containsFold(credit.Person.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+//containsFold checks value contains substr case-insensitive, empty substr always matches
+func containsFold(value, substr string) bool {
+	return substr == "" || strings.Contains(strings.ToLower(value), strings.ToLower(substr))
+}
+
+//likePattern escapes like wildcards of value and wraps it with %
+func likePattern(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+	return "%" + value + "%"
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	types "scaleflixapi/errors"
+	"scaleflixapi/logger"
+)
+
+const (
+	//ImportCreated media is created
+	ImportCreated = "created"
+	//ImportExists movie or series with same ImdbID exists, nothing is created
+	ImportExists = "exists"
+	//ImportDryRun media would be created, nothing is created
+	ImportDryRun = "dry_run"
+)
+
+//ImportResult definition of import, media is created or existing media or media a dry run would create
+type ImportResult struct {
+	Status   string `json:"status"`
+	Media    *Media `json:"media"`
+	Seasons  int    `json:"seasons"`
+	Episodes int    `json:"episodes"`
+}
+
+//ImportMedia stores converted movie or series with seasons and episodes in one transaction unless movie or series with its ImdbID exists.
+//Seasons without number are left out, dry run validates media and checks ImdbID without storing it.
+func (d *Data) ImportMedia(media *Media, dryRun bool) (ImportResult, error) {
+	if media.Type != Movie && media.Type != Series {
+		return ImportResult{}, invalidFields([]FieldError{{Field: "type", Code: types.CodeInvalidMediaType, Message: fmt.Sprintf(types.InvalidMediaType, typeName(media.Type))}})
+	}
+	if media.ImdbID == "" {
+		return ImportResult{}, invalidFields([]FieldError{{Field: "imdbId", Code: types.CodeFieldRequired, Message: types.FieldValueRequired}})
+	}
+	seasons := []*Seasons{}
+	for _, season := range media.Seasons {
+		if season != nil && season.Season > 0 {
+			seasons = append(seasons, season)
+		}
+	}
+	media.Seasons = seasons
+	if err := validateMedia(media, media.Type); err != nil {
+		return ImportResult{}, err
+	}
+	if existing, err := d.findImported(media.ImdbID); !errors.Is(err, ErrNotFound) {
+		return existing, err
+	}
+	eachMedia(media, normalizeNew)
+	if dryRun {
+		return newImportResult(ImportDryRun, media), nil
+	}
+	created, err := d.Store.CreateUniqueMedia(media)
+	if err != nil {
+		logger.Error.Println(err)
+		return ImportResult{}, err
+	}
+	if !created {
+		return d.findImported(media.ImdbID)
+	}
+	stored, err := d.Store.FindMediaByID(media.Type, media.ID)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return newImportResult(ImportCreated, &stored), nil
+}
+
+//findImported returns result of existing movie or series given IMDb id, ErrNotFound when it does not exist
+func (d *Data) findImported(imdbID string) (ImportResult, error) {
+	existing, err := d.Store.FindMediaByImdbID(imdbID)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	if existing, err = d.Store.FindMediaByID(existing.Type, existing.ID); err != nil {
+		return ImportResult{}, err
+	}
+	return newImportResult(ImportExists, &existing), nil
+}
+
+//newImportResult creates import result of media with its season and episode counts
+func newImportResult(status string, media *Media) ImportResult {
+	result := ImportResult{Status: status, Media: media, Seasons: len(media.Seasons)}
+	for _, season := range media.Seasons {
+		result.Episodes += len(season.Episode)
+	}
+	return result
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	types "scaleflixapi/errors"
+	"sort"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+//SigningKey definition, private key is nil for keys that only verify tokens
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+//KeySet definition, current key signs tokens and all keys verify tokens with matching kid
+type KeySet struct {
+	Current *SigningKey
+	Keys    map[string]*SigningKey
+	secret  []byte
+}
+
+//JWK definition of public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+//JWKSet definition of published public keys
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+//NewHMACKeySet creates key set signing tokens with secret, it is used when no key files are configured
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{Keys: map[string]*SigningKey{}, secret: []byte(secret)}
+}
+
+//LoadKeySet loads PEM keys given as comma separated kid=path list, signingKeyID selects current key, default is first key
+func LoadKeySet(keys, signingKeyID, secret string) (*KeySet, error) {
+	set := NewHMACKeySet(secret)
+	if strings.TrimSpace(keys) == "" {
+		return set, nil
+	}
+	for _, entry := range strings.Split(keys, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf(types.InvalidSigningKey, entry)
+		}
+		body, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseSigningKey(parts[0], body)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys[key.ID] = key
+		if set.Current == nil && signingKeyID == "" {
+			set.Current = key
+		}
+	}
+	if signingKeyID != "" {
+		set.Current = set.Keys[signingKeyID]
+	}
+	if set.Current == nil || set.Current.PrivateKey == nil {
+		return nil, fmt.Errorf(types.InvalidSigningKey, signingKeyID)
+	}
+	return set, nil
+}
+
+//parseSigningKey parses RSA or EC private or public key in PEM format
+func parseSigningKey(id string, body []byte) (*SigningKey, error) {
+	if key, err := jwt.ParseRSAPrivateKeyFromPEM(body); err == nil {
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, PrivateKey: key, PublicKey: &key.PublicKey}, nil
+	}
+	if key, err := jwt.ParseECPrivateKeyFromPEM(body); err == nil {
+		method, err := ecMethod(key.Curve)
+		return &SigningKey{ID: id, Method: method, PrivateKey: key, PublicKey: &key.PublicKey}, err
+	}
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(body); err == nil {
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, PublicKey: key}, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(body); err == nil {
+		method, err := ecMethod(key.Curve)
+		return &SigningKey{ID: id, Method: method, PublicKey: key}, err
+	}
+	return nil, fmt.Errorf(types.InvalidSigningKey, id)
+}
+
+//ecMethod returns ECDSA signing method of curve
+func ecMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	}
+	return nil, fmt.Errorf(types.InvalidSigningKey, curve.Params().Name)
+}
+
+//Sign signs claims with current key and sets kid header
+func (k *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	if k.Current == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+	token := jwt.NewWithClaims(k.Current.Method, claims)
+	token.Header["kid"] = k.Current.ID
+	return token.SignedString(k.Current.PrivateKey)
+}
+
+//Parse parses and verifies token with key of its kid, HMAC tokens are accepted only without key files
+func (k *KeySet) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if len(k.Keys) == 0 {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.New(types.TokenParseError)
+			}
+			return k.secret, nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.Keys[kid]
+		if !ok || token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New(types.TokenParseError)
+		}
+		return key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New(types.TokenParseError)
+	}
+	return claims, nil
+}
+
+//JWKS returns public keys of key set, HMAC secret is never published
+func (k *KeySet) JWKS() JWKSet {
+	result := JWKSet{Keys: []JWK{}}
+	ids := make([]string, 0, len(k.Keys))
+	for id := range k.Keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		key := k.Keys[id]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (public.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = public.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(padBytes(public.X.Bytes(), size))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(padBytes(public.Y.Bytes(), size))
+		}
+		result.Keys = append(result.Keys, jwk)
+	}
+	return result
+}
+
+//padBytes pads big-endian value with leading zeros to size
+func padBytes(value []byte, size int) []byte {
+	if len(value) >= size {
+		return value
+	}
+	return append(make([]byte, size-len(value)), value...)
+}
@@ -0,0 +1,892 @@
+package data
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+//memoryStore keeps data in memory, it is used for tests and local tools
+type memoryStore struct {
+	mu        sync.RWMutex
+	lastIDs   map[string]uint
+	media     map[uint]Media
+	seasons   map[uint]Seasons
+	episodes  map[uint]Episodes
+	users     map[uint]User
+	favorites map[uint]UserMedia
+	resets    map[uint]PasswordReset
+	refreshes map[string]RefreshToken
+	revoked   map[string]time.Time
+	people    map[uint]Person
+	genres    map[uint]Genre
+	credits   map[uint]Credit
+	links     map[uint][]MediaGenre
+}
+
+//NewMemoryStore creates empty in-memory storage backend
+func NewMemoryStore() Store {
+	return &memoryStore{
+		lastIDs:   map[string]uint{},
+		media:     map[uint]Media{},
+		seasons:   map[uint]Seasons{},
+		episodes:  map[uint]Episodes{},
+		users:     map[uint]User{},
+		favorites: map[uint]UserMedia{},
+		resets:    map[uint]PasswordReset{},
+		refreshes: map[string]RefreshToken{},
+		revoked:   map[string]time.Time{},
+		people:    map[uint]Person{},
+		genres:    map[uint]Genre{},
+		credits:   map[uint]Credit{},
+		links:     map[uint][]MediaGenre{},
+	}
+}
+
+//newModel creates model with next id of table and timestamps
+func (m *memoryStore) newModel(table string) gorm.Model {
+	m.lastIDs[table]++
+	now := time.Now()
+	return gorm.Model{ID: m.lastIDs[table], CreatedAt: now, UpdatedAt: now}
+}
+
+//CreateMedia creates media with seasons and episodes
+func (m *memoryStore) CreateMedia(media *Media) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.createMedia(media)
+	return nil
+}
+
+//CreateUniqueMedia creates media with seasons and episodes unless movie or series with its ImdbID exists, returns false then
+func (m *memoryStore) CreateUniqueMedia(media *Media) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.findByImdbID(media.ImdbID); ok {
+		return false, nil
+	}
+	m.createMedia(media)
+	return true, nil
+}
+
+//FindMediaByImdbID finds movie or series given IMDb id without seasons
+func (m *memoryStore) FindMediaByImdbID(imdbID string) (Media, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	media, ok := m.findByImdbID(imdbID)
+	if !ok {
+		return Media{}, gorm.ErrRecordNotFound
+	}
+	return media, nil
+}
+
+//findByImdbID returns movie or series with lowest id given IMDb id, caller must hold the lock
+func (m *memoryStore) findByImdbID(imdbID string) (Media, bool) {
+	ids := []uint{}
+	for id, media := range m.media {
+		if media.ImdbID == imdbID && (media.Type == Movie || media.Type == Series) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return Media{}, false
+	}
+	return m.media[sortIDs(ids)[0]], true
+}
+
+//createMedia stores media rows recursively, caller must hold the lock
+func (m *memoryStore) createMedia(media *Media) {
+	media.Model = m.newModel("media")
+	m.storeMedia(media)
+	for _, season := range media.Seasons {
+		mediaID := media.ID
+		season.MediaID = &mediaID
+		m.createSeason(season)
+	}
+}
+
+//createSeason stores season and its episodes, caller must hold the lock
+func (m *memoryStore) createSeason(season *Seasons) {
+	season.Model = m.newModel("seasons")
+	seasonRow := *season
+	seasonRow.Episode = nil
+	seasonRow.Media = nil
+	m.seasons[season.ID] = seasonRow
+	for _, episode := range season.Episode {
+		seasonID := season.ID
+		episode.SeasonsID = &seasonID
+		m.createEpisode(episode)
+	}
+}
+
+//createEpisode stores episode and its media, caller must hold the lock
+func (m *memoryStore) createEpisode(episode *Episodes) {
+	if episode.Media != nil {
+		m.createMedia(episode.Media)
+		episodeMediaID := episode.Media.ID
+		episode.MediaID = &episodeMediaID
+	}
+	episode.Model = m.newModel("episodes")
+	episodeRow := *episode
+	episodeRow.Media = nil
+	episodeRow.Seasons = nil
+	m.episodes[episode.ID] = episodeRow
+}
+
+//FindMedia finds medias with given type and filters, returns page and total count
+func (m *memoryStore) FindMedia(mediaType MediaType, filter MediaFilter, order Sort, page Page) ([]Media, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := []Media{}
+	ids := []uint{}
+	for id := range m.media {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		media := m.media[id]
+		if media.Type == mediaType && m.match(media, filter) {
+			result = append(result, media)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return order.Less(result[i], result[j]) })
+	start, end := page.bounds(len(result))
+	return result[start:end], len(result), nil
+}
+
+//FindMediaByID finds media with seasons and episodes given id
+func (m *memoryStore) FindMediaByID(mediaType MediaType, id uint) (Media, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	media, ok := m.media[id]
+	if !ok || media.Type != mediaType {
+		return Media{}, gorm.ErrRecordNotFound
+	}
+	seasonIDs := []uint{}
+	for seasonID, season := range m.seasons {
+		if season.MediaID != nil && *season.MediaID == id {
+			seasonIDs = append(seasonIDs, seasonID)
+		}
+	}
+	for _, seasonID := range sortIDs(seasonIDs) {
+		season := m.loadSeason(m.seasons[seasonID])
+		media.Seasons = append(media.Seasons, &season)
+	}
+	m.loadCredits(&media)
+	return media, nil
+}
+
+//match checks media row matches filter with its credits and genres, caller must hold the lock
+func (m *memoryStore) match(media Media, filter MediaFilter) bool {
+	m.loadCredits(&media)
+	return filter.Match(media)
+}
+
+//loadCredits attaches credits with people and genres to media and sets fields from them, caller must hold the lock
+func (m *memoryStore) loadCredits(media *Media) {
+	creditIDs := []uint{}
+	for creditID, credit := range m.credits {
+		if *credit.MediaID == media.ID {
+			creditIDs = append(creditIDs, creditID)
+		}
+	}
+	for _, creditID := range sortIDs(creditIDs) {
+		credit := m.credits[creditID]
+		person := m.people[*credit.PersonID]
+		credit.Person = &person
+		media.Credits = append(media.Credits, &credit)
+	}
+	for _, link := range m.links[media.ID] {
+		genre := m.genres[link.GenreID]
+		media.Genres = append(media.Genres, &genre)
+	}
+	applyCredits(media)
+}
+
+//storeMedia stores media row and replaces its credits and genres, caller must hold the lock
+func (m *memoryStore) storeMedia(media *Media) {
+	m.deleteCredits(media.ID)
+	media.Credits, media.Genres = nil, nil
+	for _, name := range mediaCredits(media) {
+		person := m.findOrCreatePerson(name.Name)
+		mediaID, personID := media.ID, person.ID
+		credit := Credit{Model: m.newModel("credits"), MediaID: &mediaID, PersonID: &personID, Role: name.Role, Position: name.Position}
+		m.credits[credit.ID] = credit
+		credit.Person = &person
+		media.Credits = append(media.Credits, &credit)
+	}
+	for i, genre := range mediaGenres(media) {
+		genre = m.findOrCreateGenre(genre)
+		m.links[media.ID] = append(m.links[media.ID], MediaGenre{MediaID: media.ID, GenreID: genre.ID, Position: i})
+		media.Genres = append(media.Genres, &genre)
+	}
+	row := *media
+	row.Seasons, row.Credits, row.Genres = nil, nil, nil
+	m.media[media.ID] = row
+}
+
+//findOrCreatePerson finds person given name or creates it, caller must hold the lock
+func (m *memoryStore) findOrCreatePerson(name string) Person {
+	for _, person := range m.people {
+		if person.Name == name {
+			return person
+		}
+	}
+	person := Person{Model: m.newModel("people"), Name: name}
+	m.people[person.ID] = person
+	return person
+}
+
+//findOrCreateGenre finds genre given slug or creates it, caller must hold the lock
+func (m *memoryStore) findOrCreateGenre(genre Genre) Genre {
+	for _, stored := range m.genres {
+		if stored.Slug == genre.Slug {
+			return stored
+		}
+	}
+	genre.Model = m.newModel("genres")
+	m.genres[genre.ID] = genre
+	return genre
+}
+
+//deleteCredits deletes credits and genre links of media, caller must hold the lock
+func (m *memoryStore) deleteCredits(mediaID uint) {
+	for creditID, credit := range m.credits {
+		if *credit.MediaID == mediaID {
+			delete(m.credits, creditID)
+		}
+	}
+	delete(m.links, mediaID)
+}
+
+//loadSeason attaches episodes with media to season row, caller must hold the lock
+func (m *memoryStore) loadSeason(season Seasons) Seasons {
+	episodeIDs := []uint{}
+	for episodeID, episode := range m.episodes {
+		if episode.SeasonsID != nil && *episode.SeasonsID == season.ID {
+			episodeIDs = append(episodeIDs, episodeID)
+		}
+	}
+	for _, episodeID := range sortIDs(episodeIDs) {
+		episode := m.loadEpisode(m.episodes[episodeID])
+		season.Episode = append(season.Episode, &episode)
+	}
+	return season
+}
+
+//loadEpisode attaches media to episode row, caller must hold the lock
+func (m *memoryStore) loadEpisode(episode Episodes) Episodes {
+	if episode.MediaID != nil {
+		if content, ok := m.media[*episode.MediaID]; ok {
+			episode.Media = &content
+		}
+	}
+	return episode
+}
+
+//UpdateMedia updates fields of media, seasons and episodes are not changed, non zero version must equal UpdatedAt of stored media
+func (m *memoryStore) UpdateMedia(media *Media, version time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.media[media.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if !version.IsZero() && !current.UpdatedAt.Equal(version) {
+		return ErrModified
+	}
+	media.CreatedAt, media.UpdatedAt = current.CreatedAt, time.Now()
+	m.storeMedia(media)
+	return nil
+}
+
+//DeleteMedia deletes media with seasons and episodes given id, non zero version must equal UpdatedAt of stored media
+func (m *memoryStore) DeleteMedia(id uint, version time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.media[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if !version.IsZero() && !current.UpdatedAt.Equal(version) {
+		return ErrModified
+	}
+	for seasonID, season := range m.seasons {
+		if season.MediaID != nil && *season.MediaID == id {
+			m.deleteSeason(seasonID)
+		}
+	}
+	m.deleteCredits(id)
+	m.deleteFavorites(id)
+	delete(m.media, id)
+	return nil
+}
+
+//deleteFavorites deletes favorites of media, caller must hold the lock
+func (m *memoryStore) deleteFavorites(mediaID uint) {
+	for id, favorite := range m.favorites {
+		if favorite.MediaID != nil && *favorite.MediaID == mediaID {
+			delete(m.favorites, id)
+		}
+	}
+}
+
+//FindSeason finds season with episodes given series id and season number
+func (m *memoryStore) FindSeason(seriesID uint, number int) (Seasons, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, season := range m.seasons {
+		if season.MediaID != nil && *season.MediaID == seriesID && season.Season == number {
+			return m.loadSeason(season), nil
+		}
+	}
+	return Seasons{}, gorm.ErrRecordNotFound
+}
+
+//CreateSeason creates season with episodes, non zero version must equal UpdatedAt of stored series
+func (m *memoryStore) CreateSeason(season *Seasons, version time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if season.MediaID == nil {
+		return gorm.ErrRecordNotFound
+	}
+	if err := m.touchSeries(*season.MediaID, version); err != nil {
+		return err
+	}
+	m.createSeason(season)
+	return nil
+}
+
+//UpdateSeason updates fields of season, episodes are not changed, non zero version must equal UpdatedAt of stored series
+func (m *memoryStore) UpdateSeason(season *Seasons, version time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.seasons[season.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if err := m.touchSeason(season.ID, version); err != nil {
+		return err
+	}
+	season.CreatedAt, season.UpdatedAt = current.CreatedAt, time.Now()
+	row := *season
+	row.Episode = nil
+	row.Media = nil
+	m.seasons[season.ID] = row
+	return nil
+}
+
+//DeleteSeason deletes season with episodes given id, non zero version must equal UpdatedAt of stored series
+func (m *memoryStore) DeleteSeason(id uint, version time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.touchSeason(id, version); err != nil {
+		return err
+	}
+	m.deleteSeason(id)
+	return nil
+}
+
+//touchSeason marks series of season updated, see touchSeries, caller must hold the lock
+func (m *memoryStore) touchSeason(seasonID uint, version time.Time) error {
+	season, ok := m.seasons[seasonID]
+	if !ok || season.MediaID == nil {
+		return gorm.ErrRecordNotFound
+	}
+	return m.touchSeries(*season.MediaID, version)
+}
+
+//touchSeries sets UpdatedAt of series so changes of seasons and episodes change version and ETag of series,
+//non zero version must equal UpdatedAt of stored series, caller must hold the lock
+func (m *memoryStore) touchSeries(id uint, version time.Time) error {
+	series, ok := m.media[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if !version.IsZero() && !series.UpdatedAt.Equal(version) {
+		return ErrModified
+	}
+	series.UpdatedAt = time.Now()
+	m.media[id] = series
+	return nil
+}
+
+//deleteSeason deletes season, its episodes and their media, caller must hold the lock
+func (m *memoryStore) deleteSeason(id uint) {
+	for episodeID, episode := range m.episodes {
+		if episode.SeasonsID != nil && *episode.SeasonsID == id {
+			m.deleteEpisode(episodeID)
+		}
+	}
+	delete(m.seasons, id)
+}
+
+//FindEpisode finds episode with media given season id and episode number
+func (m *memoryStore) FindEpisode(seasonID uint, number string) (Episodes, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, episode := range m.episodes {
+		if episode.SeasonsID != nil && *episode.SeasonsID == seasonID && episode.Episode == number {
+			return m.loadEpisode(episode), nil
+		}
+	}
+	return Episodes{}, gorm.ErrRecordNotFound
+}
+
+//CreateEpisode creates episode with media, non zero version must equal UpdatedAt of stored series
+func (m *memoryStore) CreateEpisode(episode *Episodes, version time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if episode.SeasonsID == nil {
+		return gorm.ErrRecordNotFound
+	}
+	if err := m.touchSeason(*episode.SeasonsID, version); err != nil {
+		return err
+	}
+	m.createEpisode(episode)
+	return nil
+}
+
+//UpdateEpisode updates fields of episode and its media, non zero version must equal UpdatedAt of stored series
+func (m *memoryStore) UpdateEpisode(episode *Episodes, version time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.episodes[episode.ID]
+	if !ok || current.SeasonsID == nil {
+		return gorm.ErrRecordNotFound
+	}
+	if err := m.touchSeason(*current.SeasonsID, version); err != nil {
+		return err
+	}
+	now := time.Now()
+	if episode.Media != nil {
+		if content, ok := m.media[episode.Media.ID]; ok {
+			episode.Media.CreatedAt = content.CreatedAt
+		}
+		episode.Media.UpdatedAt = now
+		if episode.Media.ID == 0 {
+			episode.Media.Model = m.newModel("media")
+		}
+		m.storeMedia(episode.Media)
+		episode.MediaID = &episode.Media.ID
+	}
+	episode.CreatedAt, episode.UpdatedAt = current.CreatedAt, now
+	row := *episode
+	row.Media = nil
+	row.Seasons = nil
+	m.episodes[episode.ID] = row
+	return nil
+}
+
+//DeleteEpisode deletes episode with media given id, non zero version must equal UpdatedAt of stored series
+func (m *memoryStore) DeleteEpisode(id uint, version time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	episode, ok := m.episodes[id]
+	if !ok || episode.SeasonsID == nil {
+		return gorm.ErrRecordNotFound
+	}
+	if err := m.touchSeason(*episode.SeasonsID, version); err != nil {
+		return err
+	}
+	m.deleteEpisode(id)
+	return nil
+}
+
+//deleteEpisode deletes episode and its media, caller must hold the lock
+func (m *memoryStore) deleteEpisode(id uint) {
+	if episode := m.episodes[id]; episode.MediaID != nil {
+		m.deleteCredits(*episode.MediaID)
+		m.deleteFavorites(*episode.MediaID)
+		delete(m.media, *episode.MediaID)
+	}
+	delete(m.episodes, id)
+}
+
+//FindPerson finds person given id
+func (m *memoryStore) FindPerson(id uint) (Person, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	person, ok := m.people[id]
+	if !ok {
+		return Person{}, gorm.ErrRecordNotFound
+	}
+	return person, nil
+}
+
+//FindCredits finds credits with media of person, returns page and total count
+func (m *memoryStore) FindCredits(personID uint, page Page) ([]Credit, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := []Credit{}
+	ids := []uint{}
+	for id := range m.credits {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		credit := m.credits[id]
+		media, ok := m.media[*credit.MediaID]
+		if *credit.PersonID != personID || !ok {
+			continue
+		}
+		credit.Media = &media
+		result = append(result, credit)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return *result[i].MediaID < *result[j].MediaID })
+	start, end := page.bounds(len(result))
+	return result[start:end], len(result), nil
+}
+
+//FindGenre finds genre given slug
+func (m *memoryStore) FindGenre(slug string) (Genre, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, genre := range m.genres {
+		if genre.Slug == slug {
+			return genre, nil
+		}
+	}
+	return Genre{}, gorm.ErrRecordNotFound
+}
+
+//FindGenreMedia finds media of genre, returns page and total count
+func (m *memoryStore) FindGenreMedia(genreID uint, page Page) ([]Media, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := []Media{}
+	ids := []uint{}
+	for id, links := range m.links {
+		for _, link := range links {
+			if link.GenreID == genreID {
+				ids = append(ids, id)
+			}
+		}
+	}
+	for _, id := range sortIDs(ids) {
+		result = append(result, m.media[id])
+	}
+	start, end := page.bounds(len(result))
+	return result[start:end], len(result), nil
+}
+
+//SearchMedia searches medias of given types with fallback scorer, results are ordered by score
+func (m *memoryStore) SearchMedia(text string, mediaTypes []MediaType, page Page) ([]SearchResult, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	terms := searchTerms(text)
+	result := []SearchResult{}
+	ids := []uint{}
+	for id := range m.media {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		media := m.media[id]
+		if !hasMediaType(mediaTypes, media.Type) {
+			continue
+		}
+		if score, highlights := scoreMedia(media, terms); score > 0 {
+			result = append(result, SearchResult{Media: media, Score: score, Highlights: highlights})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Score > result[j].Score })
+	start, end := page.bounds(len(result))
+	return result[start:end], len(result), nil
+}
+
+//CreateFavorite creates favorite media for user, returns ErrNotFound for unknown media and ErrFavoriteExists for duplicates
+func (m *memoryStore) CreateFavorite(favorite *UserMedia) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if favorite.MediaID == nil || favorite.UserID == nil {
+		return ErrNotFound
+	}
+	if _, ok := m.media[*favorite.MediaID]; !ok {
+		return ErrNotFound
+	}
+	for _, row := range m.favorites {
+		if *row.UserID == *favorite.UserID && *row.MediaID == *favorite.MediaID {
+			return ErrFavoriteExists
+		}
+	}
+	favorite.Model = m.newModel("user_media")
+	row := *favorite
+	row.Media = nil
+	m.favorites[favorite.ID] = row
+	return nil
+}
+
+//FindFavorite finds favorite given id
+func (m *memoryStore) FindFavorite(id uint) (UserMedia, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	favorite, ok := m.favorites[id]
+	if !ok {
+		return UserMedia{}, gorm.ErrRecordNotFound
+	}
+	return favorite, nil
+}
+
+//DeleteFavorite deletes favorite given id
+func (m *memoryStore) DeleteFavorite(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.favorites, id)
+	return nil
+}
+
+//FindFavorites finds favorites with media for given user and filters, returns page and total count
+func (m *memoryStore) FindFavorites(userID uint, filter MediaFilter, order Sort, page Page) ([]UserMedia, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := []UserMedia{}
+	ids := []uint{}
+	for id := range m.favorites {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		favorite := m.favorites[id]
+		if favorite.UserID == nil || *favorite.UserID != userID || favorite.MediaID == nil {
+			continue
+		}
+		media, ok := m.media[*favorite.MediaID]
+		if !ok || !m.match(media, filter) {
+			continue
+		}
+		favorite.Media = &media
+		result = append(result, favorite)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if compared := order.Compare(*result[i].Media, *result[j].Media); compared != 0 {
+			return compared < 0
+		}
+		return result[i].ID < result[j].ID
+	})
+	start, end := page.bounds(len(result))
+	return result[start:end], len(result), nil
+}
+
+//CreateUser creates user
+func (m *memoryStore) CreateUser(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Email == user.Email {
+			return ErrEmailExists
+		}
+	}
+	user.Model = m.newModel("users")
+	m.users[user.ID] = *user
+	return nil
+}
+
+//FindUserByEmail finds user given email
+func (m *memoryStore) FindUserByEmail(email string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return User{}, gorm.ErrRecordNotFound
+}
+
+//FindUserByID finds user given id
+func (m *memoryStore) FindUserByID(id uint) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[id]
+	if !ok {
+		return User{}, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+//FindUsers finds users, returns page and total count
+func (m *memoryStore) FindUsers(page Page) ([]User, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := []User{}
+	ids := []uint{}
+	for id := range m.users {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		result = append(result, m.users[id])
+	}
+	start, end := page.bounds(len(result))
+	return result[start:end], len(result), nil
+}
+
+//UpdateUser updates name, role and deactivation of user
+func (m *memoryStore) UpdateUser(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.users[user.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	stored.Name, stored.Role, stored.DeactivatedAt = user.Name, user.Role, user.DeactivatedAt
+	stored.UpdatedAt = time.Now()
+	m.users[user.ID] = stored
+	*user = stored
+	return nil
+}
+
+//UpdateUserPassword updates password hash of user
+func (m *memoryStore) UpdateUserPassword(id uint, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	user.Password = hash
+	user.UpdatedAt = time.Now()
+	m.users[id] = user
+	return nil
+}
+
+//CreatePasswordReset creates password reset
+func (m *memoryStore) CreatePasswordReset(reset *PasswordReset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reset.Model = m.newModel("password_resets")
+	m.resets[reset.ID] = *reset
+	return nil
+}
+
+//UsePasswordReset marks unused and unexpired password reset as used
+func (m *memoryStore) UsePasswordReset(tokenHash string) (PasswordReset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for id, reset := range m.resets {
+		if reset.TokenHash != tokenHash || reset.UsedAt != nil || !reset.ExpiresAt.After(now) {
+			continue
+		}
+		reset.UsedAt = &now
+		m.resets[id] = reset
+		return reset, nil
+	}
+	return PasswordReset{}, gorm.ErrRecordNotFound
+}
+
+//CreateRefreshToken creates refresh token
+func (m *memoryStore) CreateRefreshToken(token *RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token.Model = m.newModel("refresh_tokens")
+	m.refreshes[token.JTI] = *token
+	return nil
+}
+
+//RotateRefreshToken marks active refresh token as rotated, returns false when token was already rotated or revoked
+func (m *memoryStore) RotateRefreshToken(jti string) (RefreshToken, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.refreshes[jti]
+	if !ok {
+		return RefreshToken{}, false, gorm.ErrRecordNotFound
+	}
+	now := time.Now()
+	if token.RotatedAt != nil || token.RevokedAt != nil || !token.ExpiresAt.After(now) {
+		return token, false, nil
+	}
+	token.RotatedAt = &now
+	m.refreshes[jti] = token
+	return token, true, nil
+}
+
+//RevokeToken adds key to denylist until expiry, expired keys are removed
+func (m *memoryStore) RevokeToken(key string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoke(key, expiresAt)
+	return nil
+}
+
+//revoke adds key to denylist, caller must hold the lock
+func (m *memoryStore) revoke(key string, expiresAt time.Time) {
+	now := time.Now()
+	for revokedKey, revokedUntil := range m.revoked {
+		if revokedUntil.Before(now) {
+			delete(m.revoked, revokedKey)
+		}
+	}
+	m.revoked[key] = expiresAt
+}
+
+//RevokeFamily revokes refresh tokens of family and adds family to denylist
+func (m *memoryStore) RevokeFamily(familyID string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for jti, token := range m.refreshes {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			m.refreshes[jti] = token
+		}
+	}
+	m.revoke(familyID, expiresAt)
+	return nil
+}
+
+//RevokeUserFamilies revokes refresh tokens of user and adds their unexpired families to denylist
+func (m *memoryStore) RevokeUserFamilies(userID uint, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	families := map[string]bool{}
+	for jti, token := range m.refreshes {
+		if token.UserID == nil || *token.UserID != userID {
+			continue
+		}
+		if token.ExpiresAt.After(now) {
+			families[token.FamilyID] = true
+		}
+		if token.RevokedAt == nil {
+			token.RevokedAt = &now
+			m.refreshes[jti] = token
+		}
+	}
+	for familyID := range families {
+		m.revoke(familyID, expiresAt)
+	}
+	return nil
+}
+
+//IsRevoked checks any of keys is in denylist
+func (m *memoryStore) IsRevoked(keys ...string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	for _, key := range keys {
+		if revokedUntil, ok := m.revoked[key]; ok && revokedUntil.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//Close does nothing for memory store
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+//hasMediaType checks media type is in types
+func hasMediaType(mediaTypes []MediaType, mediaType MediaType) bool {
+	for _, t := range mediaTypes {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+//sortIDs sorts ids in insertion order
+func sortIDs(ids []uint) []uint {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,201 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+//migrationLock key of postgres advisory lock taken while a migration runs, so concurrent instances apply each migration once
+const migrationLock = 7301
+
+//Migration definition of versioned schema change, up and down run in one transaction
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+//SchemaMigration definition of applied migration
+type SchemaMigration struct {
+	Version   int64     `gorm:"primary_key;auto_increment:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+//TableName returns table of applied migrations
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+//MigrationStatus definition of migration, pending migrations have no AppliedAt
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+//Migrator applies migrations to postgres database and records them in schema_migrations table
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+}
+
+//NewMigrator creates migrator of schema migrations
+func NewMigrator(db *gorm.DB) *Migrator {
+	return &Migrator{DB: db, Migrations: migrations}
+}
+
+//Up applies pending migrations in version order, returns applied migrations
+func (m *Migrator) Up() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	result := []Migration{}
+	for _, migration := range m.sorted() {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		done, err := m.run(migration, true)
+		if err != nil {
+			return result, fmt.Errorf("migration %d %s failed: %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			result = append(result, migration)
+		}
+	}
+	return result, nil
+}
+
+//Down rolls back given count of latest applied migrations, steps less than 1 roll back all, returns rolled back migrations
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	if steps > 0 && steps < len(versions) {
+		versions = versions[:steps]
+	}
+	result := []Migration{}
+	for _, version := range versions {
+		migration, ok := m.find(version)
+		if !ok {
+			return result, fmt.Errorf("migration %d %s is unknown", version, applied[version].Name)
+		}
+		done, err := m.run(migration, false)
+		if err != nil {
+			return result, fmt.Errorf("migration %d %s rollback failed: %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			result = append(result, migration)
+		}
+	}
+	return result, nil
+}
+
+//Status lists known migrations in version order with applied time
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	result := []MigrationStatus{}
+	for _, migration := range m.sorted() {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+//run applies or rolls back migration in a transaction holding migration lock, returns false when another instance already did it
+func (m *Migrator) run(migration Migration, up bool) (bool, error) {
+	done := false
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error; err != nil {
+			return err
+		}
+		count := 0
+		if err := tx.Model(&SchemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+			return err
+		}
+		if (count > 0) == up {
+			return nil
+		}
+		if !up {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			done = true
+			return tx.Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error
+		}
+		if err := migration.Up(tx); err != nil {
+			return err
+		}
+		done = true
+		return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+	})
+	return done && err == nil, err
+}
+
+//applied creates schema_migrations table when missing and returns applied migrations by version
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	err := m.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp with time zone NOT NULL
+	)`).Error
+	if err != nil {
+		return nil, err
+	}
+	rows := []SchemaMigration{}
+	if err = m.DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		result[row.Version] = row
+	}
+	return result, nil
+}
+
+//sorted returns migrations in version order
+func (m *Migrator) sorted() []Migration {
+	result := append([]Migration{}, m.Migrations...)
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result
+}
+
+//find returns migration given version
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+//execAll returns migration step executing statements in order
+func execAll(statements ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
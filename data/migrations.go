@@ -0,0 +1,244 @@
+package data
+
+import (
+	"scaleflixapi/logger"
+
+	"github.com/jinzhu/gorm"
+)
+
+//migrations schema migrations of postgres store in version order, tables and columns use IF NOT EXISTS so databases created by AutoMigrate are adopted
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: execAll(
+			`CREATE TABLE IF NOT EXISTS users (
+				id serial PRIMARY KEY,
+				created_at timestamp with time zone,
+				updated_at timestamp with time zone,
+				deleted_at timestamp with time zone,
+				name text,
+				email text UNIQUE,
+				password text,
+				role text
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at)`,
+			`CREATE TABLE IF NOT EXISTS media (
+				id serial PRIMARY KEY,
+				created_at timestamp with time zone,
+				updated_at timestamp with time zone,
+				deleted_at timestamp with time zone,
+				type integer,
+				title text,
+				description text,
+				rating text,
+				director text,
+				writer text,
+				stars text,
+				release_date timestamp with time zone,
+				duration text,
+				imdb_id text,
+				year text,
+				genre text,
+				audio text,
+				subtitles text
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_media_deleted_at ON media (deleted_at)`,
+			`CREATE TABLE IF NOT EXISTS seasons (
+				id serial PRIMARY KEY,
+				created_at timestamp with time zone,
+				updated_at timestamp with time zone,
+				deleted_at timestamp with time zone,
+				season integer,
+				total_seasons integer,
+				media_id integer NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_seasons_deleted_at ON seasons (deleted_at)`,
+			`CREATE TABLE IF NOT EXISTS episodes (
+				id serial PRIMARY KEY,
+				created_at timestamp with time zone,
+				updated_at timestamp with time zone,
+				deleted_at timestamp with time zone,
+				episode text,
+				media_id integer NOT NULL,
+				seasons_id integer NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_episodes_deleted_at ON episodes (deleted_at)`,
+			`CREATE TABLE IF NOT EXISTS user_media (
+				id serial PRIMARY KEY,
+				created_at timestamp with time zone,
+				updated_at timestamp with time zone,
+				deleted_at timestamp with time zone,
+				media_id integer NOT NULL,
+				user_id integer NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_user_media_deleted_at ON user_media (deleted_at)`,
+		),
+		Down: execAll(`DROP TABLE IF EXISTS user_media, episodes, seasons, media, users`),
+	},
+	{
+		Version: 2,
+		Name:    "user_accounts_and_tokens",
+		Up: execAll(
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at timestamp with time zone`,
+			`CREATE TABLE IF NOT EXISTS password_resets (
+				id serial PRIMARY KEY,
+				created_at timestamp with time zone,
+				updated_at timestamp with time zone,
+				deleted_at timestamp with time zone,
+				user_id integer NOT NULL,
+				token_hash text UNIQUE,
+				expires_at timestamp with time zone,
+				used_at timestamp with time zone
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_password_resets_deleted_at ON password_resets (deleted_at)`,
+			`CREATE TABLE IF NOT EXISTS refresh_tokens (
+				id serial PRIMARY KEY,
+				created_at timestamp with time zone,
+				updated_at timestamp with time zone,
+				deleted_at timestamp with time zone,
+				jti text UNIQUE,
+				family_id text,
+				user_id integer NOT NULL,
+				expires_at timestamp with time zone,
+				rotated_at timestamp with time zone,
+				revoked_at timestamp with time zone
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_deleted_at ON refresh_tokens (deleted_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id)`,
+			`CREATE TABLE IF NOT EXISTS revoked_tokens (
+				id serial PRIMARY KEY,
+				created_at timestamp with time zone,
+				updated_at timestamp with time zone,
+				deleted_at timestamp with time zone,
+				key text UNIQUE,
+				expires_at timestamp with time zone
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_revoked_tokens_deleted_at ON revoked_tokens (deleted_at)`,
+		),
+		Down: execAll(
+			`DROP TABLE IF EXISTS revoked_tokens, refresh_tokens, password_resets`,
+			`ALTER TABLE users DROP COLUMN IF EXISTS deactivated_at`,
+		),
+	},
+	{
+		Version: 3,
+		Name:    "credits_and_genres",
+		Up: func(tx *gorm.DB) error {
+			err := execAll(
+				`CREATE TABLE IF NOT EXISTS people (
+					id serial PRIMARY KEY,
+					created_at timestamp with time zone,
+					updated_at timestamp with time zone,
+					deleted_at timestamp with time zone,
+					name text NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_people_deleted_at ON people (deleted_at)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS uix_people_name ON people (name)`,
+				`CREATE TABLE IF NOT EXISTS genres (
+					id serial PRIMARY KEY,
+					created_at timestamp with time zone,
+					updated_at timestamp with time zone,
+					deleted_at timestamp with time zone,
+					name text NOT NULL,
+					slug text NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_genres_deleted_at ON genres (deleted_at)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS uix_genres_slug ON genres (slug)`,
+				`CREATE TABLE IF NOT EXISTS credits (
+					id serial PRIMARY KEY,
+					created_at timestamp with time zone,
+					updated_at timestamp with time zone,
+					deleted_at timestamp with time zone,
+					media_id integer NOT NULL,
+					person_id integer NOT NULL,
+					role text NOT NULL,
+					position integer
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_credits_deleted_at ON credits (deleted_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_credits_media_id ON credits (media_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_credits_person_id ON credits (person_id)`,
+				`CREATE TABLE IF NOT EXISTS media_genres (
+					media_id integer,
+					genre_id integer,
+					position integer,
+					PRIMARY KEY (media_id, genre_id)
+				)`,
+			)(tx)
+			if err != nil {
+				return err
+			}
+			count, err := backfillCredits(tx)
+			if count > 0 {
+				logger.Info.Printf("credits of %d media are migrated", count)
+			}
+			return err
+		},
+		Down: execAll(`DROP TABLE IF EXISTS media_genres, credits, genres, people`),
+	},
+	{
+		Version: 4,
+		Name:    "typed_media_fields",
+		Up: func(tx *gorm.DB) error {
+			err := execAll(
+				`ALTER TABLE media ADD COLUMN IF NOT EXISTS rating_value numeric`,
+				`ALTER TABLE media ADD COLUMN IF NOT EXISTS duration_minutes integer`,
+				`ALTER TABLE media ADD COLUMN IF NOT EXISTS year_from integer`,
+				`ALTER TABLE media ADD COLUMN IF NOT EXISTS year_to integer`,
+				`CREATE INDEX IF NOT EXISTS idx_media_year_from ON media (year_from)`,
+				`CREATE INDEX IF NOT EXISTS idx_media_rating_value ON media (rating_value)`,
+			)(tx)
+			if err != nil {
+				return err
+			}
+			count, err := backfillFields(tx)
+			if count > 0 {
+				logger.Info.Printf("typed fields of %d media are migrated", count)
+			}
+			return err
+		},
+		Down: execAll(
+			`ALTER TABLE media DROP COLUMN IF EXISTS year_to`,
+			`ALTER TABLE media DROP COLUMN IF EXISTS year_from`,
+			`ALTER TABLE media DROP COLUMN IF EXISTS duration_minutes`,
+			`ALTER TABLE media DROP COLUMN IF EXISTS rating_value`,
+		),
+	},
+	{
+		Version: 5,
+		Name:    "media_imdb_id_index",
+		Up:      execAll(`CREATE INDEX IF NOT EXISTS idx_media_imdb_id ON media (imdb_id)`),
+		Down:    execAll(`DROP INDEX IF EXISTS idx_media_imdb_id`),
+	},
+	{
+		Version: 6,
+		Name:    "unique_favorites",
+		Up: execAll(
+			//duplicates of concurrent requests are removed, the first favorite is kept
+			`UPDATE user_media SET deleted_at = now() WHERE deleted_at IS NULL AND id NOT IN (
+				SELECT min(id) FROM user_media WHERE deleted_at IS NULL GROUP BY user_id, media_id
+			)`,
+			`UPDATE user_media SET deleted_at = now() WHERE deleted_at IS NULL AND media_id IN (SELECT id FROM media WHERE deleted_at IS NOT NULL)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_user_media_user_media ON user_media (user_id, media_id) WHERE deleted_at IS NULL`,
+		),
+		Down: execAll(`DROP INDEX IF EXISTS idx_user_media_user_media`),
+	},
+	{
+		Version: 7,
+		Name:    "trigram_extension",
+		//servers without pg_trgm are migrated too, search is not typo tolerant then
+		Up: execAll(`DO $$ BEGIN
+			CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		EXCEPTION WHEN OTHERS THEN
+			RAISE WARNING 'pg_trgm is not available, search is not typo tolerant: %', SQLERRM;
+		END $$`),
+		Down: execAll(`DROP EXTENSION IF EXISTS pg_trgm`),
+	},
+	{
+		Version: 8,
+		Name:    "media_search_index",
+		//expression must equal searchDocument of search queries for the index to be used
+		Up:   execAll(`CREATE INDEX IF NOT EXISTS idx_media_search ON media USING gin ((` + searchDocument + `))`),
+		Down: execAll(`DROP INDEX IF EXISTS idx_media_search`),
+	},
+}
@@ -0,0 +1,116 @@
+package data
+
+import (
+	"scaleflixapi/config"
+	types "scaleflixapi/errors"
+	"strconv"
+)
+
+//Page definition for paginated list queries, pages of NewPage start at multiples of Size
+type Page struct {
+	Offset int
+	Size   int
+}
+
+//MediaList definition for paginated media response
+type MediaList struct {
+	Items    []Media `json:"items"`
+	Total    int     `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"pageSize"`
+	Next     string  `json:"next,omitempty"`
+	Prev     string  `json:"prev,omitempty"`
+}
+
+//CreditList definition for paginated credits of person response
+type CreditList struct {
+	Person   Person   `json:"person"`
+	Items    []Credit `json:"items"`
+	Total    int      `json:"total"`
+	Page     int      `json:"page"`
+	PageSize int      `json:"pageSize"`
+	Next     string   `json:"next,omitempty"`
+	Prev     string   `json:"prev,omitempty"`
+}
+
+//GenreMediaList definition for paginated media of genre response
+type GenreMediaList struct {
+	Genre    Genre   `json:"genre"`
+	Items    []Media `json:"items"`
+	Total    int     `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"pageSize"`
+	Next     string  `json:"next,omitempty"`
+	Prev     string  `json:"prev,omitempty"`
+}
+
+//FavoriteList definition for paginated favorites response
+type FavoriteList struct {
+	Items    []UserMedia `json:"items"`
+	Total    int         `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+	Next     string      `json:"next,omitempty"`
+	Prev     string      `json:"prev,omitempty"`
+}
+
+//MaxPageSize returns page size limit from config
+func MaxPageSize() int {
+	size, err := strconv.Atoi(config.PageSize)
+	if err != nil || size < 1 {
+		return 10
+	}
+	return size
+}
+
+//NewPage creates page given page number and size, size is capped by config page size
+func NewPage(number, size int) (Page, error) {
+	if number < 1 || size < 1 {
+		return Page{}, types.NewValidation(types.CodeInvalidPage, types.InvalidPage)
+	}
+	if max := MaxPageSize(); size > max {
+		size = max
+	}
+	return Page{Offset: (number - 1) * size, Size: size}, nil
+}
+
+//Number returns page number starting from 1 of page created by NewPage
+func (p Page) Number() int {
+	return p.Offset/p.Size + 1
+}
+
+//HasNext checks there are more items after page
+func (p Page) HasNext(total int) bool {
+	return p.Offset+p.Size < total
+}
+
+//HasPrev checks there are items before page
+func (p Page) HasPrev() bool {
+	return p.Offset > 0
+}
+
+//NextPage returns following page
+func (p Page) NextPage() Page {
+	return Page{Offset: p.Offset + p.Size, Size: p.Size}
+}
+
+//PrevPage returns previous page
+func (p Page) PrevPage() Page {
+	offset := p.Offset - p.Size
+	if offset < 0 {
+		offset = 0
+	}
+	return Page{Offset: offset, Size: p.Size}
+}
+
+//bounds returns slice bounds of page for given total
+func (p Page) bounds(total int) (int, int) {
+	start, end := p.Offset, p.Offset+p.Size
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	return start, end
+}
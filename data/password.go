@@ -0,0 +1,91 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	//MinPasswordLength minimum length of new passwords
+	MinPasswordLength = 8
+	//resetTokenTTL lifetime of password reset tokens
+	resetTokenTTL = time.Hour
+)
+
+//PasswordReset definition, only hash of one-time token is stored
+type PasswordReset struct {
+	gorm.Model
+	UserID    *uint      `gorm:"not null" json:"userId"`
+	TokenHash string     `gorm:"unique" json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
+
+//ChangePassword definition
+type ChangePassword struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+//PasswordResetRequest definition
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+//PasswordResetToken definition, token is shown only once
+type PasswordResetToken struct {
+	Email     string    `json:"email"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+//ResetPassword definition
+type ResetPassword struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+//HashPassword hashes password with bcrypt
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+//compare plain password with hash password, plaintext rows are accepted once and need rehash
+func checkPasswordHash(password, hash string) (bool, bool) {
+	if isHashed(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, false
+	}
+	match := subtle.ConstantTimeCompare([]byte(password), []byte(hash)) == 1
+	return match, match
+}
+
+//isHashed checks value is a bcrypt hash
+func isHashed(value string) bool {
+	_, err := bcrypt.Cost([]byte(value))
+	return err == nil && strings.HasPrefix(value, "$2")
+}
+
+//newResetToken creates random one-time token and its hash
+func newResetToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashResetToken(token), nil
+}
+
+//hashResetToken hashes reset token for storage
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,29 @@
+package data
+
+import (
+	"strings"
+)
+
+//GetPerson gets person given id with paginated credits and their media
+func (d *Data) GetPerson(id string, page Page) (CreditList, error) {
+	key, err := parseID(id)
+	if err != nil {
+		return CreditList{}, err
+	}
+	person, err := d.Store.FindPerson(key)
+	if err != nil {
+		return CreditList{}, notFound(err, id)
+	}
+	credits, total, err := d.Store.FindCredits(person.ID, page)
+	return CreditList{Person: person, Items: credits, Total: total, Page: page.Number(), PageSize: page.Size}, err
+}
+
+//GetGenre gets genre given slug with paginated media
+func (d *Data) GetGenre(slug string, page Page) (GenreMediaList, error) {
+	genre, err := d.Store.FindGenre(strings.ToLower(slug))
+	if err != nil {
+		return GenreMediaList{}, notFound(err, slug)
+	}
+	media, total, err := d.Store.FindGenreMedia(genre.ID, page)
+	return GenreMediaList{Genre: genre, Items: media, Total: total, Page: page.Number(), PageSize: page.Size}, err
+}
@@ -0,0 +1,799 @@
+package data
+
+import (
+	"encoding/json"
+	"scaleflixapi/logger"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+//uniqueViolation postgres error code
+const uniqueViolation = "23505"
+
+//postgresStore keeps data in postgres database with gorm
+type postgresStore struct {
+	DB       *gorm.DB
+	trigrams bool
+}
+
+//searchRow definition for search query results, highlights is JSON object of ts_headline of searchFields
+type searchRow struct {
+	Media
+	Score      float64
+	Highlights string
+}
+
+//searchDocument weighted tsvector of searched media columns, it is indexed by idx_media_search so changes need a migration recreating the index
+const searchDocument = `setweight(to_tsvector('english', coalesce(media.title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(media.director, '') || ' ' || coalesce(media.writer, '') || ' ' || coalesce(media.stars, '')), 'B') ||
+	setweight(to_tsvector('english', coalesce(media.genre, '')), 'B') ||
+	setweight(to_tsvector('english', coalesce(media.description, '')), 'C')`
+
+//NewPostgresStore creates postgres storage backend, tables and pg_trgm extension are created by migrations of Migrator
+func NewPostgresStore(db *gorm.DB) Store {
+	store := &postgresStore{DB: db}
+	count := 0
+	if err := db.Table("pg_extension").Where("extname = ?", "pg_trgm").Count(&count).Error; err != nil || count == 0 {
+		logger.Error.Println("pg_trgm is not installed, search is not typo tolerant", err)
+	} else {
+		store.trigrams = true
+	}
+	return store
+}
+
+//CreateMedia creates media with seasons, episodes and credits
+func (p *postgresStore) CreateMedia(media *Media) error {
+	eachMedia(media, clearCredits)
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(media).Error; err != nil {
+			return err
+		}
+		return eachMedia(media, func(m *Media) error { return syncCredits(tx, m) })
+	})
+}
+
+//CreateUniqueMedia creates media with seasons and episodes unless movie or series with its ImdbID exists, returns false then.
+//Imports of same ImdbID are serialized with advisory lock of the id so only one of them creates media.
+func (p *postgresStore) CreateUniqueMedia(media *Media) (bool, error) {
+	eachMedia(media, clearCredits)
+	created := false
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "media:"+media.ImdbID).Error; err != nil {
+			return err
+		}
+		count := 0
+		if err := tx.Model(&Media{}).Where("imdb_id = ? AND type IN (?)", media.ImdbID, []MediaType{Movie, Series}).Count(&count).Error; err != nil || count > 0 {
+			return err
+		}
+		if err := tx.Create(media).Error; err != nil {
+			return err
+		}
+		created = true
+		return eachMedia(media, func(m *Media) error { return syncCredits(tx, m) })
+	})
+	return created && err == nil, err
+}
+
+//FindMediaByImdbID finds movie or series given IMDb id without seasons
+func (p *postgresStore) FindMediaByImdbID(imdbID string) (Media, error) {
+	result := Media{}
+	err := p.DB.Where("imdb_id = ? AND type IN (?)", imdbID, []MediaType{Movie, Series}).Order("id").First(&result).Error
+	return result, err
+}
+
+//FindMedia finds medias with given type and filters, returns page and total count
+func (p *postgresStore) FindMedia(mediaType MediaType, filter MediaFilter, order Sort, page Page) ([]Media, int, error) {
+	result := []Media{}
+	query := applyFilter(p.DB.Where("type = ?", mediaType), "media", filter)
+	total := 0
+	err := query.Model(&Media{}).Count(&total).Error
+	if err != nil {
+		return result, 0, err
+	}
+	err = applySort(query, "media", order).Order("media.id").Offset(page.Offset).Limit(page.Size).Find(&result).Error
+	return result, total, err
+}
+
+//FindMediaByID finds media with seasons and episodes given id
+func (p *postgresStore) FindMediaByID(mediaType MediaType, id uint) (Media, error) {
+	result := Media{}
+	err := p.DB.Preload("Seasons").Preload("Seasons.Episode").Preload("Seasons.Episode.Media").
+		Preload("Credits", orderByID("credits")).Preload("Credits.Person").Where("type = ?", mediaType).Where("id = ?", id).First(&result).Error
+	if err != nil {
+		return result, err
+	}
+	err = p.DB.Joins("JOIN media_genres ON media_genres.genre_id = genres.id").Where("media_genres.media_id = ?", result.ID).Order("media_genres.position").Find(&result.Genres).Error
+	applyCredits(&result)
+	return result, err
+}
+
+//UpdateMedia updates columns of media, seasons and episodes are not changed, non zero version must equal UpdatedAt of stored media
+func (p *postgresStore) UpdateMedia(media *Media, version time.Time) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		current := Media{}
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", media.ID).First(&current).Error
+		if err != nil {
+			return err
+		}
+		if !version.IsZero() && !current.UpdatedAt.Equal(version) {
+			return ErrModified
+		}
+		if err = tx.Set("gorm:save_associations", false).Save(media).Error; err != nil {
+			return err
+		}
+		return syncCredits(tx, media)
+	})
+}
+
+//DeleteMedia deletes media with seasons and episodes given id, non zero version must equal UpdatedAt of stored media
+func (p *postgresStore) DeleteMedia(id uint, version time.Time) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		result := Media{}
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Preload("Seasons").Preload("Seasons.Episode").Where("id = ?", id).First(&result).Error
+		if err != nil {
+			return err
+		}
+		if !version.IsZero() && !result.UpdatedAt.Equal(version) {
+			return ErrModified
+		}
+		for _, season := range result.Seasons {
+			if err = deleteSeason(tx, season); err != nil {
+				logger.Error.Println(err)
+				return err
+			}
+		}
+		if err = deleteCredits(tx, id); err != nil {
+			return err
+		}
+		if err = deleteFavorites(tx, id); err != nil {
+			return err
+		}
+		return tx.Delete(&Media{Model: gorm.Model{ID: id}}).Error
+	})
+}
+
+//deleteFavorites deletes favorites of media
+func deleteFavorites(tx *gorm.DB, mediaID uint) error {
+	return tx.Where("media_id = ?", mediaID).Delete(&UserMedia{}).Error
+}
+
+//FindSeason finds season with episodes given series id and season number
+func (p *postgresStore) FindSeason(seriesID uint, number int) (Seasons, error) {
+	result := Seasons{}
+	err := p.DB.Preload("Episode").Preload("Episode.Media").Where("media_id = ? AND season = ?", seriesID, number).First(&result).Error
+	return result, err
+}
+
+//CreateSeason creates season with episodes, non zero version must equal UpdatedAt of stored series
+func (p *postgresStore) CreateSeason(season *Seasons, version time.Time) error {
+	if season.MediaID == nil {
+		return ErrNotFound
+	}
+	eachEpisodeMedia(season, clearCredits)
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := touchSeries(tx, *season.MediaID, version); err != nil {
+			return err
+		}
+		if err := tx.Create(season).Error; err != nil {
+			return err
+		}
+		return eachEpisodeMedia(season, func(m *Media) error { return syncCredits(tx, m) })
+	})
+}
+
+//UpdateSeason updates columns of season, episodes are not changed, non zero version must equal UpdatedAt of stored series
+func (p *postgresStore) UpdateSeason(season *Seasons, version time.Time) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := touchSeason(tx, season.ID, version); err != nil {
+			return err
+		}
+		return tx.Set("gorm:save_associations", false).Save(season).Error
+	})
+}
+
+//DeleteSeason deletes season with episodes given id, non zero version must equal UpdatedAt of stored series
+func (p *postgresStore) DeleteSeason(id uint, version time.Time) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := touchSeason(tx, id, version); err != nil {
+			return err
+		}
+		season := Seasons{}
+		err := tx.Preload("Episode").Where("id = ?", id).First(&season).Error
+		if err != nil {
+			return err
+		}
+		return deleteSeason(tx, &season)
+	})
+}
+
+//touchSeason locks series of season and marks it updated, see touchSeries
+func touchSeason(tx *gorm.DB, seasonID uint, version time.Time) error {
+	season := Seasons{}
+	if err := tx.Where("id = ?", seasonID).First(&season).Error; err != nil {
+		return err
+	}
+	if season.MediaID == nil {
+		return ErrNotFound
+	}
+	return touchSeries(tx, *season.MediaID, version)
+}
+
+//touchSeries locks series and sets its UpdatedAt so changes of seasons and episodes change version and ETag of series,
+//non zero version must equal UpdatedAt of stored series
+func touchSeries(tx *gorm.DB, id uint, version time.Time) error {
+	series := Media{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&series).Error
+	if err != nil {
+		return err
+	}
+	if !version.IsZero() && !series.UpdatedAt.Equal(version) {
+		return ErrModified
+	}
+	return tx.Model(&Media{}).Where("id = ?", id).UpdateColumn("updated_at", time.Now()).Error
+}
+
+//deleteSeason deletes season, its episodes and their media in transaction
+func deleteSeason(tx *gorm.DB, season *Seasons) error {
+	for _, episode := range season.Episode {
+		if err := deleteEpisode(tx, episode); err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&Seasons{Model: gorm.Model{ID: season.ID}}).Error
+}
+
+//FindEpisode finds episode with media given season id and episode number
+func (p *postgresStore) FindEpisode(seasonID uint, number string) (Episodes, error) {
+	result := Episodes{}
+	err := p.DB.Preload("Media").Where("seasons_id = ? AND episode = ?", seasonID, number).First(&result).Error
+	return result, err
+}
+
+//CreateEpisode creates episode with media, non zero version must equal UpdatedAt of stored series
+func (p *postgresStore) CreateEpisode(episode *Episodes, version time.Time) error {
+	if episode.SeasonsID == nil {
+		return ErrNotFound
+	}
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := touchSeason(tx, *episode.SeasonsID, version); err != nil {
+			return err
+		}
+		if episode.Media != nil {
+			clearCredits(episode.Media)
+		}
+		if err := tx.Create(episode).Error; err != nil {
+			return err
+		}
+		if episode.Media == nil {
+			return nil
+		}
+		return syncCredits(tx, episode.Media)
+	})
+}
+
+//UpdateEpisode updates columns of episode and its media, non zero version must equal UpdatedAt of stored series
+func (p *postgresStore) UpdateEpisode(episode *Episodes, version time.Time) error {
+	if episode.SeasonsID == nil {
+		return ErrNotFound
+	}
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := touchSeason(tx, *episode.SeasonsID, version); err != nil {
+			return err
+		}
+		if episode.Media != nil {
+			err := tx.Set("gorm:save_associations", false).Save(episode.Media).Error
+			if err != nil {
+				return err
+			}
+			if err = syncCredits(tx, episode.Media); err != nil {
+				return err
+			}
+			episode.MediaID = &episode.Media.ID
+		}
+		return tx.Set("gorm:save_associations", false).Save(episode).Error
+	})
+}
+
+//DeleteEpisode deletes episode with media given id, non zero version must equal UpdatedAt of stored series
+func (p *postgresStore) DeleteEpisode(id uint, version time.Time) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		episode := Episodes{}
+		err := tx.Where("id = ?", id).First(&episode).Error
+		if err != nil {
+			return err
+		}
+		if episode.SeasonsID == nil {
+			return ErrNotFound
+		}
+		if err = touchSeason(tx, *episode.SeasonsID, version); err != nil {
+			return err
+		}
+		return deleteEpisode(tx, &episode)
+	})
+}
+
+//deleteEpisode deletes episode and its media in transaction
+func deleteEpisode(tx *gorm.DB, episode *Episodes) error {
+	if episode.MediaID != nil {
+		if err := deleteCredits(tx, *episode.MediaID); err != nil {
+			return err
+		}
+		if err := deleteFavorites(tx, *episode.MediaID); err != nil {
+			return err
+		}
+		err := tx.Delete(&Media{Model: gorm.Model{ID: *episode.MediaID}}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&Episodes{Model: gorm.Model{ID: episode.ID}}).Error
+}
+
+//FindPerson finds person given id
+func (p *postgresStore) FindPerson(id uint) (Person, error) {
+	result := Person{}
+	err := p.DB.Where("id = ?", id).First(&result).Error
+	return result, err
+}
+
+//FindCredits finds credits with media of person, returns page and total count
+func (p *postgresStore) FindCredits(personID uint, page Page) ([]Credit, int, error) {
+	result := []Credit{}
+	query := p.DB.Model(&Credit{}).Joins("JOIN media ON media.id = credits.media_id").Where("media.deleted_at IS NULL").Where("credits.person_id = ?", personID)
+	total := 0
+	err := query.Count(&total).Error
+	if err != nil {
+		return result, 0, err
+	}
+	err = query.Preload("Media").Select("credits.*").Order("credits.media_id").Order("credits.id").Offset(page.Offset).Limit(page.Size).Find(&result).Error
+	return result, total, err
+}
+
+//FindGenre finds genre given slug
+func (p *postgresStore) FindGenre(slug string) (Genre, error) {
+	result := Genre{}
+	err := p.DB.Where("slug = ?", slug).First(&result).Error
+	return result, err
+}
+
+//FindGenreMedia finds media of genre, returns page and total count
+func (p *postgresStore) FindGenreMedia(genreID uint, page Page) ([]Media, int, error) {
+	result := []Media{}
+	query := p.DB.Model(&Media{}).Joins("JOIN media_genres ON media_genres.media_id = media.id").Where("media_genres.genre_id = ?", genreID)
+	total := 0
+	err := query.Count(&total).Error
+	if err != nil {
+		return result, 0, err
+	}
+	err = query.Select("media.*").Order("media.id").Offset(page.Offset).Limit(page.Size).Find(&result).Error
+	return result, total, err
+}
+
+//syncCredits replaces credits and genres of media with names of its director, writer, stars and genre fields
+func syncCredits(tx *gorm.DB, media *Media) error {
+	if err := deleteCredits(tx, media.ID); err != nil {
+		return err
+	}
+	media.Credits, media.Genres = nil, nil
+	for _, name := range mediaCredits(media) {
+		person := Person{}
+		if err := tx.Where(Person{Name: name.Name}).FirstOrCreate(&person).Error; err != nil {
+			return err
+		}
+		credit := Credit{MediaID: &media.ID, PersonID: &person.ID, Role: name.Role, Position: name.Position}
+		if err := tx.Create(&credit).Error; err != nil {
+			return err
+		}
+		credit.Person = &person
+		media.Credits = append(media.Credits, &credit)
+	}
+	for i, genre := range mediaGenres(media) {
+		genre := genre
+		if err := tx.Where(Genre{Slug: genre.Slug}).Attrs(Genre{Name: genre.Name}).FirstOrCreate(&genre).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&MediaGenre{MediaID: media.ID, GenreID: genre.ID, Position: i}).Error; err != nil {
+			return err
+		}
+		media.Genres = append(media.Genres, &genre)
+	}
+	return nil
+}
+
+//deleteCredits deletes credits and genre links of media
+func deleteCredits(tx *gorm.DB, mediaID uint) error {
+	if err := tx.Unscoped().Where("media_id = ?", mediaID).Delete(&Credit{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("media_id = ?", mediaID).Delete(&MediaGenre{}).Error
+}
+
+//backfillCredits creates credits and genres of media stored before they were normalized, returns count of migrated media
+func backfillCredits(tx *gorm.DB) (int, error) {
+	rows := []Media{}
+	err := tx.Where("director <> '' OR writer <> '' OR stars <> '' OR genre <> ''").
+		Where("NOT EXISTS (SELECT 1 FROM credits WHERE credits.media_id = media.id)").
+		Where("NOT EXISTS (SELECT 1 FROM media_genres WHERE media_genres.media_id = media.id)").Find(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+	for i := range rows {
+		if err = syncCredits(tx, &rows[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(rows), nil
+}
+
+//backfillFields parses typed duration, rating and years of media stored before they were added, returns count of migrated media
+func backfillFields(tx *gorm.DB) (int, error) {
+	rows := []Media{}
+	err := tx.Where("(duration ~ '^[0-9]' AND duration_minutes IS NULL) OR (rating ~ '^[0-9]' AND rating_value IS NULL) OR (year ~ '^[0-9]{4}' AND year_from IS NULL)").Find(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+	for i := range rows {
+		previous := rows[i]
+		normalizeMedia(&rows[i], &previous)
+		err = tx.Model(&rows[i]).UpdateColumns(map[string]interface{}{
+			"duration_minutes": rows[i].DurationMinutes,
+			"rating_value":     rows[i].RatingValue,
+			"year_from":        rows[i].YearFrom,
+			"year_to":          rows[i].YearTo,
+		}).Error
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(rows), nil
+}
+
+//orderByID orders preloaded rows of table by id
+func orderByID(table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(table + ".id")
+	}
+}
+
+//SearchMedia searches medias of given types with full text search, results are ordered by rank
+func (p *postgresStore) SearchMedia(text string, mediaTypes []MediaType, page Page) ([]SearchResult, int, error) {
+	score := "ts_rank(" + searchDocument + ", websearch_to_tsquery('english', ?))"
+	match := "(" + searchDocument + ") @@ websearch_to_tsquery('english', ?)"
+	scoreArgs := []interface{}{text}
+	matchArgs := []interface{}{text}
+	if p.trigrams {
+		score += " + word_similarity(?, media.title)"
+		match = "(" + match + " OR ? <% media.title)"
+		scoreArgs = append(scoreArgs, text)
+		matchArgs = append(matchArgs, text)
+	}
+	query := p.DB.Table("media").Where("media.deleted_at IS NULL").Where("media.type IN (?)", mediaTypes).Where(match, matchArgs...)
+
+	total := 0
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	rows := []searchRow{}
+	highlights, highlightArgs := searchHighlights(text)
+	selectArgs := append(append([]interface{}{}, scoreArgs...), highlightArgs...)
+	err = query.Select("media.*, "+score+" AS score, "+highlights+" AS highlights", selectArgs...).
+		Order("score DESC").Order("media.id").Offset(page.Offset).Limit(page.Size).Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	result := make([]SearchResult, 0, len(rows))
+	for _, row := range rows {
+		fields := map[string]string{}
+		if err = json.Unmarshal([]byte(row.Highlights), &fields); err != nil {
+			return nil, 0, err
+		}
+		highlights := map[string]string{}
+		for name, value := range fields {
+			if strings.Contains(value, matchStart) {
+				highlights[name] = escapeHighlight(value)
+			}
+		}
+		result = append(result, SearchResult{Media: row.Media, Score: row.Score, Highlights: highlights})
+	}
+	return result, total, nil
+}
+
+//searchHighlights returns select of JSON object with ts_headline of each of searchFields and its arguments,
+//matches are delimited by matchStart and matchStop so values can be HTML escaped afterwards
+func searchHighlights(text string) (string, []interface{}) {
+	fields := []string{}
+	args := []interface{}{}
+	for _, field := range searchFields {
+		options := `StartSel="` + matchStart + `", StopSel="` + matchStop + `", HighlightAll=true`
+		if field.long {
+			options = `StartSel="` + matchStart + `", StopSel="` + matchStop + `", MaxFragments=2`
+		}
+		fields = append(fields, "'"+field.name+"', ts_headline('english', translate(coalesce(media."+field.name+", ''), ?, ''), websearch_to_tsquery('english', ?), ?)")
+		args = append(args, matchStart+matchStop, text, options)
+	}
+	return "json_build_object(" + strings.Join(fields, ", ") + ")", args
+}
+
+//CreateFavorite creates favorite media for user, returns ErrNotFound for unknown media and ErrFavoriteExists for duplicates
+func (p *postgresStore) CreateFavorite(favorite *UserMedia) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		count := 0
+		err := tx.Model(&Media{}).Where("id = ?", favorite.MediaID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		err = tx.Model(&UserMedia{}).Where("user_id = ? AND media_id = ?", favorite.UserID, favorite.MediaID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrFavoriteExists
+		}
+		err = tx.Create(favorite).Error
+		//concurrent requests both pass the count, the unique index rejects the later one
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+			return ErrFavoriteExists
+		}
+		return err
+	})
+}
+
+//FindFavorite finds favorite given id
+func (p *postgresStore) FindFavorite(id uint) (UserMedia, error) {
+	result := UserMedia{}
+	err := p.DB.Where("id = ?", id).First(&result).Error
+	return result, err
+}
+
+//DeleteFavorite deletes favorite given id
+func (p *postgresStore) DeleteFavorite(id uint) error {
+	return p.DB.Delete(&UserMedia{Model: gorm.Model{ID: id}}).Error
+}
+
+//FindFavorites finds favorites with media for given user and filters, returns page and total count
+func (p *postgresStore) FindFavorites(userID uint, filter MediaFilter, order Sort, page Page) ([]UserMedia, int, error) {
+	result := []UserMedia{}
+	query := p.DB.Preload("Media").Select("user_media.*").Joins("JOIN media ON media.id = user_media.media_id").Where("media.deleted_at IS NULL").Where("user_media.user_id = ?", userID)
+	query = applyFilter(query, "media", filter)
+	total := 0
+	err := query.Model(&UserMedia{}).Count(&total).Error
+	if err != nil {
+		return result, 0, err
+	}
+	err = applySort(query, "media", order).Order("user_media.id").Offset(page.Offset).Limit(page.Size).Find(&result).Error
+	return result, total, err
+}
+
+//CreateUser creates user, unique email violation returns ErrEmailExists
+func (p *postgresStore) CreateUser(user *User) error {
+	err := p.DB.Create(user).Error
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+		return ErrEmailExists
+	}
+	return err
+}
+
+//FindUserByEmail finds user given email
+func (p *postgresStore) FindUserByEmail(email string) (User, error) {
+	result := User{}
+	err := p.DB.Where("email = ?", email).First(&result).Error
+	return result, err
+}
+
+//FindUserByID finds user given id
+func (p *postgresStore) FindUserByID(id uint) (User, error) {
+	result := User{}
+	err := p.DB.Where("id = ?", id).First(&result).Error
+	return result, err
+}
+
+//FindUsers finds users, returns page and total count
+func (p *postgresStore) FindUsers(page Page) ([]User, int, error) {
+	result := []User{}
+	total := 0
+	err := p.DB.Model(&User{}).Count(&total).Error
+	if err != nil {
+		return result, 0, err
+	}
+	err = p.DB.Order("id").Offset(page.Offset).Limit(page.Size).Find(&result).Error
+	return result, total, err
+}
+
+//UpdateUser updates name, role and deactivation of user
+func (p *postgresStore) UpdateUser(user *User) error {
+	return p.DB.Model(user).Updates(map[string]interface{}{
+		"name":           user.Name,
+		"role":           user.Role,
+		"deactivated_at": user.DeactivatedAt,
+	}).Error
+}
+
+//UpdateUserPassword updates password hash of user
+func (p *postgresStore) UpdateUserPassword(id uint, hash string) error {
+	query := p.DB.Model(&User{}).Where("id = ?", id).Update("password", hash)
+	if query.Error == nil && query.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return query.Error
+}
+
+//CreatePasswordReset creates password reset
+func (p *postgresStore) CreatePasswordReset(reset *PasswordReset) error {
+	return p.DB.Create(reset).Error
+}
+
+//UsePasswordReset marks unused and unexpired password reset as used
+func (p *postgresStore) UsePasswordReset(tokenHash string) (PasswordReset, error) {
+	result := PasswordReset{}
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		query := tx.Model(&PasswordReset{}).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).Update("used_at", now)
+		if query.Error != nil {
+			return query.Error
+		}
+		if query.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("token_hash = ?", tokenHash).First(&result).Error
+	})
+	return result, err
+}
+
+//CreateRefreshToken creates refresh token
+func (p *postgresStore) CreateRefreshToken(token *RefreshToken) error {
+	return p.DB.Create(token).Error
+}
+
+//RotateRefreshToken marks active refresh token as rotated, returns false when token was already rotated or revoked
+func (p *postgresStore) RotateRefreshToken(jti string) (RefreshToken, bool, error) {
+	result := RefreshToken{}
+	rotated := false
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		query := tx.Model(&RefreshToken{}).Where("jti = ? AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > ?", jti, now).Update("rotated_at", now)
+		if query.Error != nil {
+			return query.Error
+		}
+		rotated = query.RowsAffected == 1
+		return tx.Where("jti = ?", jti).First(&result).Error
+	})
+	return result, rotated, err
+}
+
+//RevokeToken adds key to denylist until expiry, expired keys are removed. Revoking a key twice is a no-op
+func (p *postgresStore) RevokeToken(key string, expiresAt time.Time) error {
+	now := time.Now()
+	err := p.DB.Unscoped().Where("expires_at < ?", now).Delete(&RevokedToken{}).Error
+	if err != nil {
+		return err
+	}
+	return p.DB.Exec(
+		"INSERT INTO revoked_tokens (created_at, updated_at, key, expires_at) VALUES (?, ?, ?, ?) ON CONFLICT (key) DO NOTHING",
+		now, now, key, expiresAt,
+	).Error
+}
+
+//RevokeFamily revokes refresh tokens of family and adds family to denylist
+func (p *postgresStore) RevokeFamily(familyID string, expiresAt time.Time) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return (&postgresStore{DB: tx}).RevokeToken(familyID, expiresAt)
+	})
+}
+
+//RevokeUserFamilies revokes refresh tokens of user and adds their unexpired families to denylist
+func (p *postgresStore) RevokeUserFamilies(userID uint, expiresAt time.Time) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		families := []string{}
+		err := tx.Model(&RefreshToken{}).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Pluck("DISTINCT family_id", &families).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		for _, familyID := range families {
+			if err = (&postgresStore{DB: tx}).RevokeToken(familyID, expiresAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//IsRevoked checks any of keys is in denylist
+func (p *postgresStore) IsRevoked(keys ...string) (bool, error) {
+	count := 0
+	err := p.DB.Model(&RevokedToken{}).Where("key IN (?) AND expires_at > ?", keys, time.Now()).Count(&count).Error
+	return count > 0, err
+}
+
+//Close closes database connection
+func (p *postgresStore) Close() error {
+	return p.DB.Close()
+}
+
+//applyFilter adds media filter conditions for given media table to query
+func applyFilter(query *gorm.DB, table string, filter MediaFilter) *gorm.DB {
+	columns := []struct {
+		name  string
+		value string
+	}{
+		{"title", filter.Title},
+		{"audio", filter.Audio},
+		{"subtitles", filter.Subtitle},
+	}
+	for _, column := range columns {
+		if column.value != "" {
+			query = query.Where(table+"."+column.name+" ILIKE ?", likePattern(column.value))
+		}
+	}
+	credits := []struct {
+		role CreditRole
+		name string
+	}{
+		{CreditDirector, filter.Director},
+		{CreditWriter, filter.Writer},
+		{CreditStar, filter.Star},
+	}
+	for _, credit := range credits {
+		if credit.name != "" {
+			query = query.Where("EXISTS (SELECT 1 FROM credits JOIN people ON people.id = credits.person_id "+
+				"WHERE credits.media_id = "+table+".id AND credits.role = ? AND people.name ILIKE ?)", credit.role, likePattern(credit.name))
+		}
+	}
+	if len(filter.Genres) > 0 {
+		slugs := filter.genreSlugs()
+		genres := "SELECT count(*) FROM media_genres JOIN genres ON genres.id = media_genres.genre_id " +
+			"WHERE media_genres.media_id = " + table + ".id AND genres.slug IN (?)"
+		if filter.MatchAllGenres && len(slugs) > 0 {
+			query = query.Where("("+genres+") = ?", slugs, len(slugs))
+		} else {
+			query = query.Where("("+genres+") > 0", slugs)
+		}
+	}
+	if filter.YearFrom > 0 {
+		query = query.Where(table+".year_from IS NOT NULL").
+			Where("(coalesce("+table+".year_to, "+table+".year_from) >= ? OR ("+table+".year_to IS NULL AND "+table+".type = ?))", filter.YearFrom, Series)
+	}
+	if filter.YearTo > 0 {
+		query = query.Where(table+".year_from <= ?", filter.YearTo)
+	}
+	if filter.MinRating > 0 {
+		query = query.Where(table+".rating_value >= ?", filter.MinRating)
+	}
+	if filter.MinDuration > 0 {
+		query = query.Where(table+".duration_minutes >= ?", filter.MinDuration)
+	}
+	if filter.MaxDuration > 0 {
+		query = query.Where(table+".duration_minutes <= ?", filter.MaxDuration)
+	}
+	return query
+}
+
+//applySort adds order of sort fields for given media table to query, missing values are last
+func applySort(query *gorm.DB, table string, order Sort) *gorm.DB {
+	for _, field := range order {
+		column := table + "." + SortFields[field.Field]
+		if field.Field == "title" {
+			column = "lower(" + column + ")"
+		}
+		direction := " ASC"
+		if field.Desc {
+			direction = " DESC"
+		}
+		query = query.Order(column + direction + " NULLS LAST")
+	}
+	return query
+}
@@ -0,0 +1,213 @@
+package data
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+//SearchResult definition, highlights has matched fields with marked terms
+type SearchResult struct {
+	Media      Media             `json:"media"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+//SearchList definition for paginated search response
+type SearchList struct {
+	Items    []SearchResult `json:"items"`
+	Total    int            `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+	Next     string         `json:"next,omitempty"`
+	Prev     string         `json:"prev,omitempty"`
+}
+
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+	//matchStart and matchStop delimit matches until highlights are HTML escaped, private use characters are removed from values first
+	matchStart   = "\uE000"
+	matchStop    = "\uE001"
+	snippetWords = 8
+)
+
+//searchField definition, weight is used by fallback scorer, long fields are highlighted as fragments by postgres store
+type searchField struct {
+	name   string
+	weight float64
+	long   bool
+	value  func(media Media) string
+}
+
+//searchFields are searched and highlighted fields of media with weights, names are columns of media table
+var searchFields = []searchField{
+	{"title", 4, false, func(media Media) string { return media.Title }},
+	{"stars", 2, false, func(media Media) string { return media.Stars }},
+	{"director", 2, false, func(media Media) string { return media.Director }},
+	{"writer", 2, false, func(media Media) string { return media.Writer }},
+	{"genre", 1.5, false, func(media Media) string { return media.Genre }},
+	{"description", 1, true, func(media Media) string { return media.Description }},
+}
+
+//escapeHighlight HTML escapes value with matches delimited by matchStart and matchStop and marks the matches with highlight tags
+func escapeHighlight(value string) string {
+	return strings.NewReplacer(matchStart, highlightStart, matchStop, highlightStop).Replace(html.EscapeString(value))
+}
+
+//stripMatches removes match delimiters from value so stored texts cannot add highlight tags
+func stripMatches(value string) string {
+	return strings.NewReplacer(matchStart, "", matchStop, "").Replace(value)
+}
+
+//ParseMediaType parses media type name like movie, series or episode
+func ParseMediaType(name string) (MediaType, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "movie":
+		return Movie, true
+	case "series":
+		return Series, true
+	case "episode":
+		return Episode, true
+	}
+	return 0, false
+}
+
+//String returns name of media type
+func (t MediaType) String() string {
+	switch t {
+	case Movie:
+		return "movie"
+	case Series:
+		return "series"
+	case Episode:
+		return "episode"
+	}
+	return ""
+}
+
+//searchTerms splits text into lowercase words
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+//scoreMedia scores media for terms, every term must match one of fields exactly, by prefix or with a typo
+func scoreMedia(media Media, terms []string) (float64, map[string]string) {
+	score := 0.0
+	highlights := map[string]string{}
+	for _, term := range terms {
+		best := 0.0
+		for _, field := range searchFields {
+			for _, word := range searchTerms(field.value(media)) {
+				if match := matchTerm(word, term) * field.weight; match > best {
+					best = match
+				}
+			}
+		}
+		if best == 0 {
+			return 0, nil
+		}
+		score += best
+	}
+	for _, field := range searchFields {
+		if snippet, ok := highlight(field.value(media), terms); ok {
+			highlights[field.name] = snippet
+		}
+	}
+	return score, highlights
+}
+
+//matchTerm returns 1 for exact, 0.8 for prefix and 0.5 for typo matches of word
+func matchTerm(word, term string) float64 {
+	switch {
+	case word == term:
+		return 1
+	case len(term) >= 3 && strings.HasPrefix(word, term):
+		return 0.8
+	case len(term) >= 4 && levenshtein(word, term) <= maxTypos(term):
+		return 0.5
+	}
+	return 0
+}
+
+//maxTypos returns allowed edit distance for term length
+func maxTypos(term string) int {
+	if len([]rune(term)) >= 8 {
+		return 2
+	}
+	return 1
+}
+
+//highlight marks matched words of HTML escaped value, long values are cut around first match
+func highlight(value string, terms []string) (string, bool) {
+	words := strings.Fields(stripMatches(value))
+	first := -1
+	for i, word := range words {
+		for _, part := range searchTerms(word) {
+			matched := false
+			for _, term := range terms {
+				if matchTerm(part, term) > 0 {
+					matched = true
+					break
+				}
+			}
+			if matched {
+				words[i] = matchStart + word + matchStop
+				if first < 0 {
+					first = i
+				}
+				break
+			}
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+	start, end := first-snippetWords, first+snippetWords*2
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "... "
+	} else {
+		start = 0
+	}
+	if end < len(words) {
+		suffix = " ..."
+	} else {
+		end = len(words)
+	}
+	return escapeHighlight(prefix + strings.Join(words[start:end], " ") + suffix), true
+}
+
+//levenshtein returns edit distance of two words
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
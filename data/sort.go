@@ -0,0 +1,152 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	types "scaleflixapi/errors"
+)
+
+//SortField definition, field is one of SortFields
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+//Sort definition, fields are applied in order and id is always the last tie-breaker
+type Sort []SortField
+
+//SortFields allowed sort fields mapped to media columns
+var SortFields = map[string]string{
+	"id":          "id",
+	"title":       "title",
+	"year":        "year_from",
+	"rating":      "rating_value",
+	"duration":    "duration_minutes",
+	"releasedate": "release_date",
+	"createdAt":   "created_at",
+	"updatedAt":   "updated_at",
+}
+
+//ParseSort parses comma separated sort fields, fields starting with - are sorted descending, unknown fields return validation error with field and allowed members
+func ParseSort(value string) (Sort, error) {
+	result := Sort{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		sortField := SortField{Field: strings.TrimPrefix(field, "+")}
+		if strings.HasPrefix(field, "-") {
+			sortField = SortField{Field: field[1:], Desc: true}
+		}
+		if _, ok := SortFields[sortField.Field]; !ok {
+			allowed := make([]string, 0, len(SortFields))
+			for name := range SortFields {
+				allowed = append(allowed, name)
+			}
+			sort.Strings(allowed)
+			return nil, types.NewValidation(types.CodeInvalidSort, fmt.Sprintf(types.InvalidSortField, sortField.Field)).With("field", sortField.Field).With("allowed", allowed)
+		}
+		result = append(result, sortField)
+	}
+	return result, nil
+}
+
+//Less compares two medias by sort fields and id
+func (s Sort) Less(a, b Media) bool {
+	if result := s.Compare(a, b); result != 0 {
+		return result < 0
+	}
+	return a.ID < b.ID
+}
+
+//Compare compares two medias by sort fields, values that can not be parsed are always last
+func (s Sort) Compare(a, b Media) int {
+	for _, field := range s {
+		result := compareField(field.Field, a, b)
+		switch {
+		case result == 0:
+			continue
+		case result == 2 || result == -2:
+			return result / 2
+		case field.Desc:
+			return -result
+		}
+		return result
+	}
+	return 0
+}
+
+//compareField compares field of medias, returns -1, 0, 1 or -2, 2 when one of values is missing
+func compareField(field string, a, b Media) int {
+	switch field {
+	case "title":
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	case "year":
+		return compareInts(a.YearFrom, b.YearFrom)
+	case "rating":
+		ratingA, ratingB := 0.0, 0.0
+		if a.RatingValue != nil {
+			ratingA = *a.RatingValue
+		}
+		if b.RatingValue != nil {
+			ratingB = *b.RatingValue
+		}
+		return compareNumbers(ratingA, ratingB, a.RatingValue != nil, b.RatingValue != nil)
+	case "duration":
+		return compareInts(a.DurationMinutes, b.DurationMinutes)
+	case "releasedate":
+		releasedA, releasedB := int64(0), int64(0)
+		if a.ReleaseDate != nil {
+			releasedA = a.ReleaseDate.Unix()
+		}
+		if b.ReleaseDate != nil {
+			releasedB = b.ReleaseDate.Unix()
+		}
+		return compareNumbers(float64(releasedA), float64(releasedB), a.ReleaseDate != nil, b.ReleaseDate != nil)
+	case "createdAt":
+		return compareTimes(a.CreatedAt.UnixNano(), b.CreatedAt.UnixNano())
+	case "updatedAt":
+		return compareTimes(a.UpdatedAt.UnixNano(), b.UpdatedAt.UnixNano())
+	}
+	return compareNumbers(float64(a.ID), float64(b.ID), true, true)
+}
+
+func compareNumbers(a, b float64, okA, okB bool) int {
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return 2
+	case !okB:
+		return -2
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b *int) int {
+	valueA, valueB := 0, 0
+	if a != nil {
+		valueA = *a
+	}
+	if b != nil {
+		valueB = *b
+	}
+	return compareNumbers(float64(valueA), float64(valueB), a != nil, b != nil)
+}
+
+func compareTimes(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
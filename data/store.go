@@ -0,0 +1,104 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	types "scaleflixapi/errors"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+//ErrNotFound is returned by storage backends when record does not exist
+var ErrNotFound = gorm.ErrRecordNotFound
+
+//ErrModified is returned by storage backends when record is changed after given version
+var ErrModified = errors.New("record is modified")
+
+//notFound converts ErrNotFound of storage backends to not found error with key, other errors are kept
+func notFound(err error, key string) error {
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	result := types.NewNotFound(types.CodeNotFound, fmt.Sprintf(types.KeyNotFound, key))
+	result.Err = err
+	return result
+}
+
+//modified converts ErrModified of storage backends to precondition failed error with key, other errors are kept
+func modified(err error, key string) error {
+	if !errors.Is(err, ErrModified) {
+		return err
+	}
+	result := types.NewPrecondition(types.CodePreconditionFailed, fmt.Sprintf(types.PreconditionFailed, key))
+	result.Err = err
+	return result
+}
+
+//checkETag checks ifMatch header against ETag of media, returns UpdatedAt the store must still have
+func checkETag(media Media, ifMatch, key string) (time.Time, error) {
+	if !MatchETag(ifMatch, media.ETag(), false) {
+		return time.Time{}, types.NewPrecondition(types.CodePreconditionFailed, fmt.Sprintf(types.PreconditionFailed, key))
+	}
+	return media.UpdatedAt, nil
+}
+
+//parseID parses positive numeric id of records
+func parseID(key string) (uint, error) {
+	id, err := strconv.ParseUint(key, 10, 32)
+	if err != nil || id == 0 {
+		return 0, types.NewValidation(types.CodeKeyRequired, types.KeyRequired)
+	}
+	return uint(id), nil
+}
+
+//Store describes storage backend interface used by data manager
+type Store interface {
+	CreateMedia(media *Media) error
+	CreateUniqueMedia(media *Media) (bool, error)
+	FindMediaByImdbID(imdbID string) (Media, error)
+	FindMedia(mediaType MediaType, filter MediaFilter, order Sort, page Page) ([]Media, int, error)
+	FindMediaByID(mediaType MediaType, id uint) (Media, error)
+	UpdateMedia(media *Media, version time.Time) error
+	DeleteMedia(id uint, version time.Time) error
+	FindPerson(id uint) (Person, error)
+	FindCredits(personID uint, page Page) ([]Credit, int, error)
+	FindGenre(slug string) (Genre, error)
+	FindGenreMedia(genreID uint, page Page) ([]Media, int, error)
+	FindSeason(seriesID uint, number int) (Seasons, error)
+	CreateSeason(season *Seasons, version time.Time) error
+	UpdateSeason(season *Seasons, version time.Time) error
+	DeleteSeason(id uint, version time.Time) error
+	FindEpisode(seasonID uint, number string) (Episodes, error)
+	CreateEpisode(episode *Episodes, version time.Time) error
+	UpdateEpisode(episode *Episodes, version time.Time) error
+	DeleteEpisode(id uint, version time.Time) error
+	SearchMedia(text string, mediaTypes []MediaType, page Page) ([]SearchResult, int, error)
+	CreateFavorite(favorite *UserMedia) error
+	FindFavorite(id uint) (UserMedia, error)
+	DeleteFavorite(id uint) error
+	FindFavorites(userID uint, filter MediaFilter, order Sort, page Page) ([]UserMedia, int, error)
+	CreateUser(user *User) error
+	FindUserByEmail(email string) (User, error)
+	FindUserByID(id uint) (User, error)
+	FindUsers(page Page) ([]User, int, error)
+	UpdateUser(user *User) error
+	UpdateUserPassword(id uint, hash string) error
+	CreatePasswordReset(reset *PasswordReset) error
+	UsePasswordReset(tokenHash string) (PasswordReset, error)
+	CreateRefreshToken(token *RefreshToken) error
+	RotateRefreshToken(jti string) (RefreshToken, bool, error)
+	RevokeToken(key string, expiresAt time.Time) error
+	RevokeFamily(familyID string, expiresAt time.Time) error
+	RevokeUserFamilies(userID uint, expiresAt time.Time) error
+	IsRevoked(keys ...string) (bool, error)
+	Close() error
+}
+
+const (
+	//PostgresStore storage driver name
+	PostgresStore = "postgres"
+	//MemoryStore storage driver name
+	MemoryStore = "memory"
+)
@@ -0,0 +1,231 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"scaleflixapi/config"
+	types "scaleflixapi/errors"
+	"scaleflixapi/logger"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	//accessTokenType typ claim of access tokens
+	accessTokenType = "access"
+	//refreshTokenType typ claim of refresh tokens
+	refreshTokenType = "refresh"
+)
+
+//RefreshToken definition, tokens rotated from the same login share a family
+type RefreshToken struct {
+	gorm.Model
+	JTI       string `gorm:"unique"`
+	FamilyID  string `gorm:"index"`
+	UserID    *uint  `gorm:"not null"`
+	ExpiresAt time.Time
+	RotatedAt *time.Time
+	RevokedAt *time.Time
+}
+
+//RevokedToken definition for denylist, key is jti of a token or id of a revoked family
+type RevokedToken struct {
+	gorm.Model
+	Key       string `gorm:"unique"`
+	ExpiresAt time.Time
+}
+
+//RefreshRequest definition
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+//TokenClaims definition of verified access token
+type TokenClaims struct {
+	UserID    uint
+	Email     string
+	Role      string
+	JTI       string
+	FamilyID  string
+	ExpiresAt time.Time
+}
+
+//accessTokenTTL returns lifetime of access tokens from config
+func accessTokenTTL() time.Duration {
+	return durationConfig(config.AccessTokenTTL, 30*time.Minute)
+}
+
+//refreshTokenTTL returns lifetime of refresh tokens from config
+func refreshTokenTTL() time.Duration {
+	return durationConfig(config.RefreshTokenTTL, 30*24*time.Hour)
+}
+
+func durationConfig(value string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
+//issueTokens creates access and refresh token pair of user in given family
+func (d *Data) issueTokens(user User, familyID string) (Token, error) {
+	now := time.Now()
+	accessExpiresAt := now.Add(accessTokenTTL())
+	accessToken, err := d.Keys.Sign(jwt.MapClaims{
+		"authorized": true,
+		"typ":        accessTokenType,
+		"jti":        newTokenID(),
+		"fam":        familyID,
+		"uid":        user.ID,
+		"email":      user.Email,
+		"role":       user.Role,
+		"exp":        accessExpiresAt.Unix(),
+	})
+	if err != nil {
+		return Token{}, err
+	}
+	refresh := RefreshToken{JTI: newTokenID(), FamilyID: familyID, UserID: &user.ID, ExpiresAt: now.Add(refreshTokenTTL())}
+	refreshToken, err := d.Keys.Sign(jwt.MapClaims{
+		"typ": refreshTokenType,
+		"jti": refresh.JTI,
+		"fam": familyID,
+		"uid": user.ID,
+		"exp": refresh.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return Token{}, err
+	}
+	if err = d.Store.CreateRefreshToken(&refresh); err != nil {
+		return Token{}, err
+	}
+	return Token{
+		Role:         user.Role,
+		Email:        user.Email,
+		TokenString:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessExpiresAt.Sub(now).Seconds()),
+	}, nil
+}
+
+//RefreshTokens rotates refresh token and issues new token pair, reuse of a rotated token revokes its family
+func (d *Data) RefreshTokens(body []byte) (Token, error) {
+	var request RefreshRequest
+	err := json.Unmarshal(body, &request)
+	if err != nil {
+		logger.Error.Println(err)
+		return Token{}, types.NewUnauthorized(types.CodeInvalidRefreshToken, types.InvalidRefreshToken)
+	}
+	claims, err := d.Keys.Parse(request.RefreshToken)
+	if err != nil || claims["typ"] != refreshTokenType {
+		return Token{}, types.NewUnauthorized(types.CodeInvalidRefreshToken, types.InvalidRefreshToken)
+	}
+	jti, _ := claims["jti"].(string)
+	familyID, _ := claims["fam"].(string)
+	if revoked, err := d.Store.IsRevoked(jti, familyID); err != nil || revoked {
+		return Token{}, types.NewUnauthorized(types.CodeInvalidRefreshToken, types.InvalidRefreshToken)
+	}
+	refresh, rotated, err := d.Store.RotateRefreshToken(jti)
+	if err != nil {
+		logger.Error.Println(err)
+		return Token{}, types.NewUnauthorized(types.CodeInvalidRefreshToken, types.InvalidRefreshToken)
+	}
+	if !rotated {
+		logger.Error.Printf("refresh token %s is reused, revoking family %s", jti, refresh.FamilyID)
+		if err = d.Store.RevokeFamily(refresh.FamilyID, time.Now().Add(refreshTokenTTL())); err != nil {
+			logger.Error.Println(err)
+		}
+		return Token{}, types.NewUnauthorized(types.CodeRefreshTokenReused, types.RefreshTokenReused)
+	}
+	user, err := d.Store.FindUserByID(*refresh.UserID)
+	if err != nil {
+		return Token{}, types.NewUnauthorized(types.CodeInvalidRefreshToken, types.InvalidRefreshToken)
+	}
+	if user.DeactivatedAt != nil {
+		return Token{}, types.NewUnauthorized(types.CodeUserDeactivated, types.UserDeactivated)
+	}
+	return d.issueTokens(user, refresh.FamilyID)
+}
+
+//Logout revokes access token and its token family
+func (d *Data) Logout(claims TokenClaims) error {
+	err := d.Store.RevokeToken(claims.JTI, claims.ExpiresAt)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if claims.FamilyID == "" {
+		return nil
+	}
+	err = d.Store.RevokeFamily(claims.FamilyID, time.Now().Add(refreshTokenTTL()))
+	if err != nil {
+		logger.Error.Println(err)
+	}
+	return err
+}
+
+//VerifyToken verifies signature, expiry and revocation of access token, user of token must be active and still have role of token
+func (d *Data) VerifyToken(tokenString string) (TokenClaims, error) {
+	claims, err := d.Keys.Parse(tokenString)
+	if err != nil {
+		return TokenClaims{}, types.NewUnauthorized(types.CodeInvalidToken, types.TokenExpired)
+	}
+	result := TokenClaims{}
+	result.Email, _ = claims["email"].(string)
+	result.Role, _ = claims["role"].(string)
+	result.JTI, _ = claims["jti"].(string)
+	result.FamilyID, _ = claims["fam"].(string)
+	//tokens without jti can not be revoked, so only access tokens with jti are accepted
+	if claims["typ"] != accessTokenType || result.JTI == "" {
+		return TokenClaims{}, types.NewUnauthorized(types.CodeInvalidToken, types.TokenParseError)
+	}
+	if userID, ok := claims["uid"].(float64); ok && userID > 0 {
+		result.UserID = uint(userID)
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		result.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	revoked, err := d.Store.IsRevoked(result.JTI, result.FamilyID)
+	if err != nil {
+		logger.Error.Println(err)
+		return TokenClaims{}, err
+	}
+	if revoked {
+		return TokenClaims{}, types.NewUnauthorized(types.CodeTokenRevoked, types.TokenRevoked)
+	}
+	if result.UserID != 0 {
+		user, err := d.Store.FindUserByID(result.UserID)
+		if errors.Is(err, ErrNotFound) {
+			return TokenClaims{}, types.NewUnauthorized(types.CodeInvalidToken, types.TokenParseError)
+		}
+		if err != nil {
+			logger.Error.Println(err)
+			return TokenClaims{}, err
+		}
+		if user.DeactivatedAt != nil {
+			return TokenClaims{}, types.NewUnauthorized(types.CodeUserDeactivated, types.UserDeactivated)
+		}
+		if user.Role != result.Role {
+			return TokenClaims{}, types.NewUnauthorized(types.CodeTokenRevoked, types.TokenRevoked)
+		}
+	}
+	return result, nil
+}
+
+//JWKS returns public keys verifying tokens
+func (d *Data) JWKS() JWKSet {
+	return d.Keys.JWKS()
+}
+
+//newTokenID creates random token id
+func newTokenID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		logger.Error.Println(err)
+	}
+	return hex.EncodeToString(buf)
+}
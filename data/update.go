@@ -0,0 +1,286 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	types "scaleflixapi/errors"
+	"scaleflixapi/logger"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+//UpdateMedia replaces or merge patches fields of movie or series given id, seasons are not changed, non empty ifMatch must match ETag of media
+func (d *Data) UpdateMedia(mediaType MediaType, id string, body []byte, merge bool, ifMatch string) (Media, error) {
+	current, err := d.findMedia(mediaType, id)
+	if err != nil {
+		return Media{}, err
+	}
+	var version time.Time
+	if ifMatch != "" {
+		if version, err = checkETag(current, ifMatch, id); err != nil {
+			return Media{}, err
+		}
+	}
+	current.Seasons = nil
+	update := Media{}
+	if err = decodeUpdate(current, body, merge, &update); err != nil {
+		return Media{}, err
+	}
+	update.Seasons = nil
+	if err = validateMedia(&update, mediaType); err != nil {
+		return Media{}, err
+	}
+	normalizeMedia(&update, &current)
+	update.Model = current.Model
+	if err = d.Store.UpdateMedia(&update, version); err != nil {
+		logger.Error.Println(err)
+		return Media{}, modified(notFound(err, id), id)
+	}
+	return d.findMedia(mediaType, id)
+}
+
+//GetSeason gets season with episodes given series id and season number
+func (d *Data) GetSeason(seriesID, number string) (Seasons, error) {
+	series, err := d.findMedia(Series, seriesID)
+	if err != nil {
+		return Seasons{}, err
+	}
+	return d.findSeason(series, number)
+}
+
+//findSeason finds season with episodes of series given season number
+func (d *Data) findSeason(series Media, number string) (Seasons, error) {
+	season, err := parseNumber(number)
+	if err != nil {
+		return Seasons{}, err
+	}
+	result, err := d.Store.FindSeason(series.ID, season)
+	return result, notFound(err, number)
+}
+
+//findSeries finds series given id, non empty ifMatch must match ETag of series, returns UpdatedAt the store must still have
+func (d *Data) findSeries(seriesID, ifMatch string) (Media, time.Time, error) {
+	series, err := d.findMedia(Series, seriesID)
+	if err != nil || ifMatch == "" {
+		return series, time.Time{}, err
+	}
+	version, err := checkETag(series, ifMatch, seriesID)
+	return series, version, err
+}
+
+//SaveSeason creates season given number or replaces or merge patches its fields, episodes of body are created only with new seasons,
+//non empty ifMatch must match ETag of series
+func (d *Data) SaveSeason(seriesID, number string, body []byte, merge bool, ifMatch string) (Seasons, bool, error) {
+	series, version, err := d.findSeries(seriesID, ifMatch)
+	if err != nil {
+		return Seasons{}, false, err
+	}
+	seasonNumber, err := parseNumber(number)
+	if err != nil {
+		return Seasons{}, false, err
+	}
+	current, err := d.Store.FindSeason(series.ID, seasonNumber)
+	if errors.Is(err, ErrNotFound) && !merge {
+		season := Seasons{}
+		if err = decodeUpdate(nil, body, false, &season); err != nil {
+			return Seasons{}, false, err
+		}
+		season.Model, season.Season, season.MediaID, season.Media = gorm.Model{}, seasonNumber, &series.ID, nil
+		if err = validateSeason(&season); err != nil {
+			return Seasons{}, false, err
+		}
+		eachEpisodeMedia(&season, normalizeNew)
+		for _, episode := range season.Episode {
+			prepareEpisode(episode)
+		}
+		if err = d.Store.CreateSeason(&season, version); err != nil {
+			logger.Error.Println(err)
+			return Seasons{}, false, modified(notFound(err, seriesID), seriesID)
+		}
+		return season, true, nil
+	}
+	if err != nil {
+		return Seasons{}, false, notFound(err, number)
+	}
+	update := Seasons{}
+	if err = decodeUpdate(Seasons{Model: current.Model, Season: current.Season, TotalSeasons: current.TotalSeasons, MediaID: current.MediaID}, body, merge, &update); err != nil {
+		return Seasons{}, false, err
+	}
+	update.Model, update.Season, update.MediaID, update.Episode, update.Media = current.Model, seasonNumber, current.MediaID, nil, nil
+	if err = validateSeason(&update); err != nil {
+		return Seasons{}, false, err
+	}
+	if err = d.Store.UpdateSeason(&update, version); err != nil {
+		logger.Error.Println(err)
+		return Seasons{}, false, modified(notFound(err, number), seriesID)
+	}
+	result, err := d.Store.FindSeason(series.ID, seasonNumber)
+	return result, false, notFound(err, number)
+}
+
+//DeleteSeason deletes season with its episodes given series id and season number, non empty ifMatch must match ETag of series
+func (d *Data) DeleteSeason(seriesID, number, ifMatch string) error {
+	series, version, err := d.findSeries(seriesID, ifMatch)
+	if err != nil {
+		return err
+	}
+	season, err := d.findSeason(series, number)
+	if err != nil {
+		return err
+	}
+	return modified(notFound(d.Store.DeleteSeason(season.ID, version), number), seriesID)
+}
+
+//GetEpisode gets episode with content given series id, season number and episode number
+func (d *Data) GetEpisode(seriesID, seasonNumber, number string) (Episodes, error) {
+	season, err := d.GetSeason(seriesID, seasonNumber)
+	if err != nil {
+		return Episodes{}, err
+	}
+	result, err := d.Store.FindEpisode(season.ID, strings.TrimSpace(number))
+	return result, notFound(err, number)
+}
+
+//SaveEpisode creates episode given number or replaces or merge patches episode and its content, non empty ifMatch must match ETag of series
+func (d *Data) SaveEpisode(seriesID, seasonNumber, number string, body []byte, merge bool, ifMatch string) (Episodes, bool, error) {
+	series, version, err := d.findSeries(seriesID, ifMatch)
+	if err != nil {
+		return Episodes{}, false, err
+	}
+	season, err := d.findSeason(series, seasonNumber)
+	if err != nil {
+		return Episodes{}, false, err
+	}
+	number = strings.TrimSpace(number)
+	if number == "" {
+		return Episodes{}, false, types.NewValidation(types.CodeKeyRequired, types.KeyRequired)
+	}
+	current, err := d.Store.FindEpisode(season.ID, number)
+	if errors.Is(err, ErrNotFound) && !merge {
+		episode := Episodes{}
+		if err = decodeUpdate(nil, body, false, &episode); err != nil {
+			return Episodes{}, false, err
+		}
+		episode.Episode = number
+		if err = validateEpisode(&episode); err != nil {
+			return Episodes{}, false, err
+		}
+		normalizeMedia(episode.Media, nil)
+		prepareEpisode(&episode)
+		episode.SeasonsID = &season.ID
+		if err = d.Store.CreateEpisode(&episode, version); err != nil {
+			logger.Error.Println(err)
+			return Episodes{}, false, modified(notFound(err, seasonNumber), seriesID)
+		}
+		return episode, true, nil
+	}
+	if err != nil {
+		return Episodes{}, false, notFound(err, number)
+	}
+	update := Episodes{}
+	current.Seasons = nil
+	if err = decodeUpdate(current, body, merge, &update); err != nil {
+		return Episodes{}, false, err
+	}
+	update.Episode = number
+	if err = validateEpisode(&update); err != nil {
+		return Episodes{}, false, err
+	}
+	normalizeMedia(update.Media, current.Media)
+	update.Model, update.SeasonsID, update.MediaID, update.Seasons = current.Model, current.SeasonsID, current.MediaID, nil
+	update.Media.Model = gorm.Model{}
+	if current.Media != nil {
+		update.Media.Model = current.Media.Model
+	}
+	if err = d.Store.UpdateEpisode(&update, version); err != nil {
+		logger.Error.Println(err)
+		return Episodes{}, false, modified(notFound(err, number), seriesID)
+	}
+	result, err := d.Store.FindEpisode(season.ID, number)
+	return result, false, notFound(err, number)
+}
+
+//DeleteEpisode deletes episode with its content given series id, season number and episode number, non empty ifMatch must match ETag of series
+func (d *Data) DeleteEpisode(seriesID, seasonNumber, number, ifMatch string) error {
+	series, version, err := d.findSeries(seriesID, ifMatch)
+	if err != nil {
+		return err
+	}
+	season, err := d.findSeason(series, seasonNumber)
+	if err != nil {
+		return err
+	}
+	episode, err := d.Store.FindEpisode(season.ID, strings.TrimSpace(number))
+	if err != nil {
+		return notFound(err, number)
+	}
+	return modified(notFound(d.Store.DeleteEpisode(episode.ID, version), number), seriesID)
+}
+
+//prepareEpisode resets ids of new validated episode and its content
+func prepareEpisode(episode *Episodes) {
+	episode.Model, episode.Episode, episode.MediaID, episode.SeasonsID, episode.Seasons = gorm.Model{}, strings.TrimSpace(episode.Episode), nil, nil, nil
+	episode.Media.Model = gorm.Model{}
+}
+
+//parseNumber parses positive season number
+func parseNumber(value string) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, types.NewValidation(types.CodeKeyRequired, types.KeyRequired)
+	}
+	return number, nil
+}
+
+//decodeUpdate decodes body to result, merge applies body as JSON Merge Patch to current value
+func decodeUpdate(current interface{}, body []byte, merge bool, result interface{}) error {
+	if merge {
+		target, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+		if body, err = mergePatch(target, body); err != nil {
+			return types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
+		}
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
+	}
+	return nil
+}
+
+//mergePatch applies RFC 7396 JSON Merge Patch to target document
+func mergePatch(target, patch []byte) ([]byte, error) {
+	var targetValue, patchValue interface{}
+	if err := json.Unmarshal(target, &targetValue); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValue(targetValue, patchValue))
+}
+
+//mergeValue merges patch value into target, null members of patch objects remove members of target
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+	return targetObject
+}
@@ -0,0 +1,167 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	types "scaleflixapi/errors"
+	"scaleflixapi/logger"
+	"strings"
+	"time"
+)
+
+const (
+	//RoleUser role of registered users
+	RoleUser = "user"
+	//RoleAdmin role of admins
+	RoleAdmin = "admin"
+)
+
+//ErrEmailExists is returned when email is used by another user
+var ErrEmailExists = types.NewConflict(types.CodeEmailExists, types.EmailAlreadyExists)
+
+//ErrFavoriteExists is returned when media is already favorite of user
+var ErrFavoriteExists = types.NewConflict(types.CodeFavoriteExists, types.FavoriteAlreadyExists)
+
+//Registration definition
+type Registration struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+//UserUpdate definition, nil fields are not changed
+type UserUpdate struct {
+	Name   *string `json:"name"`
+	Role   *string `json:"role"`
+	Active *bool   `json:"active"`
+}
+
+//UserList definition for paginated users response
+type UserList struct {
+	Items    []User `json:"items"`
+	Total    int    `json:"total"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+	Next     string `json:"next,omitempty"`
+	Prev     string `json:"prev,omitempty"`
+}
+
+//RegisterUser creates user with user role and hashed password
+func (d *Data) RegisterUser(body []byte) (User, error) {
+	var registration Registration
+	err := json.Unmarshal(body, &registration)
+	if err != nil {
+		logger.Error.Println(err)
+		return User{}, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
+	}
+	email, err := validateEmail(registration.Email)
+	if err != nil {
+		return User{}, err
+	}
+	name := strings.TrimSpace(registration.Name)
+	if name == "" {
+		return User{}, types.NewValidation(types.CodeFieldRequired, fmt.Sprintf(types.FieldRequired, "name"))
+	}
+	if len(registration.Password) < MinPasswordLength {
+		return User{}, types.NewValidation(types.CodePasswordTooShort, fmt.Sprintf(types.PasswordTooShort, MinPasswordLength))
+	}
+	hash, err := HashPassword(registration.Password)
+	if err != nil {
+		logger.Error.Println(err)
+		return User{}, err
+	}
+	user := User{Name: name, Email: email, Password: hash, Role: RoleUser}
+	err = d.Store.CreateUser(&user)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+	return user, err
+}
+
+//GetUsers gets users from datastore
+func (d *Data) GetUsers(page Page) (UserList, error) {
+	items, total, err := d.Store.FindUsers(page)
+	return UserList{Items: items, Total: total, Page: page.Number(), PageSize: page.Size}, err
+}
+
+//GetUserByID gets user from datastore with given id
+func (d *Data) GetUserByID(id string) (User, error) {
+	key, err := parseID(id)
+	if err != nil {
+		return User{}, err
+	}
+	user, err := d.Store.FindUserByID(key)
+	return user, notFound(err, id)
+}
+
+//UpdateUser changes name, role or active state of user
+func (d *Data) UpdateUser(id string, body []byte) (User, error) {
+	var update UserUpdate
+	err := json.Unmarshal(body, &update)
+	if err != nil {
+		logger.Error.Println(err)
+		return User{}, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err))
+	}
+	user, err := d.GetUserByID(id)
+	if err != nil {
+		return User{}, err
+	}
+	if update.Name != nil {
+		if strings.TrimSpace(*update.Name) == "" {
+			return User{}, types.NewValidation(types.CodeFieldRequired, fmt.Sprintf(types.FieldRequired, "name"))
+		}
+		user.Name = strings.TrimSpace(*update.Name)
+	}
+	endSessions := false
+	if update.Role != nil {
+		if *update.Role != RoleUser && *update.Role != RoleAdmin {
+			return User{}, types.NewValidation(types.CodeInvalidRole, types.RoleNotImplemented)
+		}
+		endSessions = *update.Role != user.Role
+		user.Role = *update.Role
+	}
+	if update.Active != nil {
+		if !*update.Active && user.DeactivatedAt == nil {
+			now := time.Now()
+			user.DeactivatedAt = &now
+			endSessions = true
+		} else if *update.Active {
+			user.DeactivatedAt = nil
+		}
+	}
+	err = d.Store.UpdateUser(&user)
+	if err != nil {
+		logger.Error.Println(err)
+		return user, err
+	}
+	if endSessions {
+		err = d.endSessions(user.ID)
+	}
+	return user, err
+}
+
+//endSessions revokes refresh token families of user, access tokens of the families are rejected with them
+func (d *Data) endSessions(userID uint) error {
+	err := d.Store.RevokeUserFamilies(userID, time.Now().Add(refreshTokenTTL()))
+	if err != nil {
+		logger.Error.Println(err)
+	}
+	return err
+}
+
+//DeactivateUser deactivates user given id and ends its sessions, deactivated users can not get token
+func (d *Data) DeactivateUser(id string) error {
+	_, err := d.UpdateUser(id, []byte(`{"active":false}`))
+	return err
+}
+
+//validateEmail checks email format and returns trimmed email
+func validateEmail(value string) (string, error) {
+	email := strings.TrimSpace(value)
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", types.NewValidation(types.CodeInvalidEmail, fmt.Sprintf(types.InvalidEmail, value))
+	}
+	return email, nil
+}
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	types "scaleflixapi/errors"
+	"strconv"
+	"strings"
+)
+
+//FieldError definition of invalid field in request body, field is JSON path like seasons[0].episodes[1].content.title
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+//validator checks value of field with tag parameter, returns nil when value is valid
+type validator func(value reflect.Value, param string) *FieldError
+
+//yearPattern matches year or year range of series, e.g. 2011–2019 or 2011–
+var yearPattern = regexp.MustCompile(`^(\d{4})(\s*[–-]\s*(\d{4})?)?$`)
+
+//validators rules usable in validate struct tags, dive validates nested struct or slice elements
+var validators = map[string]validator{
+	"required": func(value reflect.Value, param string) *FieldError {
+		if isZero(value) {
+			return &FieldError{Code: types.CodeFieldRequired, Message: types.FieldValueRequired}
+		}
+		return nil
+	},
+	"min": func(value reflect.Value, param string) *FieldError {
+		min, _ := strconv.ParseFloat(param, 64)
+		if number, ok := numberValue(value); ok && number < min {
+			return &FieldError{Code: types.CodeValueTooSmall, Message: fmt.Sprintf(types.ValueTooSmall, param)}
+		}
+		return nil
+	},
+	"max": func(value reflect.Value, param string) *FieldError {
+		max, _ := strconv.ParseFloat(param, 64)
+		if number, ok := numberValue(value); ok && number > max {
+			return &FieldError{Code: types.CodeValueTooLarge, Message: fmt.Sprintf(types.ValueTooLarge, param)}
+		}
+		return nil
+	},
+	"year": func(value reflect.Value, param string) *FieldError {
+		if year := strings.TrimSpace(value.String()); year != "" && !yearPattern.MatchString(year) {
+			return &FieldError{Code: types.CodeInvalidYear, Message: fmt.Sprintf(types.InvalidYear, year)}
+		}
+		return nil
+	},
+	"rating": func(value reflect.Value, param string) *FieldError {
+		rating := strings.TrimSpace(value.String())
+		if rating == "" || rating == "N/A" {
+			return nil
+		}
+		if number, err := strconv.ParseFloat(rating, 64); err != nil || number < 0 || number > 10 {
+			return &FieldError{Code: types.CodeInvalidRating, Message: fmt.Sprintf(types.InvalidRating, rating)}
+		}
+		return nil
+	},
+	"unique": func(value reflect.Value, param string) *FieldError {
+		seen := map[string]bool{}
+		for i := 0; i < value.Len(); i++ {
+			element := reflect.Indirect(value.Index(i))
+			if !element.IsValid() {
+				continue
+			}
+			field := fieldByJSONName(element, param)
+			if !field.IsValid() {
+				continue
+			}
+			key := fmt.Sprint(field.Interface())
+			if seen[key] {
+				return &FieldError{Code: types.CodeDuplicateValue, Message: fmt.Sprintf(types.DuplicateValue, param+" "+key)}
+			}
+			seen[key] = true
+		}
+		return nil
+	},
+}
+
+//validate checks validate struct tags of value and nested values, errors are ordered by field
+func validate(value interface{}) []FieldError {
+	return validateValue(reflect.ValueOf(value), "")
+}
+
+//validateValue checks validate tags of struct fields with path prefix, rules other than required skip nil pointers
+func validateValue(value reflect.Value, path string) []FieldError {
+	value = reflect.Indirect(value)
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs []FieldError
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := joinPath(path, jsonName(field))
+		for _, rule := range strings.Split(tag, ",") {
+			key, param := rule, ""
+			if index := strings.Index(rule, "="); index >= 0 {
+				key, param = rule[:index], rule[index+1:]
+			}
+			if key == "dive" {
+				errs = append(errs, dive(value.Field(i), name)...)
+				continue
+			}
+			field := value.Field(i)
+			if key != "required" && field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					break
+				}
+				field = field.Elem()
+			}
+			if err := validators[key](field, param); err != nil {
+				err.Field = name
+				errs = append(errs, *err)
+				break
+			}
+		}
+	}
+	return errs
+}
+
+//dive validates nested struct or elements of slice
+func dive(value reflect.Value, path string) []FieldError {
+	if value.Kind() != reflect.Slice {
+		return validateValue(value, path)
+	}
+	var errs []FieldError
+	for i := 0; i < value.Len(); i++ {
+		errs = append(errs, validateValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+	}
+	return errs
+}
+
+//validateMedia validates media posted to endpoint of media type, zero media types are set to type of endpoint
+func validateMedia(media *Media, mediaType MediaType) error {
+	if media.Type == 0 {
+		media.Type = mediaType
+	}
+	errs := append(validate(media), checkYears(media, "")...)
+	if media.Type != mediaType {
+		errs = append(errs, FieldError{Field: "type", Code: types.CodeInvalidMediaType, Message: fmt.Sprintf(types.InvalidMediaType, typeName(media.Type))})
+	}
+	if mediaType != Series && len(media.Seasons) > 0 {
+		errs = append(errs, FieldError{Field: "seasons", Code: types.CodeFieldNotAllowed, Message: fmt.Sprintf(types.FieldNotAllowed, "seasons")})
+	}
+	for i, season := range media.Seasons {
+		if season == nil {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("seasons[%d]", i), Code: types.CodeFieldRequired, Message: types.FieldValueRequired})
+			continue
+		}
+		errs = append(errs, checkEpisodes(season, fmt.Sprintf("seasons[%d]", i))...)
+	}
+	return invalidFields(errs)
+}
+
+//validateSeason validates season with episodes
+func validateSeason(season *Seasons) error {
+	return invalidFields(append(validate(season), checkEpisodes(season, "")...))
+}
+
+//validateEpisode validates episode with content
+func validateEpisode(episode *Episodes) error {
+	return invalidFields(append(validate(episode), checkContent(episode, "")...))
+}
+
+//validateFields validates struct tags of value
+func validateFields(value interface{}) error {
+	return invalidFields(validate(value))
+}
+
+//checkEpisodes checks content of episodes in season
+func checkEpisodes(season *Seasons, path string) []FieldError {
+	var errs []FieldError
+	for i, episode := range season.Episode {
+		if episode == nil {
+			errs = append(errs, FieldError{Field: joinPath(path, fmt.Sprintf("episodes[%d]", i)), Code: types.CodeFieldRequired, Message: types.FieldValueRequired})
+			continue
+		}
+		errs = append(errs, checkContent(episode, joinPath(path, fmt.Sprintf("episodes[%d]", i)))...)
+	}
+	return errs
+}
+
+//checkContent checks content of episode is episode media without seasons, zero media type is set to episode
+func checkContent(episode *Episodes, path string) []FieldError {
+	if episode.Media == nil {
+		return nil
+	}
+	var errs []FieldError
+	if episode.Media.Type == 0 {
+		episode.Media.Type = Episode
+	}
+	if episode.Media.Type != Episode {
+		errs = append(errs, FieldError{Field: joinPath(path, "content.type"), Code: types.CodeInvalidMediaType, Message: fmt.Sprintf(types.InvalidMediaType, typeName(episode.Media.Type))})
+	}
+	if len(episode.Media.Seasons) > 0 {
+		errs = append(errs, FieldError{Field: joinPath(path, "content.seasons"), Code: types.CodeFieldNotAllowed, Message: fmt.Sprintf(types.FieldNotAllowed, "seasons")})
+	}
+	return append(errs, checkYears(episode.Media, joinPath(path, "content"))...)
+}
+
+//checkYears checks last year of media is not before first year
+func checkYears(media *Media, path string) []FieldError {
+	if media.YearFrom != nil && media.YearTo != nil && *media.YearTo < *media.YearFrom {
+		return []FieldError{{Field: joinPath(path, "yearTo"), Code: types.CodeValueTooSmall, Message: fmt.Sprintf(types.ValueTooSmall, strconv.Itoa(*media.YearFrom))}}
+	}
+	return nil
+}
+
+//invalidFields returns validation error listing field errors, no errors return nil
+func invalidFields(errs []FieldError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	fields := make([]string, len(errs))
+	for i, err := range errs {
+		fields[i] = err.Field
+	}
+	return types.NewValidation(types.CodeInvalidFields, fmt.Sprintf(types.InvalidFields, strings.Join(fields, ", "))).With("errors", errs)
+}
+
+//typeName returns name of media type, unknown types return number
+func typeName(mediaType MediaType) string {
+	if name := mediaType.String(); name != "" {
+		return name
+	}
+	return strconv.Itoa(int(mediaType))
+}
+
+//numberValue returns value of int, uint or float kinds as float64
+func numberValue(value reflect.Value) (float64, bool) {
+	switch {
+	case value.Kind() >= reflect.Int && value.Kind() <= reflect.Int64:
+		return float64(value.Int()), true
+	case value.Kind() >= reflect.Uint && value.Kind() <= reflect.Uintptr:
+		return float64(value.Uint()), true
+	case value.Kind() == reflect.Float32 || value.Kind() == reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+//isZero reports whether value is nil, blank or zero
+func isZero(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return value.IsNil()
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	}
+	return value.IsZero()
+}
+
+//fieldByJSONName returns field of struct value given JSON name
+func fieldByJSONName(value reflect.Value, name string) reflect.Value {
+	for i := 0; i < value.NumField(); i++ {
+		if jsonName(value.Type().Field(i)) == name {
+			return value.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+//jsonName returns JSON name of struct field
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+//joinPath joins JSON path of nested field
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,83 @@
+package types
+
+//Stable error codes of problem responses
+const (
+	//CodeInternal unexpected error
+	CodeInternal = "internal_error"
+	//CodeInvalidBody request body can not be read or parsed
+	CodeInvalidBody = "invalid_body"
+	//CodeKeyRequired id is missing or invalid
+	CodeKeyRequired = "key_required"
+	//CodeNotFound record is not found
+	CodeNotFound = "not_found"
+	//CodeInvalidPage page or pageSize is invalid
+	CodeInvalidPage = "invalid_page"
+	//CodeInvalidCursor cursor query parameter is not supported
+	CodeInvalidCursor = "invalid_cursor"
+	//CodeInvalidFilter filter query parameter is invalid
+	CodeInvalidFilter = "invalid_filter"
+	//CodeInvalidSort sort field is not allowed
+	CodeInvalidSort = "invalid_sort"
+	//CodeSearchQueryRequired search query is missing
+	CodeSearchQueryRequired = "search_query_required"
+	//CodeInvalidMediaType media type is unknown
+	CodeInvalidMediaType = "invalid_media_type"
+	//CodeFieldRequired required field is missing
+	CodeFieldRequired = "field_required"
+	//CodeInvalidEmail email format is invalid
+	CodeInvalidEmail = "invalid_email"
+	//CodePasswordTooShort new password is too short
+	CodePasswordTooShort = "password_too_short"
+	//CodeInvalidRole role is unknown
+	CodeInvalidRole = "invalid_role"
+	//CodeMediaNotFound media of request body is not found
+	CodeMediaNotFound = "media_not_found"
+	//CodeEmailExists email is used by another user
+	CodeEmailExists = "email_exists"
+	//CodeFavoriteExists media is already favorite of user
+	CodeFavoriteExists = "favorite_exists"
+	//CodeInvalidCredentials email or password is incorrect
+	CodeInvalidCredentials = "invalid_credentials"
+	//CodeUserDeactivated user account is deactivated
+	CodeUserDeactivated = "user_deactivated"
+	//CodeNoToken authorization header is missing
+	CodeNoToken = "no_token"
+	//CodeInvalidAuthorization authorization header is not a bearer token
+	CodeInvalidAuthorization = "invalid_authorization"
+	//CodeInvalidToken token is invalid or expired
+	CodeInvalidToken = "invalid_token"
+	//CodeTokenRevoked token is revoked
+	CodeTokenRevoked = "token_revoked"
+	//CodeInvalidRefreshToken refresh token is invalid or expired
+	CodeInvalidRefreshToken = "invalid_refresh_token"
+	//CodeRefreshTokenReused rotated refresh token is used again
+	CodeRefreshTokenReused = "refresh_token_reused"
+	//CodeInvalidResetToken password reset token is invalid or expired
+	CodeInvalidResetToken = "invalid_reset_token"
+	//CodeUserRequired token has no user id
+	CodeUserRequired = "user_required"
+	//CodeNotAllowed role can not do the action
+	CodeNotAllowed = "not_allowed"
+	//CodeUpstreamFailed external service failed
+	CodeUpstreamFailed = "upstream_failed"
+	//CodeInvalidFields fields of request body are invalid, problem lists errors of fields
+	CodeInvalidFields = "invalid_fields"
+	//CodeValueTooSmall number field is less than minimum
+	CodeValueTooSmall = "value_too_small"
+	//CodeValueTooLarge number field is greater than maximum
+	CodeValueTooLarge = "value_too_large"
+	//CodeInvalidYear year is not a year or year range
+	CodeInvalidYear = "invalid_year"
+	//CodeInvalidRating rating is not between 0 and 10
+	CodeInvalidRating = "invalid_rating"
+	//CodeDuplicateValue value is used by another element of list
+	CodeDuplicateValue = "duplicate_value"
+	//CodeFieldNotAllowed field can not be set for the record
+	CodeFieldNotAllowed = "field_not_allowed"
+	//CodePreconditionFailed If-Match header does not match ETag of record
+	CodePreconditionFailed = "precondition_failed"
+	//CodeImportIncomplete seasons or episodes of imported series can not be looked up
+	CodeImportIncomplete = "import_incomplete"
+	//CodePurgeSelectorRequired purge of metadata cache has no title, imdbId or all
+	CodePurgeSelectorRequired = "purge_selector_required"
+)
@@ -0,0 +1,134 @@
+package types
+
+import (
+	"errors"
+	"net/http"
+)
+
+//Kind definition of error category, every kind maps to a HTTP status code
+type Kind int
+
+const (
+	//KindInternal unexpected errors, details are not shown to clients
+	KindInternal Kind = iota
+	//KindValidation request input is invalid
+	KindValidation
+	//KindNotFound requested record does not exist
+	KindNotFound
+	//KindConflict request conflicts with existing record
+	KindConflict
+	//KindUnauthorized request is not authenticated
+	KindUnauthorized
+	//KindForbidden authenticated principal can not do the action
+	KindForbidden
+	//KindUpstream external service failed
+	KindUpstream
+	//KindPrecondition conditional request header does not match current record
+	KindPrecondition
+)
+
+//kindStatus HTTP status codes of kinds
+var kindStatus = map[Kind]int{
+	KindInternal:     http.StatusInternalServerError,
+	KindValidation:   http.StatusBadRequest,
+	KindNotFound:     http.StatusNotFound,
+	KindConflict:     http.StatusConflict,
+	KindUnauthorized: http.StatusUnauthorized,
+	KindForbidden:    http.StatusForbidden,
+	KindUpstream:     http.StatusBadGateway,
+	KindPrecondition: http.StatusPreconditionFailed,
+}
+
+//Error definition of typed error, code is stable and can be used by clients
+type Error struct {
+	Kind       Kind
+	Code       string
+	Message    string
+	Extensions map[string]interface{}
+	Err        error
+}
+
+//NewValidation creates validation error
+func NewValidation(code, message string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message}
+}
+
+//NewNotFound creates not found error
+func NewNotFound(code, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+//NewConflict creates conflict error
+func NewConflict(code, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+//NewUnauthorized creates unauthorized error
+func NewUnauthorized(code, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+//NewForbidden creates forbidden error
+func NewForbidden(code, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+//NewUpstream creates error of failed external service wrapping cause
+func NewUpstream(code, message string, err error) *Error {
+	return &Error{Kind: KindUpstream, Code: code, Message: message, Err: err}
+}
+
+//NewPrecondition creates precondition failed error
+func NewPrecondition(code, message string) *Error {
+	return &Error{Kind: KindPrecondition, Code: code, Message: message}
+}
+
+//NewInternal wraps unexpected error
+func NewInternal(err error) *Error {
+	return &Error{Kind: KindInternal, Code: CodeInternal, Message: InternalServerError, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+//Unwrap returns cause of error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+//Is matches errors with same kind and code, so formatted messages do not matter
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Code == e.Code
+}
+
+//Status returns HTTP status code of error
+func (e *Error) Status() int {
+	return kindStatus[e.Kind]
+}
+
+//With returns copy of error with extension member shown in problem response
+func (e *Error) With(key string, value interface{}) *Error {
+	result := *e
+	result.Extensions = map[string]interface{}{}
+	for k, v := range e.Extensions {
+		result.Extensions[k] = v
+	}
+	result.Extensions[key] = value
+	return &result
+}
+
+//From returns typed error of err, untyped errors are internal
+func From(err error) *Error {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed
+	}
+	return NewInternal(err)
+}
+
+//StatusOf returns HTTP status code of err
+func StatusOf(err error) int {
+	return From(err).Status()
+}
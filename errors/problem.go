@@ -0,0 +1,57 @@
+package types
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+//ProblemContentType media type of problem responses
+const ProblemContentType = "application/problem+json"
+
+//Problem definition of RFC 7807 problem details, extensions are written as top level members
+type Problem struct {
+	Type       string                 `json:"type"`
+	Title      string                 `json:"title"`
+	Status     int                    `json:"status"`
+	Detail     string                 `json:"detail"`
+	Instance   string                 `json:"instance,omitempty"`
+	Code       string                 `json:"code"`
+	RequestID  string                 `json:"requestId"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+//NewProblem creates problem of err for request path and id
+func NewProblem(err error, instance, requestID string) Problem {
+	typed := From(err)
+	return Problem{
+		Type:       "about:blank",
+		Title:      http.StatusText(typed.Status()),
+		Status:     typed.Status(),
+		Detail:     typed.Message,
+		Instance:   instance,
+		Code:       typed.Code,
+		RequestID:  requestID,
+		Extensions: typed.Extensions,
+	}
+}
+
+//MarshalJSON writes extension members next to standard members
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	body, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+	members := map[string]interface{}{}
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	standard := map[string]interface{}{}
+	if err = json.Unmarshal(body, &standard); err != nil {
+		return nil, err
+	}
+	for key, value := range standard {
+		members[key] = value
+	}
+	return json.Marshal(members)
+}
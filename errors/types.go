@@ -21,4 +21,68 @@ var (
 	NotAllowedAction = "Role can not do this action"
 	//UserRequired User Id is required
 	UserRequired = "User Id is required!"
+	//EmailAlreadyExists email is used by another user
+	EmailAlreadyExists = "Email already exists."
+	//FavoriteAlreadyExists media is already favorite of user
+	FavoriteAlreadyExists = "Media is already in favorites."
+	//MediaNotFound media of request body is not found
+	MediaNotFound = "Media is not found!, %d"
+	//InvalidPage page and pageSize must be positive numbers
+	InvalidPage = "Page and pageSize must be positive numbers."
+	//InvalidCursor cursor query parameter is not supported
+	InvalidCursor = "Cursor is not supported, use page and pageSize."
+	//InvalidFilter filter query parameter is invalid
+	InvalidFilter = "Filter is invalid!, %s"
+	//InvalidSortField sort field is not allowed
+	InvalidSortField = "Sort field is not allowed!, %s"
+	//SearchQueryRequired search text is required
+	SearchQueryRequired = "Search query is required!"
+	//InvalidMediaType media type is not movie, series or episode
+	InvalidMediaType = "Media type is invalid!, %s"
+	//PasswordTooShort new password is too short
+	PasswordTooShort = "Password must be at least %d characters."
+	//InvalidResetToken password reset token is unknown, used or expired
+	InvalidResetToken = "Reset token is invalid or expired."
+	//InvalidEmail email format is invalid
+	InvalidEmail = "Email is invalid!, %s"
+	//FieldRequired field is required
+	FieldRequired = "Field is required!, %s"
+	//UserDeactivated user account is deactivated
+	UserDeactivated = "User is deactivated."
+	//InvalidRefreshToken refresh token is unknown, revoked or expired
+	InvalidRefreshToken = "Refresh token is invalid or expired."
+	//RefreshTokenReused rotated refresh token is used again
+	RefreshTokenReused = "Refresh token is reused, session is revoked."
+	//TokenRevoked token is revoked
+	TokenRevoked = "Your Token has been revoked."
+	//InvalidSigningKey signing key config or PEM file is invalid
+	InvalidSigningKey = "Signing key is invalid!, %s"
+	//InternalServerError unexpected error, details are logged only
+	InternalServerError = "Internal server error."
+	//InvalidBody request body can not be read or parsed
+	InvalidBody = "Body is invalid!, %s"
+	//UpstreamFailed external service failed
+	UpstreamFailed = "External service failed!, %s"
+	//InvalidFields fields of request body are invalid
+	InvalidFields = "Fields are invalid!, %s"
+	//FieldValueRequired field is missing or blank
+	FieldValueRequired = "Field is required!"
+	//ValueTooSmall number is less than minimum
+	ValueTooSmall = "Value must be at least %s!"
+	//ValueTooLarge number is greater than maximum
+	ValueTooLarge = "Value must be at most %s!"
+	//InvalidYear year is not a year or year range
+	InvalidYear = "Year is invalid!, %s"
+	//InvalidRating rating is not between 0 and 10
+	InvalidRating = "Rating must be between 0 and 10!, %s"
+	//DuplicateValue value is used by another element of list
+	DuplicateValue = "Value is duplicated!, %s"
+	//FieldNotAllowed field can not be set for the record
+	FieldNotAllowed = "Field is not allowed!, %s"
+	//PreconditionFailed If-Match header does not match ETag of record
+	PreconditionFailed = "Record is modified, ETag does not match!, %s"
+	//ImportIncomplete seasons or episodes of imported series can not be looked up
+	ImportIncomplete = "Import is incomplete!, %d seasons and episodes can not be looked up"
+	//PurgeSelectorRequired purge of metadata cache has no title, imdbId or all
+	PurgeSelectorRequired = "title, imdbId or all=true is required!"
 )
@@ -7,6 +7,7 @@ require (
 	github.com/gorilla/mux v1.8.0
 	github.com/jinzhu/gorm v1.9.16
 	github.com/lib/pq v1.10.4
+	golang.org/x/crypto v0.14.0
 )
 
 require github.com/jinzhu/inflection v1.0.0 // indirect
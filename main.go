@@ -17,16 +17,11 @@
 package main
 
 import (
-	"scaleflixapi/logger"
-	"scaleflixapi/server"
+	"os"
+
+	"scaleflixapi/cli"
 )
 
 func main() {
-	defer func() {
-		if r := recover(); r != nil {
-			logger.Fatal.Printf("Failed: (%v)", r)
-			server.CloseDB()
-		}
-	}()
-	server.NewServer()
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
 }
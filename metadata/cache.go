@@ -0,0 +1,357 @@
+package metadata
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"scaleflixapi/data"
+	"scaleflixapi/logger"
+)
+
+const (
+	defaultCacheSize = 1000
+	defaultCacheTTL  = 24 * time.Hour
+)
+
+//CacheEntry definition of cached lookup, Value is JSON of looked up content
+type CacheEntry struct {
+	Key     string          `json:"key"`
+	Value   json.RawMessage `json:"value"`
+	Expires time.Time       `json:"expires"`
+}
+
+//CacheStore persists cached lookups so they outlive the process
+type CacheStore interface {
+	Load(key string) (CacheEntry, bool, error)
+	Save(entry CacheEntry) error
+	Delete(match func(entry CacheEntry) bool) ([]string, error)
+}
+
+//CacheStats definition of cache counters, hits and misses count lookups since start
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+//Cache client caching successful lookups of Client in LRU memory cache with TTL and optional Store.
+//Values are kept as JSON so callers can change looked up content without changing the cache.
+type Cache struct {
+	//hits and misses come first to keep them aligned for atomic access
+	hits    int64
+	misses  int64
+	Client  Client
+	Store   CacheStore
+	size    int
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+//NewCache creates cache of client keeping at most size entries in memory for ttl, store is optional
+func NewCache(client Client, store CacheStore, size int, ttl time.Duration) *Cache {
+	if size < 1 {
+		size = defaultCacheSize
+	}
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &Cache{Client: client, Store: store, size: size, ttl: ttl, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+//titleKey, idKey and seasonKey return cache keys of lookups, titles are case insensitive
+func titleKey(title string) string {
+	return "title:" + strings.ToLower(strings.TrimSpace(title))
+}
+
+func idKey(imdbID string) string {
+	return "id:" + imdbID
+}
+
+func seasonKey(imdbID string, season int) string {
+	return fmt.Sprintf("season:%s:%d", imdbID, season)
+}
+
+//searchKey starts with searchPrefix of title so searches of title are purged with it
+func searchKey(query SearchQuery) string {
+	return fmt.Sprintf("%s%d:%s:%d", searchPrefix(query.Title), query.Year, query.Type, query.Page)
+}
+
+func searchPrefix(title string) string {
+	return "search:" + strings.ToLower(strings.TrimSpace(title)) + ":"
+}
+
+//ByTitle looks up movie or series given exact title
+func (c *Cache) ByTitle(ctx context.Context, title string) (data.MediaAPIContent, error) {
+	result := data.MediaAPIContent{}
+	err := c.lookup(titleKey(title), &result, func() (interface{}, error) {
+		return c.Client.ByTitle(ctx, title)
+	})
+	return result, err
+}
+
+//ByID looks up movie, series or episode given IMDb id
+func (c *Cache) ByID(ctx context.Context, imdbID string) (data.MediaAPIContent, error) {
+	result := data.MediaAPIContent{}
+	err := c.lookup(idKey(imdbID), &result, func() (interface{}, error) {
+		return c.Client.ByID(ctx, imdbID)
+	})
+	return result, err
+}
+
+//Season looks up episodes of season given IMDb id of series and season number
+func (c *Cache) Season(ctx context.Context, imdbID string, season int) (data.SeasonsAPIContent, error) {
+	result := data.SeasonsAPIContent{}
+	err := c.lookup(seasonKey(imdbID, season), &result, func() (interface{}, error) {
+		return c.Client.Season(ctx, imdbID, season)
+	})
+	return result, err
+}
+
+//Search looks up page of candidates of provider search
+func (c *Cache) Search(ctx context.Context, query SearchQuery) (CandidateList, error) {
+	result := CandidateList{}
+	err := c.lookup(searchKey(query), &result, func() (interface{}, error) {
+		return c.Client.Search(ctx, query)
+	})
+	return result, err
+}
+
+//Stats returns hit and miss counters and count of entries in memory
+func (c *Cache) Stats() CacheStats {
+	c.mutex.Lock()
+	entries := c.order.Len()
+	c.mutex.Unlock()
+	return CacheStats{Hits: atomic.LoadInt64(&c.hits), Misses: atomic.LoadInt64(&c.misses), Entries: entries}
+}
+
+//Purge removes entries and searches of title and entries of IMDb id with its seasons, titles and searches resolving to it,
+//returns count of removed keys. Empty title and IMDb id remove nothing, see PurgeAll.
+func (c *Cache) Purge(title, imdbID string) (int, error) {
+	return c.purge(func(entry CacheEntry) bool {
+		key := entry.Key
+		return (title != "" && (key == titleKey(title) || strings.HasPrefix(key, searchPrefix(title)))) ||
+			(imdbID != "" && (key == idKey(imdbID) || strings.HasPrefix(key, "season:"+imdbID+":") || refersTo(entry, imdbID)))
+	})
+}
+
+//PurgeAll removes all entries, returns count of removed keys
+func (c *Cache) PurgeAll() (int, error) {
+	return c.purge(func(entry CacheEntry) bool { return true })
+}
+
+//refersTo checks title entry looked up media of IMDb id or search entry has candidate of it
+func refersTo(entry CacheEntry, imdbID string) bool {
+	if !strings.HasPrefix(entry.Key, "title:") && !strings.HasPrefix(entry.Key, "search:") {
+		return false
+	}
+	//json keys are matched case-insensitive, so imdbID of lookups and imdbId of candidates are both decoded
+	value := struct {
+		ImdbID string `json:"imdbID"`
+		Items  []struct {
+			ImdbID string `json:"imdbID"`
+		} `json:"items"`
+	}{}
+	if json.Unmarshal(entry.Value, &value) != nil {
+		return false
+	}
+	if value.ImdbID == imdbID {
+		return true
+	}
+	for _, item := range value.Items {
+		if item.ImdbID == imdbID {
+			return true
+		}
+	}
+	return false
+}
+
+//purge removes entries of memory and store matching match, returns count of removed keys
+func (c *Cache) purge(match func(entry CacheEntry) bool) (int, error) {
+	removed := map[string]bool{}
+	c.mutex.Lock()
+	for key, element := range c.entries {
+		if match(element.Value.(CacheEntry)) {
+			c.order.Remove(element)
+			delete(c.entries, key)
+			removed[key] = true
+		}
+	}
+	c.mutex.Unlock()
+	if c.Store != nil {
+		keys, err := c.Store.Delete(match)
+		for _, key := range keys {
+			removed[key] = true
+		}
+		if err != nil {
+			return len(removed), err
+		}
+	}
+	return len(removed), nil
+}
+
+//lookup decodes cached value of key to result, misses call fetch and cache its result when it succeeds
+func (c *Cache) lookup(key string, result interface{}, fetch func() (interface{}, error)) error {
+	if entry, ok := c.load(key); ok && json.Unmarshal(entry.Value, result) == nil {
+		atomic.AddInt64(&c.hits, 1)
+		return nil
+	}
+	atomic.AddInt64(&c.misses, 1)
+	value, err := fetch()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	entry := CacheEntry{Key: key, Value: body, Expires: time.Now().Add(c.ttl)}
+	c.add(entry)
+	if c.Store != nil {
+		if err := c.Store.Save(entry); err != nil {
+			logger.Error.Printf("metadata cache entry %s is not saved, %v", key, err)
+		}
+	}
+	return json.Unmarshal(body, result)
+}
+
+//load returns unexpired entry of memory or of store, entries of store are added to memory
+func (c *Cache) load(key string) (CacheEntry, bool) {
+	c.mutex.Lock()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(CacheEntry)
+		if time.Now().Before(entry.Expires) {
+			c.order.MoveToFront(element)
+			c.mutex.Unlock()
+			return entry, true
+		}
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+	c.mutex.Unlock()
+	if c.Store == nil {
+		return CacheEntry{}, false
+	}
+	entry, ok, err := c.Store.Load(key)
+	if err != nil {
+		logger.Error.Printf("metadata cache entry %s is not loaded, %v", key, err)
+		return CacheEntry{}, false
+	}
+	if !ok || !time.Now().Before(entry.Expires) {
+		return CacheEntry{}, false
+	}
+	c.add(entry)
+	return entry, true
+}
+
+//add adds entry to memory, least recently used entries are evicted above size
+func (c *Cache) add(entry CacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[entry.Key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[entry.Key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(CacheEntry).Key)
+	}
+}
+
+//FileCacheStore cache store keeping each entry as JSON file in Dir
+type FileCacheStore struct {
+	Dir string
+}
+
+//NewFileCacheStore creates file cache store in dir, dir is created when missing
+func NewFileCacheStore(dir string) (*FileCacheStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileCacheStore{Dir: dir}, nil
+}
+
+//path returns file of key, keys are hashed since titles are not valid file names
+func (f *FileCacheStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+//Load reads entry of key, expired entries are removed
+func (f *FileCacheStore) Load(key string) (CacheEntry, bool, error) {
+	entry := CacheEntry{}
+	body, err := ioutil.ReadFile(f.path(key))
+	if os.IsNotExist(err) {
+		return entry, false, nil
+	}
+	if err != nil {
+		return entry, false, err
+	}
+	if err = json.Unmarshal(body, &entry); err != nil || entry.Key != key {
+		return CacheEntry{}, false, err
+	}
+	if !time.Now().Before(entry.Expires) {
+		os.Remove(f.path(key))
+		return CacheEntry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+//Save writes entry to temporary file and renames it so readers never see partial entries
+func (f *FileCacheStore) Save(entry CacheEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(f.Dir, "entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), f.path(entry.Key))
+}
+
+//Delete removes matching entries and returns their keys
+func (f *FileCacheStore) Delete(match func(entry CacheEntry) bool) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(f.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, path := range paths {
+		entry := CacheEntry{}
+		body, err := ioutil.ReadFile(path)
+		if err != nil || json.Unmarshal(body, &entry) != nil {
+			continue
+		}
+		if match(entry) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return keys, err
+			}
+			keys = append(keys, entry.Key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,147 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"scaleflixapi/config"
+	"scaleflixapi/data"
+)
+
+const (
+	defaultWorkers = 4
+	//MaxSeasons seasons of series that are looked up, providers returning more are not trusted
+	MaxSeasons = 100
+)
+
+//Fetcher looks up seasons and episodes of series with bounded count of concurrent lookups
+type Fetcher struct {
+	Client  Client
+	Workers int
+	Timeout time.Duration
+}
+
+//Failure definition of season or episode lookup that failed, episode is empty for failed seasons
+type Failure struct {
+	Season  int    `json:"season"`
+	Episode string `json:"episode,omitempty"`
+	ImdbID  string `json:"imdbId,omitempty"`
+	Error   string `json:"error"`
+}
+
+//Suggestion definition of looked up media, failures list seasons and episodes that could not be looked up
+type Suggestion struct {
+	*data.Media
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+//NewFetcher creates fetcher of client with workers and per lookup timeout of config
+func NewFetcher(client Client) *Fetcher {
+	workers, err := strconv.Atoi(config.OMDbWorkers)
+	if err != nil || workers < 1 {
+		workers = defaultWorkers
+	}
+	return &Fetcher{Client: client, Workers: workers, Timeout: durationConfig(config.OMDbTimeout, defaultTimeout)}
+}
+
+//FetchSeasons looks up seasons of series and then content of their episodes, results keep season and episode order.
+//Failed seasons are left out and failed episodes keep title and IMDb id of season listing, both are returned as failures.
+//Only MaxSeasons seasons are looked up, the excess of TotalSeasons is returned as failure of the first season left out.
+//Lookups stop when ctx is done, its error is returned with seasons looked up until then.
+func (f *Fetcher) FetchSeasons(ctx context.Context, series data.MediaAPIContent) ([]data.SeasonsAPIContent, []Failure, error) {
+	countSeason, err := strconv.Atoi(series.TotalSeasons)
+	if err != nil || countSeason < 0 {
+		countSeason = 0
+	}
+	var excess *Failure
+	if countSeason > MaxSeasons {
+		excess = &Failure{Season: MaxSeasons + 1, ImdbID: series.ImdbID,
+			Error: fmt.Sprintf("series has %d seasons, seasons after %d are not looked up", countSeason, MaxSeasons)}
+		countSeason = MaxSeasons
+	}
+	seasons := make([]data.SeasonsAPIContent, countSeason)
+	seasonErrs := make([]error, countSeason)
+	f.run(ctx, countSeason, func(ctx context.Context, i int) {
+		seasons[i], seasonErrs[i] = f.Client.Season(ctx, series.ImdbID, i+1)
+	})
+
+	type episodeJob struct {
+		season, episode int
+	}
+	jobs := []episodeJob{}
+	for i, season := range seasons {
+		if seasonErrs[i] == nil {
+			for j, episode := range season.Episodes {
+				if episode != nil {
+					jobs = append(jobs, episodeJob{i, j})
+				}
+			}
+		}
+	}
+	episodeErrs := make([]error, len(jobs))
+	f.run(ctx, len(jobs), func(ctx context.Context, i int) {
+		episode := seasons[jobs[i].season].Episodes[jobs[i].episode]
+		episode.EpisodeContent, episodeErrs[i] = f.Client.ByID(ctx, episode.ImdbID)
+	})
+
+	result := make([]data.SeasonsAPIContent, 0, countSeason)
+	failures := []Failure{}
+	for i, err := range seasonErrs {
+		if err != nil {
+			failures = append(failures, Failure{Season: i + 1, Error: err.Error()})
+		}
+	}
+	if excess != nil {
+		failures = append(failures, *excess)
+	}
+	for i, err := range episodeErrs {
+		if err == nil {
+			continue
+		}
+		episode := seasons[jobs[i].season].Episodes[jobs[i].episode]
+		episode.EpisodeContent = data.MediaAPIContent{Type: "episode", Title: episode.Title, ImdbID: episode.ImdbID}
+		failures = append(failures, Failure{Season: jobs[i].season + 1, Episode: episode.EpisodesNumber, ImdbID: episode.ImdbID, Error: err.Error()})
+	}
+	for i, season := range seasons {
+		if seasonErrs[i] == nil {
+			result = append(result, season)
+		}
+	}
+	return result, failures, ctx.Err()
+}
+
+//run calls fn for indexes below count with at most Workers calls at a time, each call has its own timeout.
+//Indexes not started before ctx is done are called with the done context, so their lookups fail with its error.
+func (f *Fetcher) run(ctx context.Context, count int, fn func(ctx context.Context, i int)) {
+	workers := f.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > count {
+		workers = count
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				callCtx, cancel := ctx, context.CancelFunc(func() {})
+				if f.Timeout > 0 {
+					callCtx, cancel = context.WithTimeout(ctx, f.Timeout)
+				}
+				fn(callCtx, i)
+				cancel()
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
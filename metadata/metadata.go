@@ -0,0 +1,100 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"scaleflixapi/config"
+	"scaleflixapi/data"
+	"scaleflixapi/logger"
+)
+
+//Client looks up movies, series, seasons and episodes of metadata provider
+type Client interface {
+	ByTitle(ctx context.Context, title string) (data.MediaAPIContent, error)
+	ByID(ctx context.Context, imdbID string) (data.MediaAPIContent, error)
+	Season(ctx context.Context, imdbID string, season int) (data.SeasonsAPIContent, error)
+	Search(ctx context.Context, query SearchQuery) (CandidateList, error)
+}
+
+//ErrorKind definition of why lookup failed
+type ErrorKind int
+
+const (
+	//KindUnavailable provider can not be reached, timed out or returned invalid response
+	KindUnavailable ErrorKind = iota
+	//KindNotFound provider has no media for lookup
+	KindNotFound
+	//KindUnauthorized api key is missing or invalid
+	KindUnauthorized
+	//KindRateLimited request limit of api key is reached
+	KindRateLimited
+	//KindRejected provider rejected lookup with another error
+	KindRejected
+)
+
+//Error definition of failed lookup, Message is error of provider and Status is http status of its response
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	Status  int
+	Err     error
+}
+
+var (
+	//ErrUnavailable matches errors of unreachable provider with errors.Is
+	ErrUnavailable = &Error{Kind: KindUnavailable}
+	//ErrNotFound matches errors of missing media with errors.Is
+	ErrNotFound = &Error{Kind: KindNotFound}
+	//ErrUnauthorized matches errors of invalid api key with errors.Is
+	ErrUnauthorized = &Error{Kind: KindUnauthorized}
+	//ErrRateLimited matches errors of reached request limit with errors.Is
+	ErrRateLimited = &Error{Kind: KindRateLimited}
+	//ErrRejected matches other errors of provider with errors.Is
+	ErrRejected = &Error{Kind: KindRejected}
+)
+
+func (e *Error) Error() string {
+	message := e.Message
+	if message == "" && e.Err != nil {
+		message = e.Err.Error()
+	}
+	if e.Status != 0 {
+		return fmt.Sprintf("metadata lookup failed with status %d: %s", e.Status, message)
+	}
+	return "metadata lookup failed: " + message
+}
+
+//Unwrap returns cause of error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+//Is reports whether target is lookup error of same kind
+func (e *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Kind == e.Kind
+}
+
+//New creates OMDb client with base url, api key and timeouts of config, lookups are cached unless cache size of config is 0
+func New() Client {
+	client := NewOMDb(config.OMDbURL, config.APIKey, durationConfig(config.OMDbTimeout, defaultTimeout), durationConfig(config.OMDbConnectTimeout, defaultConnectTimeout))
+	size, err := strconv.Atoi(config.OMDbCacheSize)
+	if err != nil {
+		size = defaultCacheSize
+	}
+	if size <= 0 {
+		return client
+	}
+	var store CacheStore
+	if config.OMDbCacheDir != "" {
+		fileStore, err := NewFileCacheStore(config.OMDbCacheDir)
+		if err != nil {
+			logger.Error.Printf("metadata cache directory %s is not usable, caching in memory only, %v", config.OMDbCacheDir, err)
+		} else {
+			store = fileStore
+		}
+	}
+	return NewCache(client, store, size, durationConfig(config.OMDbCacheTTL, defaultCacheTTL))
+}
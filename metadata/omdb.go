@@ -0,0 +1,128 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"scaleflixapi/data"
+)
+
+const (
+	defaultTimeout        = 10 * time.Second
+	defaultConnectTimeout = 5 * time.Second
+	//maxResponseSize limit of read response body
+	maxResponseSize = 4 << 20
+)
+
+//OMDb client of OMDb API
+type OMDb struct {
+	BaseURL string
+	APIKey  string
+	HTTP    *http.Client
+}
+
+//omdbStatus definition of response status of OMDb, failed lookups have Response False and Error
+type omdbStatus struct {
+	Response string `json:"Response"`
+	Error    string `json:"Error"`
+}
+
+//NewOMDb creates OMDb client given base url and api key, timeout limits each request and connectTimeout limits connecting to OMDb
+func NewOMDb(baseURL, apiKey string, timeout, connectTimeout time.Duration) *OMDb {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	return &OMDb{BaseURL: baseURL, APIKey: apiKey, HTTP: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+//ByTitle looks up movie or series given exact title
+func (o *OMDb) ByTitle(ctx context.Context, title string) (data.MediaAPIContent, error) {
+	result := data.MediaAPIContent{}
+	err := o.get(ctx, url.Values{"t": {title}}, &result)
+	return result, err
+}
+
+//ByID looks up movie, series or episode given IMDb id
+func (o *OMDb) ByID(ctx context.Context, imdbID string) (data.MediaAPIContent, error) {
+	result := data.MediaAPIContent{}
+	err := o.get(ctx, url.Values{"i": {imdbID}}, &result)
+	return result, err
+}
+
+//Season looks up episodes of season given IMDb id of series and season number
+func (o *OMDb) Season(ctx context.Context, imdbID string, season int) (data.SeasonsAPIContent, error) {
+	result := data.SeasonsAPIContent{}
+	err := o.get(ctx, url.Values{"i": {imdbID}, "season": {strconv.Itoa(season)}}, &result)
+	return result, err
+}
+
+//get requests OMDb with query and api key and decodes response to result, failed lookups return *Error
+func (o *OMDb) get(ctx context.Context, query url.Values, result interface{}) error {
+	query.Set("apikey", o.APIKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.BaseURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return &Error{Kind: KindUnavailable, Err: err}
+	}
+	resp, err := o.HTTP.Do(req)
+	if err != nil {
+		//url errors contain request url with api key, only their cause is kept
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return &Error{Kind: KindUnavailable, Err: err}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxResponseSize))
+	if err != nil {
+		return &Error{Kind: KindUnavailable, Status: resp.StatusCode, Err: err}
+	}
+	status := omdbStatus{}
+	if err = json.Unmarshal(body, &status); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &Error{Kind: KindUnavailable, Status: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		}
+		return &Error{Kind: KindUnavailable, Status: resp.StatusCode, Err: err}
+	}
+	if strings.EqualFold(status.Response, "False") {
+		return &Error{Kind: errorKind(status.Error), Status: resp.StatusCode, Message: status.Error}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &Error{Kind: KindUnavailable, Status: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+	if err = json.Unmarshal(body, result); err != nil {
+		return &Error{Kind: KindUnavailable, Status: resp.StatusCode, Err: err}
+	}
+	return nil
+}
+
+//errorKind returns kind of Error message of OMDb, e.g. Movie not found! or Invalid API key!
+func errorKind(message string) ErrorKind {
+	message = strings.ToLower(message)
+	switch {
+	case strings.Contains(message, "not found") || strings.Contains(message, "incorrect imdb id"):
+		return KindNotFound
+	case strings.Contains(message, "api key"):
+		return KindUnauthorized
+	case strings.Contains(message, "limit"):
+		return KindRateLimited
+	}
+	return KindRejected
+}
+
+//durationConfig parses duration config value, invalid and non positive values use fallback
+func durationConfig(value string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
@@ -0,0 +1,85 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+const (
+	//SearchPageSize count of candidates in each page of provider search
+	SearchPageSize = 10
+	//MaxSearchPage last page provider search returns
+	MaxSearchPage = 100
+)
+
+//SearchQuery definition of provider search, Year and Type are optional filters and Page starts from 1
+type SearchQuery struct {
+	Title string
+	Year  int
+	Type  string
+	Page  int
+}
+
+//Candidate definition of media found by provider search, it can be imported with its IMDb id
+type Candidate struct {
+	Title  string `json:"title"`
+	Year   string `json:"year"`
+	Type   string `json:"type"`
+	ImdbID string `json:"imdbId"`
+	Poster string `json:"poster,omitempty"`
+}
+
+//CandidateList definition for paginated candidates of provider search
+type CandidateList struct {
+	Items    []Candidate `json:"items"`
+	Total    int         `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+	Next     string      `json:"next,omitempty"`
+	Prev     string      `json:"prev,omitempty"`
+}
+
+//omdbSearch definition of search response of OMDb
+type omdbSearch struct {
+	Search []struct {
+		Title  string `json:"Title"`
+		Year   string `json:"Year"`
+		ImdbID string `json:"imdbID"`
+		Type   string `json:"Type"`
+		Poster string `json:"Poster"`
+	} `json:"Search"`
+	TotalResults string `json:"totalResults"`
+}
+
+//Search looks up page of movies and series whose title contains query title, titles without results return empty page
+func (o *OMDb) Search(ctx context.Context, query SearchQuery) (CandidateList, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	result := CandidateList{Items: []Candidate{}, Page: query.Page, PageSize: SearchPageSize}
+	values := url.Values{"s": {query.Title}, "page": {strconv.Itoa(query.Page)}}
+	if query.Year > 0 {
+		values.Set("y", strconv.Itoa(query.Year))
+	}
+	if query.Type != "" {
+		values.Set("type", query.Type)
+	}
+	found := omdbSearch{}
+	if err := o.get(ctx, values, &found); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return result, nil
+		}
+		return result, err
+	}
+	result.Total, _ = strconv.Atoi(found.TotalResults)
+	for _, item := range found.Search {
+		candidate := Candidate{Title: item.Title, Year: item.Year, Type: item.Type, ImdbID: item.ImdbID, Poster: item.Poster}
+		if candidate.Poster == "N/A" {
+			candidate.Poster = ""
+		}
+		result.Items = append(result.Items, candidate)
+	}
+	return result, nil
+}
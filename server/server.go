@@ -10,13 +10,14 @@ import (
 	"github.com/jinzhu/gorm"
 
 	"scaleflixapi/config"
+	"scaleflixapi/data"
 	"scaleflixapi/logger"
 	"scaleflixapi/service"
 	"scaleflixapi/utils"
 )
 
-//DB database
-var DB *gorm.DB
+//Store storage backend
+var Store data.Store
 
 func handler(resp http.ResponseWriter, req *http.Request) {
 	utils.WriteResponse(resp, http.StatusNotImplemented, http.StatusText(http.StatusNotImplemented))
@@ -33,22 +34,46 @@ func SetupDB(dbName string) *gorm.DB {
 	sqlDB.SetConnMaxLifetime(time.Hour)
 	if err = sqlDB.Ping(); err != nil {
 		defer db.Close()
-		logger.Fatal.Fatalf("error, not sent ping to database, %w", err)
+		logger.Fatal.Fatalf("error, not sent ping to database, %v", err)
 	}
 
 	return db
 }
 
-//CloseDB closes the database
+//SetupStore creates storage backend with given driver, postgres or memory
+func SetupStore(driver, dbName string) data.Store {
+	switch driver {
+	case data.MemoryStore:
+		return data.NewMemoryStore()
+	case data.PostgresStore:
+		db := SetupDB(dbName)
+		if config.AutoMigrate == "true" {
+			applied, err := data.NewMigrator(db).Up()
+			if err != nil {
+				logger.Fatal.Fatalf("error, database is not migrated, %v", err)
+			}
+			for _, migration := range applied {
+				logger.Info.Printf("migration %d %s is applied", migration.Version, migration.Name)
+			}
+		}
+		return data.NewPostgresStore(db)
+	}
+	logger.Fatal.Fatalf("error, storage driver is not supported, %s", driver)
+	return nil
+}
+
+//CloseDB closes the storage backend
 func CloseDB() {
-	DB.Close()
+	if Store != nil {
+		Store.Close()
+	}
 }
 
 //NewServer creates scaleflix-api server with postgredb
 func NewServer() {
-	logger.Info.Println("db setup")
-	DB = SetupDB(config.DBName)
-	service := service.New(DB)
+	logger.Info.Printf("%s storage setup", config.Storage)
+	Store = SetupStore(config.Storage, config.DBName)
+	service := service.New(Store)
 
 	logger.Info.Println("Server starting")
 
@@ -62,14 +87,42 @@ func NewServer() {
 	r.HandleFunc("/series", service.AddSeries).Methods("POST")
 	r.HandleFunc("/movies/{id}", service.DeleteMediaByID).Methods("DELETE")
 	r.HandleFunc("/series/{id}", service.DeleteMediaByID).Methods("DELETE")
+	r.HandleFunc("/movies/{id}", service.UpdateMovie).Methods("PUT", "PATCH")
+	r.HandleFunc("/series/{id}", service.UpdateSeries).Methods("PUT", "PATCH")
+	r.HandleFunc("/series/{id}/seasons/{season}", service.GetSeason).Methods("GET")
+	r.HandleFunc("/series/{id}/seasons/{season}", service.SaveSeason).Methods("PUT", "PATCH")
+	r.HandleFunc("/series/{id}/seasons/{season}", service.DeleteSeason).Methods("DELETE")
+	r.HandleFunc("/series/{id}/seasons/{season}/episodes/{episode}", service.GetEpisode).Methods("GET")
+	r.HandleFunc("/series/{id}/seasons/{season}/episodes/{episode}", service.SaveEpisode).Methods("PUT", "PATCH")
+	r.HandleFunc("/series/{id}/seasons/{season}/episodes/{episode}", service.DeleteEpisode).Methods("DELETE")
+	r.HandleFunc("/people/{id}", service.GetPerson).Methods("GET")
+	r.HandleFunc("/genres/{slug}", service.GetGenre).Methods("GET")
 	r.HandleFunc("/suggestions", service.GetSuggestions).Methods("GET")
+	r.HandleFunc("/suggestions/search", service.SearchSuggestions).Methods("GET")
+	r.HandleFunc("/imports", service.ImportMedia).Methods("POST")
+	r.HandleFunc("/search", service.Search).Methods("GET")
+	r.HandleFunc("/admin/cache", service.GetMetadataCache).Methods("GET")
+	r.HandleFunc("/admin/cache", service.PurgeMetadataCache).Methods("DELETE")
 	r.HandleFunc("/token", service.GetToken).Methods("POST")
+	r.HandleFunc("/token/refresh", service.RefreshToken).Methods("POST")
+	r.HandleFunc("/logout", service.Logout).Methods("POST")
+	r.HandleFunc("/.well-known/jwks.json", service.JWKS).Methods("GET")
+	r.HandleFunc("/password", service.ChangePassword).Methods("PUT")
+	r.HandleFunc("/users", service.RegisterUser).Methods("POST")
+	r.HandleFunc("/users", service.GetUsers).Methods("GET")
+	r.HandleFunc("/users/{id}", service.GetUserByID).Methods("GET")
+	r.HandleFunc("/users/{id}", service.UpdateUser).Methods("PATCH")
+	r.HandleFunc("/users/{id}", service.DeactivateUser).Methods("DELETE")
+	r.HandleFunc("/users/{id}/favorites", service.GetUserFavorites).Methods("GET")
+	r.HandleFunc("/password/reset", service.CreatePasswordReset).Methods("POST")
+	r.HandleFunc("/password/reset/confirm", service.ResetPassword).Methods("POST")
 	r.HandleFunc("/favorites", service.AddFavorite).Methods("POST")
 	r.HandleFunc("/favorites", service.GetFavorites).Methods("GET")
 	r.HandleFunc("/favorites/{id}", service.DeleteFavoriteByID).Methods("DELETE")
 
 	r.MethodNotAllowedHandler = service.CheckCors()
 	logger.Info.Printf("Server started %s", config.APIPort)
+	r.Use(service.RequestID)
 	r.Use(service.Authorize)
 
 	srv := &http.Server{
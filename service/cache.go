@@ -0,0 +1,80 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	types "scaleflixapi/errors"
+	"scaleflixapi/metadata"
+	"scaleflixapi/utils"
+	"strings"
+)
+
+//CachePurge definition of purged metadata cache entries
+type CachePurge struct {
+	Purged int `json:"purged"`
+}
+
+//metadataCache returns metadata cache of service, writes not found response when lookups are not cached
+func (s *service) metadataCache(resp http.ResponseWriter, req *http.Request) (*metadata.Cache, bool) {
+	cache, ok := s.Metadata.(*metadata.Cache)
+	if !ok {
+		writeError(resp, req, types.NewNotFound(types.CodeNotFound, fmt.Sprintf(types.KeyNotFound, "metadata cache")))
+	}
+	return cache, ok
+}
+
+// swagger:route GET /admin/cache cache
+// Gets hit and miss counters and count of entries of metadata cache as admin
+// responses:
+// 200: StatusOK
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+
+//GetMetadataCache gets metadata cache counters service
+func (s *service) GetMetadataCache(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	cache, ok := s.metadataCache(resp, req)
+	if !ok {
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, cache.Stats())
+}
+
+// swagger:route DELETE /admin/cache cache
+// Purges metadata cache entries of title or of imdbId with its seasons and the titles and searches resolving to it as admin, all=true purges all entries
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+
+//PurgeMetadataCache purges metadata cache entries service
+func (s *service) PurgeMetadataCache(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	cache, ok := s.metadataCache(resp, req)
+	if !ok {
+		return
+	}
+	query := req.URL.Query()
+	title, imdbID := strings.TrimSpace(query.Get("title")), strings.TrimSpace(query.Get("imdbId"))
+	var purged int
+	var err error
+	switch {
+	case title != "" || imdbID != "":
+		purged, err = cache.Purge(title, imdbID)
+	case query.Get("all") == "true":
+		purged, err = cache.PurgeAll()
+	default:
+		writeError(resp, req, types.NewValidation(types.CodePurgeSelectorRequired, types.PurgeSelectorRequired))
+		return
+	}
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, CachePurge{Purged: purged})
+}
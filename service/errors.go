@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"scaleflixapi/data"
+	types "scaleflixapi/errors"
+	"scaleflixapi/logger"
+	"scaleflixapi/metadata"
+	"scaleflixapi/utils"
+
+	"github.com/gorilla/mux"
+)
+
+//RequestIDHeader header of request id, ids given by clients are kept
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDKey contextKey = "requestID"
+
+//RequestID sets request id of request context and response header
+func (s *service) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		id := requestID(req)
+		resp.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), requestIDKey, id)))
+	})
+}
+
+//requestID returns request id from context or header, new id is created when both are empty
+func requestID(req *http.Request) string {
+	if id, ok := req.Context().Value(requestIDKey).(string); ok {
+		return id
+	}
+	if id := req.Header.Get(RequestIDHeader); id != "" && len(id) <= 128 {
+		return id
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		logger.Error.Println(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+//metadataError converts failed metadata lookup of key, missing media is not found error and others are upstream errors
+func metadataError(err error, key string) error {
+	if errors.Is(err, metadata.ErrNotFound) {
+		return types.NewNotFound(types.CodeNotFound, fmt.Sprintf(types.KeyNotFound, key))
+	}
+	return types.NewUpstream(types.CodeUpstreamFailed, fmt.Sprintf(types.UpstreamFailed, "omdbapi"), err)
+}
+
+//writeError writes problem response of err, internal errors are logged and their details are hidden
+func writeError(resp http.ResponseWriter, req *http.Request, err error) {
+	var typed *types.Error
+	if !errors.As(err, &typed) && errors.Is(err, data.ErrNotFound) {
+		err = types.NewNotFound(types.CodeNotFound, fmt.Sprintf(types.KeyNotFound, mux.Vars(req)["id"]))
+	}
+	id := requestID(req)
+	if resp.Header().Get(RequestIDHeader) == "" {
+		resp.Header().Set(RequestIDHeader, id)
+	}
+	problem := types.NewProblem(err, req.URL.Path, id)
+	if problem.Status >= http.StatusInternalServerError {
+		cause := types.From(err).Err
+		if cause == nil {
+			cause = err
+		}
+		logger.Error.Printf("request %s failed: %v", id, cause)
+	}
+	utils.WriteProblem(resp, problem)
+}
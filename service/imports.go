@@ -0,0 +1,76 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"scaleflixapi/data"
+	types "scaleflixapi/errors"
+	"scaleflixapi/metadata"
+	"scaleflixapi/utils"
+)
+
+//ImportRequest definition of import, one of imdbId and title is required
+type ImportRequest struct {
+	ImdbID string `json:"imdbId"`
+	Title  string `json:"title"`
+	DryRun bool   `json:"dryRun"`
+}
+
+//Import definition of import response, failures list seasons and episodes that could not be looked up
+type Import struct {
+	data.ImportResult
+	Failures []metadata.Failure `json:"failures,omitempty"`
+}
+
+// swagger:route POST /imports with body
+// Imports movie or series with seasons and episodes from OMDb given imdbId or title as admin, dryRun returns media without storing it
+// responses:
+// 200: StatusOK
+// 201: StatusCreated
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+// 502: StatusBadGateway UpstreamFailed
+
+//ImportMedia imports media from metadata provider service
+func (s *service) ImportMedia(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	request := ImportRequest{}
+	if err = json.Unmarshal(body, &request); err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	if (request.ImdbID == "") == (request.Title == "") {
+		writeError(resp, req, types.NewValidation(types.CodeKeyRequired, types.KeyRequired))
+		return
+	}
+	suggestion, err := FetchMedia(req.Context(), s.Data, s.Metadata, request.Title, request.ImdbID)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	if len(suggestion.Failures) > 0 && !request.DryRun {
+		writeError(resp, req, types.NewUpstream(types.CodeImportIncomplete, fmt.Sprintf(types.ImportIncomplete, len(suggestion.Failures)), nil))
+		return
+	}
+	result, err := s.Data.ImportMedia(suggestion.Media, request.DryRun)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	status := http.StatusOK
+	if result.Status == data.ImportCreated {
+		status = http.StatusCreated
+	}
+	utils.WriteResponse(resp, status, Import{ImportResult: result, Failures: suggestion.Failures})
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"net/http"
+	"scaleflixapi/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// swagger:route GET /people/{id} people
+// Gets person given id with movies, series and episodes credited to person, paginated with page and pageSize
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 404: StatusNotFound KeyNotFound
+
+//GetPerson gets person with credits service
+func (s *service) GetPerson(resp http.ResponseWriter, req *http.Request) {
+	page, err := pageFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	credits, err := s.Data.GetPerson(mux.Vars(req)["id"], page)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	credits.Next, credits.Prev = pageLinks(req, page, credits.Total)
+	utils.WriteResponse(resp, http.StatusOK, credits)
+}
+
+// swagger:route GET /genres/{slug} genres
+// Gets genre given slug with movies, series and episodes of genre, paginated with page and pageSize
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 404: StatusNotFound KeyNotFound
+
+//GetGenre gets genre with media service
+func (s *service) GetGenre(resp http.ResponseWriter, req *http.Request) {
+	page, err := pageFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	media, err := s.Data.GetGenre(mux.Vars(req)["slug"], page)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	media.Next, media.Prev = pageLinks(req, page, media.Total)
+	utils.WriteResponse(resp, http.StatusOK, media)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"scaleflixapi/data"
+	types "scaleflixapi/errors"
+)
+
+//Principal describes authenticated user of request, claims are verified claims of access token
+type Principal struct {
+	UserID uint
+	Email  string
+	Role   string
+	Claims data.TokenClaims
+}
+
+//contextKey describes keys of request context values
+type contextKey string
+
+//principalKey is context key of authenticated principal
+const principalKey contextKey = "principal"
+
+//WithPrincipal returns context carrying principal
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+//PrincipalFromContext returns authenticated principal of context
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(Principal)
+	return principal, ok
+}
+
+//requireUser writes unauthorized response and returns false when request has no principal with user id
+func requireUser(resp http.ResponseWriter, req *http.Request) (Principal, bool) {
+	principal, ok := requirePrincipal(resp, req)
+	if ok && principal.UserID == 0 {
+		writeError(resp, req, types.NewUnauthorized(types.CodeUserRequired, types.UserRequired))
+		return principal, false
+	}
+	return principal, ok
+}
+
+//IsAdmin checks principal has admin role
+func (p Principal) IsAdmin() bool {
+	return p.Role == data.RoleAdmin
+}
+
+//principalFromClaims creates principal from token claims, role must be user or admin
+func principalFromClaims(claims data.TokenClaims) (Principal, error) {
+	if claims.Role != data.RoleAdmin && claims.Role != data.RoleUser {
+		return Principal{}, types.NewUnauthorized(types.CodeInvalidToken, types.RoleNotImplemented)
+	}
+	return Principal{UserID: claims.UserID, Email: claims.Email, Role: claims.Role, Claims: claims}, nil
+}
+
+//requireAdmin writes forbidden response and returns false when principal of request is not admin
+func requireAdmin(resp http.ResponseWriter, req *http.Request) bool {
+	if principal, ok := PrincipalFromContext(req.Context()); ok && principal.IsAdmin() {
+		return true
+	}
+	writeError(resp, req, types.NewForbidden(types.CodeNotAllowed, types.NotAllowedAction))
+	return false
+}
+
+//requirePrincipal writes unauthorized response and returns false when request is not authenticated
+func requirePrincipal(resp http.ResponseWriter, req *http.Request) (Principal, bool) {
+	principal, ok := PrincipalFromContext(req.Context())
+	if !ok {
+		writeError(resp, req, types.NewUnauthorized(types.CodeNoToken, types.NoTokenFound))
+	}
+	return principal, ok
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	types "scaleflixapi/errors"
+	"scaleflixapi/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// swagger:route GET /series/{id}/seasons/{season} seasons
+// Gets season with episodes given series id and season number
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 404: StatusNotFound KeyNotFound
+
+//GetSeason gets season service
+func (s *service) GetSeason(resp http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	season, err := s.Data.GetSeason(params["id"], params["season"])
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, season)
+}
+
+// swagger:route PUT /series/{id}/seasons/{season} with body
+// Adds season with episodes or replaces season fields as admin, PATCH merges body as JSON Merge Patch, episodes are changed with episode routes
+// responses:
+// 200: StatusOK
+// 201: StatusCreated
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+// 412: StatusPreconditionFailed
+
+//SaveSeason adds or updates season service
+func (s *service) SaveSeason(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	params := mux.Vars(req)
+	season, created, err := s.Data.SaveSeason(params["id"], params["season"], body, req.Method == http.MethodPatch, req.Header.Get("If-Match"))
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, savedStatus(created), season)
+}
+
+// swagger:route DELETE /series/{id}/seasons/{season} seasons
+// Deletes season with its episodes as admin
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+// 412: StatusPreconditionFailed
+
+//DeleteSeason deletes season service
+func (s *service) DeleteSeason(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	params := mux.Vars(req)
+	err := s.Data.DeleteSeason(params["id"], params["season"], req.Header.Get("If-Match"))
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, "Succesfully deleted")
+}
+
+// swagger:route GET /series/{id}/seasons/{season}/episodes/{episode} episodes
+// Gets episode with content given series id, season number and episode number
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 404: StatusNotFound KeyNotFound
+
+//GetEpisode gets episode service
+func (s *service) GetEpisode(resp http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	episode, err := s.Data.GetEpisode(params["id"], params["season"], params["episode"])
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, episode)
+}
+
+// swagger:route PUT /series/{id}/seasons/{season}/episodes/{episode} with body
+// Adds episode or replaces episode and its content as admin, PATCH merges body as JSON Merge Patch
+// responses:
+// 200: StatusOK
+// 201: StatusCreated
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+// 412: StatusPreconditionFailed
+
+//SaveEpisode adds or updates episode service
+func (s *service) SaveEpisode(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	params := mux.Vars(req)
+	episode, created, err := s.Data.SaveEpisode(params["id"], params["season"], params["episode"], body, req.Method == http.MethodPatch, req.Header.Get("If-Match"))
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, savedStatus(created), episode)
+}
+
+// swagger:route DELETE /series/{id}/seasons/{season}/episodes/{episode} episodes
+// Deletes episode with its content as admin
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+// 412: StatusPreconditionFailed
+
+//DeleteEpisode deletes episode service
+func (s *service) DeleteEpisode(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	params := mux.Vars(req)
+	err := s.Data.DeleteEpisode(params["id"], params["season"], params["episode"], req.Header.Get("If-Match"))
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, "Succesfully deleted")
+}
+
+//savedStatus returns status of put request, created records return 201
+func savedStatus(created bool) int {
+	if created {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
@@ -1,22 +1,19 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"net/url"
-	"scaleflixapi/config"
 	"scaleflixapi/data"
 	types "scaleflixapi/errors"
-	"scaleflixapi/logger"
+	"scaleflixapi/metadata"
 	"scaleflixapi/utils"
 	"strconv"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
-	"github.com/jinzhu/gorm"
 )
 
 //Manager describes service interface
@@ -28,24 +25,66 @@ type Manager interface {
 	AddSeries(resp http.ResponseWriter, req *http.Request)
 	GetSeriesByID(resp http.ResponseWriter, req *http.Request)
 	GetSuggestions(resp http.ResponseWriter, req *http.Request)
+	SearchSuggestions(resp http.ResponseWriter, req *http.Request)
+	ImportMedia(resp http.ResponseWriter, req *http.Request)
+	Search(resp http.ResponseWriter, req *http.Request)
 	DeleteMediaByID(resp http.ResponseWriter, req *http.Request)
 	GetToken(resp http.ResponseWriter, req *http.Request)
+	RefreshToken(resp http.ResponseWriter, req *http.Request)
+	Logout(resp http.ResponseWriter, req *http.Request)
+	JWKS(resp http.ResponseWriter, req *http.Request)
+	ChangePassword(resp http.ResponseWriter, req *http.Request)
+	CreatePasswordReset(resp http.ResponseWriter, req *http.Request)
+	ResetPassword(resp http.ResponseWriter, req *http.Request)
+	RegisterUser(resp http.ResponseWriter, req *http.Request)
+	GetUsers(resp http.ResponseWriter, req *http.Request)
+	GetUserByID(resp http.ResponseWriter, req *http.Request)
+	UpdateUser(resp http.ResponseWriter, req *http.Request)
+	DeactivateUser(resp http.ResponseWriter, req *http.Request)
 	Authorize(next http.Handler) http.Handler
+	RequestID(next http.Handler) http.Handler
 	CheckCors() http.Handler
 	GetFavorites(resp http.ResponseWriter, req *http.Request)
 	AddFavorite(resp http.ResponseWriter, req *http.Request)
 	DeleteFavoriteByID(resp http.ResponseWriter, req *http.Request)
+	GetUserFavorites(resp http.ResponseWriter, req *http.Request)
+	UpdateMovie(resp http.ResponseWriter, req *http.Request)
+	UpdateSeries(resp http.ResponseWriter, req *http.Request)
+	GetSeason(resp http.ResponseWriter, req *http.Request)
+	SaveSeason(resp http.ResponseWriter, req *http.Request)
+	DeleteSeason(resp http.ResponseWriter, req *http.Request)
+	GetEpisode(resp http.ResponseWriter, req *http.Request)
+	SaveEpisode(resp http.ResponseWriter, req *http.Request)
+	DeleteEpisode(resp http.ResponseWriter, req *http.Request)
+	GetPerson(resp http.ResponseWriter, req *http.Request)
+	GetGenre(resp http.ResponseWriter, req *http.Request)
+	GetMetadataCache(resp http.ResponseWriter, req *http.Request)
+	PurgeMetadataCache(resp http.ResponseWriter, req *http.Request)
+}
+
+//publicRoutes can be requested without token, keys are method and path
+var publicRoutes = map[string]bool{
+	"POST /token":                  true,
+	"POST /token/refresh":          true,
+	"POST /password/reset/confirm": true,
+	"POST /users":                  true,
+	"GET /.well-known/jwks.json":   true,
 }
 
 //service describes properties for api
 type service struct {
-	Data    data.Manager
-	isAdmin bool
+	Data     data.Manager
+	Metadata metadata.Client
+}
+
+//New creates new service with given storage backend, metadata is looked up with OMDb client of config
+func New(store data.Store) Manager {
+	return NewWithMetadata(store, metadata.New())
 }
 
-//New creates new service
-func New(db *gorm.DB) Manager {
-	return &service{Data: data.New(db)}
+//NewWithMetadata creates new service with given storage backend and metadata client
+func NewWithMetadata(store data.Store, client metadata.Client) Manager {
+	return &service{Data: data.New(store), Metadata: client}
 }
 
 // swagger:route POST /movies with body
@@ -57,44 +96,52 @@ func New(db *gorm.DB) Manager {
 
 //AddMovie adds movie service
 func (s *service) AddMovie(resp http.ResponseWriter, req *http.Request) {
-	if !s.isAdmin {
-		utils.WriteResponse(resp, http.StatusForbidden, types.NotAllowedAction)
+	if !requireAdmin(resp, req) {
 		return
 	}
 	defer req.Body.Close()
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		resStr := fmt.Sprintf("Reading body failed: %s", err)
-		logger.Error.Println(resStr)
-		utils.WriteResponse(resp, http.StatusBadRequest, resStr)
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
 		return
 	}
 	err = s.Data.AddMovie(body)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+		writeError(resp, req, err)
+		return
 	}
 	utils.WriteResponse(resp, http.StatusCreated, http.StatusText(http.StatusCreated))
 }
 
 // swagger:route GET /movies movieslist
-// Gets movies from database filters name and genre
+// Gets movies from database with title, genre, year, rating and credit filters, sorted with sort, paginated with page and pageSize
 // responses:
 // 200: StatusOK
 // 400: StatusBadRequest
 
 //GetMovies gets movies service
 func (s *service) GetMovies(resp http.ResponseWriter, req *http.Request) {
-	var name, genre string
-	if key, ok := req.URL.Query()["name"]; ok {
-		name = key[0]
+	filter, err := filterFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	order, err := data.ParseSort(req.URL.Query().Get("sort"))
+	if err != nil {
+		writeError(resp, req, err)
+		return
 	}
-	if key, ok := req.URL.Query()["genre"]; ok {
-		genre = key[0]
+	page, err := pageFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
+		return
 	}
-	media, err := s.Data.GetMovies(name, genre)
+	media, err := s.Data.GetMovies(filter, order, page)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+		writeError(resp, req, err)
+		return
 	}
+	media.Next, media.Prev = pageLinks(req, page, media.Total)
 	utils.WriteResponse(resp, http.StatusOK, media)
 
 }
@@ -103,44 +150,50 @@ func (s *service) GetMovies(resp http.ResponseWriter, req *http.Request) {
 // Gets movie from database given id
 // responses:
 // 200: StatusOK
+// 304: StatusNotModified
 // 400: StatusBadRequest
+// 404: StatusNotFound KeyNotFound
+// 500: StatusInternalServerError
 
 //GetMovieByID gets movie by id service
 func (s *service) GetMovieByID(resp http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
 	key, ok := params["id"]
 	if !ok {
-		utils.WriteResponse(resp, http.StatusBadRequest, types.KeyRequired)
+		writeError(resp, req, types.NewValidation(types.CodeKeyRequired, types.KeyRequired))
 		return
 	}
 	movie, err := s.Data.GetMovieByID(key)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, types.KeyRequired)
+		writeError(resp, req, err)
 		return
 	}
-	utils.WriteResponse(resp, http.StatusOK, movie)
+	writeMedia(resp, req, movie)
 }
 
 // swagger:route GET /series/id serie
 // Gets serie from database given id
 // responses:
 // 200: StatusOK
+// 304: StatusNotModified
 // 400: StatusBadRequest
+// 404: StatusNotFound KeyNotFound
+// 500: StatusInternalServerError
 
 //GetSeriesByID gets serie by id service
 func (s *service) GetSeriesByID(resp http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
 	key, ok := params["id"]
 	if !ok {
-		utils.WriteResponse(resp, http.StatusBadRequest, types.KeyRequired)
+		writeError(resp, req, types.NewValidation(types.CodeKeyRequired, types.KeyRequired))
 		return
 	}
 	series, err := s.Data.GetSeriesByID(key)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, types.KeyRequired)
+		writeError(resp, req, err)
 		return
 	}
-	utils.WriteResponse(resp, http.StatusOK, series)
+	writeMedia(resp, req, series)
 }
 
 // swagger:route POST /series with body
@@ -152,136 +205,206 @@ func (s *service) GetSeriesByID(resp http.ResponseWriter, req *http.Request) {
 
 //AddSeries adds simple series service
 func (s *service) AddSeries(resp http.ResponseWriter, req *http.Request) {
-	if !s.isAdmin {
-		utils.WriteResponse(resp, http.StatusForbidden, types.NotAllowedAction)
+	if !requireAdmin(resp, req) {
 		return
 	}
 	defer req.Body.Close()
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		resStr := fmt.Sprintf("Reading body failed: %s", err)
-		logger.Error.Println(resStr)
-		utils.WriteResponse(resp, http.StatusBadRequest, resStr)
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
 		return
 	}
 	err = s.Data.AddSeries(body)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+		writeError(resp, req, err)
+		return
 	}
 	utils.WriteResponse(resp, http.StatusCreated, http.StatusText(http.StatusCreated))
 }
 
 // swagger:route GET /series serieslist
-// Gets series from database filters name and genre
+// Gets series from database with title, genre, year, rating and credit filters, sorted with sort, paginated with page and pageSize
 // responses:
 // 200: StatusOK
 // 400: StatusBadRequest
 
 //GetSeries gets series service
 func (s *service) GetSeries(resp http.ResponseWriter, req *http.Request) {
-	var name, genre string
-	if key, ok := req.URL.Query()["name"]; ok {
-		name = key[0]
+	filter, err := filterFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
+		return
 	}
-	if key, ok := req.URL.Query()["genre"]; ok {
-		genre = key[0]
+	order, err := data.ParseSort(req.URL.Query().Get("sort"))
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	page, err := pageFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
+		return
 	}
 
-	media, err := s.Data.GetSeries(name, genre)
+	media, err := s.Data.GetSeries(filter, order, page)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+		writeError(resp, req, err)
 		return
 	}
+	media.Next, media.Prev = pageLinks(req, page, media.Total)
 	utils.WriteResponse(resp, http.StatusOK, media)
 
 }
 
+// swagger:route GET /search search
+// Searches movies, series and episodes from database given q, filters type, ranked by relevance
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+
+//Search searches media service
+func (s *service) Search(resp http.ResponseWriter, req *http.Request) {
+	text := strings.TrimSpace(req.URL.Query().Get("q"))
+	if text == "" {
+		writeError(resp, req, types.NewValidation(types.CodeSearchQueryRequired, types.SearchQueryRequired))
+		return
+	}
+	mediaTypes := []data.MediaType{}
+	for _, value := range req.URL.Query()["type"] {
+		for _, name := range strings.Split(value, ",") {
+			mediaType, ok := data.ParseMediaType(name)
+			if !ok {
+				writeError(resp, req, types.NewValidation(types.CodeInvalidMediaType, fmt.Sprintf(types.InvalidMediaType, name)))
+				return
+			}
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	page, err := pageFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	result, err := s.Data.Search(text, mediaTypes, page)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	result.Next, result.Prev = pageLinks(req, page, result.Total)
+	utils.WriteResponse(resp, http.StatusOK, result)
+}
+
 // swagger:route GET /suggestions api
-// Gets fovarites from database given userId filter name and genre
+// Gets movie or series with seasons and episodes from OMDb given exact title name as admin, failures lists seasons and episodes that could not be looked up
 // responses:
 // 200: StatusOK
 // 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+// 502: StatusBadGateway UpstreamFailed
 
 //GetSuggestions gets suggestions from api service
 func (s *service) GetSuggestions(resp http.ResponseWriter, req *http.Request) {
-	if !s.isAdmin {
-		utils.WriteResponse(resp, http.StatusForbidden, types.NotAllowedAction)
+	if !requireAdmin(resp, req) {
 		return
 	}
-	var name string
-	if key, ok := req.URL.Query()["name"]; ok {
-		name = url.QueryEscape(key[0])
-	}
+	name := req.URL.Query().Get("name")
 	if name == "" {
-		utils.WriteResponse(resp, http.StatusBadRequest, types.KeyRequired)
+		writeError(resp, req, types.NewValidation(types.CodeKeyRequired, types.KeyRequired))
 		return
 	}
-	apiResp, err := http.Get(fmt.Sprintf("http://www.omdbapi.com/?t=%s&apikey=%s", name, config.APIKey))
-	if utils.CheckError(err) {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+	suggestion, err := FetchMedia(req.Context(), s.Data, s.Metadata, name, "")
+	if err != nil {
+		writeError(resp, req, err)
 		return
 	}
-	defer apiResp.Body.Close()
-	body, err := ioutil.ReadAll(apiResp.Body)
-	if utils.CheckError(err) {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+	utils.WriteResponse(resp, http.StatusOK, suggestion)
+}
+
+// swagger:route GET /suggestions/search api
+// Searches movies and series on OMDb whose title contains name as admin, filtered with year and type movie or series, paginated with page of 10 candidates
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 502: StatusBadGateway UpstreamFailed
+
+//SearchSuggestions searches candidates of metadata provider service
+func (s *service) SearchSuggestions(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
 		return
 	}
-	gelen, err := s.Data.ConvertToAPIContent(body)
-	if utils.CheckError(err) {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+	query, err := searchQueryFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
 		return
 	}
-	if gelen.Type == "series" {
-		countSeason, err := strconv.Atoi(gelen.TotalSeasons)
-		if err != nil {
-			countSeason = 0
-		}
-
-		seasonsArr := make([]data.SeasonsAPIContent, 0, countSeason)
-		for i := 0; i < countSeason; i++ {
-			seasonsAPI, err := http.Get(fmt.Sprintf("http://www.omdbapi.com/?t=%s&season=%d&apikey=%s", name, i+1, config.APIKey))
-			if utils.CheckError(err) {
-				break
-			}
-			defer seasonsAPI.Body.Close()
-			bodySeasons, err := ioutil.ReadAll(seasonsAPI.Body)
-			if utils.CheckError(err) {
-				break
-			}
-			seasonsAPIContent, err := s.Data.ConvertToAPISeasonsContent(bodySeasons)
-			if utils.CheckError(err) {
-				break
-			}
+	candidates, err := s.Metadata.Search(req.Context(), query)
+	if errors.Is(err, metadata.ErrRejected) {
+		//OMDb rejects searches with too many results, e.g. names of one letter
+		writeError(resp, req, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "name")))
+		return
+	}
+	if err != nil {
+		writeError(resp, req, metadataError(err, query.Title))
+		return
+	}
+	page := data.Page{Offset: (query.Page - 1) * metadata.SearchPageSize, Size: metadata.SearchPageSize}
+	candidates.Next, candidates.Prev = pageLinks(req, page, candidates.Total)
+	if query.Page >= metadata.MaxSearchPage {
+		candidates.Next = ""
+	}
+	utils.WriteResponse(resp, http.StatusOK, candidates)
+}
 
-			for j := 0; j < len(seasonsAPIContent.Episodes); j++ {
-				episodeContentAPI, err := http.Get(fmt.Sprintf("http://www.omdbapi.com/?i=%s&apikey=%s", seasonsAPIContent.Episodes[j].ImdbID, config.APIKey))
-				if utils.CheckError(err) {
-					break
-				}
-				defer episodeContentAPI.Body.Close()
-				body, err := ioutil.ReadAll(episodeContentAPI.Body)
-				if utils.CheckError(err) {
-					break
-				}
-
-				episodeAPIContent, err := s.Data.ConvertToAPIContent(body)
-				if utils.CheckError(err) {
-					break
-				}
-
-				seasonsAPIContent.Episodes[j].EpisodeContent = episodeAPIContent
-			}
-			seasonsArr = append(seasonsArr, seasonsAPIContent)
+//searchQueryFromRequest parses name, year, type and page query parameters of provider search
+func searchQueryFromRequest(req *http.Request) (metadata.SearchQuery, error) {
+	values := req.URL.Query()
+	query := metadata.SearchQuery{Title: strings.TrimSpace(values.Get("name")), Type: values.Get("type"), Page: 1}
+	if query.Title == "" {
+		return query, types.NewValidation(types.CodeKeyRequired, types.KeyRequired)
+	}
+	if value := values.Get("year"); value != "" {
+		year, err := strconv.Atoi(value)
+		if err != nil || len(value) != 4 {
+			return query, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "year"))
 		}
-
-		series := s.Data.ConvertToMedia(gelen, seasonsArr)
-		utils.WriteResponse(resp, http.StatusOK, series)
-		return
+		query.Year = year
+	}
+	if query.Type != "" && query.Type != "movie" && query.Type != "series" {
+		return query, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "type"))
 	}
+	if value := values.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 || page > metadata.MaxSearchPage {
+			return query, types.NewValidation(types.CodeInvalidPage, types.InvalidPage)
+		}
+		query.Page = page
+	}
+	return query, nil
+}
 
-	media := s.Data.ConvertToMedia(gelen, nil)
-	utils.WriteResponse(resp, http.StatusOK, media)
+//FetchMedia looks up media given title or IMDb id with client and converts it with manager, seasons and episodes of series are looked up concurrently and failed lookups are listed in suggestion
+func FetchMedia(ctx context.Context, manager data.Manager, client metadata.Client, title, imdbID string) (metadata.Suggestion, error) {
+	var content data.MediaAPIContent
+	var err error
+	if imdbID != "" {
+		content, err = client.ByID(ctx, imdbID)
+	} else {
+		content, err = client.ByTitle(ctx, title)
+	}
+	if err != nil {
+		return metadata.Suggestion{}, metadataError(err, title+imdbID)
+	}
+	var seasons []data.SeasonsAPIContent
+	var failures []metadata.Failure
+	if content.Type == "series" {
+		seasons, failures, err = metadata.NewFetcher(client).FetchSeasons(ctx, content)
+		if err != nil {
+			return metadata.Suggestion{}, metadataError(err, title+imdbID)
+		}
+	}
+	return metadata.Suggestion{Media: manager.ConvertToMedia(content, seasons), Failures: failures}, nil
 }
 
 // swagger:route DELETE /movies/{id} with body
@@ -290,90 +413,264 @@ func (s *service) GetSuggestions(resp http.ResponseWriter, req *http.Request) {
 // 200: StatusOK
 // 400: StatusBadRequest
 // 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+// 412: StatusPreconditionFailed
+// 500: StatusInternalServerError
 
 //DeleteMediaByID gets movie by id service
 func (s *service) DeleteMediaByID(resp http.ResponseWriter, req *http.Request) {
-	if !s.isAdmin {
-		utils.WriteResponse(resp, http.StatusForbidden, types.NotAllowedAction)
+	if !requireAdmin(resp, req) {
 		return
 	}
 
 	params := mux.Vars(req)
 	key, ok := params["id"]
 	if !ok {
-		utils.WriteResponse(resp, http.StatusBadRequest, types.KeyRequired)
+		writeError(resp, req, types.NewValidation(types.CodeKeyRequired, types.KeyRequired))
 		return
 	}
-	err := s.Data.DeleteMediaByID(key)
-	if utils.CheckError(err) {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+	err := s.Data.DeleteMediaByID(key, req.Header.Get("If-Match"))
+	if err != nil {
+		writeError(resp, req, err)
 		return
 	}
 	utils.WriteResponse(resp, http.StatusOK, "Succesfully deleted")
 }
 
+// swagger:route PUT /movies/{id} with body
+// Replaces movie fields given id as admin, PATCH merges body as JSON Merge Patch, seasons are not changed
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+// 412: StatusPreconditionFailed
+
+//UpdateMovie updates movie service
+func (s *service) UpdateMovie(resp http.ResponseWriter, req *http.Request) {
+	s.updateMedia(resp, req, data.Movie)
+}
+
+// swagger:route PUT /series/{id} with body
+// Replaces series fields given id as admin, PATCH merges body as JSON Merge Patch, seasons are not changed
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound KeyNotFound
+// 412: StatusPreconditionFailed
+
+//UpdateSeries updates series service
+func (s *service) UpdateSeries(resp http.ResponseWriter, req *http.Request) {
+	s.updateMedia(resp, req, data.Series)
+}
+
+//updateMedia replaces or merge patches media of type given id
+func (s *service) updateMedia(resp http.ResponseWriter, req *http.Request, mediaType data.MediaType) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	media, err := s.Data.UpdateMedia(mediaType, mux.Vars(req)["id"], body, req.Method == http.MethodPatch, req.Header.Get("If-Match"))
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	writeMedia(resp, req, media)
+}
+
+//writeMedia writes media with ETag header, GET requests matching If-None-Match get 304
+func writeMedia(resp http.ResponseWriter, req *http.Request, media data.Media) {
+	etag := media.ETag()
+	resp.Header().Set("ETag", etag)
+	if req.Method == http.MethodGet && data.MatchETag(req.Header.Get("If-None-Match"), etag, true) {
+		utils.WriteNotModified(resp)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, media)
+}
+
 //GetToken gets token for given valid user information
 func (s *service) GetToken(resp http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, types.UsernamePasswordError)
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
 		return
 	}
 	token, err := s.Data.GetToken(body)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, types.UsernamePasswordError)
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, token)
+}
+
+// swagger:route PUT /password with body
+// Changes password of authenticated user given currentPassword and newPassword
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 401: StatusUnauthorized
+
+//ChangePassword changes password of authenticated user
+func (s *service) ChangePassword(resp http.ResponseWriter, req *http.Request) {
+	principal, ok := requirePrincipal(resp, req)
+	if !ok {
+		return
+	}
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	err = s.Data.ChangePassword(principal.Email, body)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, "Password changed")
+}
+
+// swagger:route POST /password/reset with body
+// Creates one-time password reset token for user given email
+// responses:
+// 201: StatusCreated
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+
+//CreatePasswordReset creates password reset token service
+func (s *service) CreatePasswordReset(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	token, err := s.Data.CreatePasswordReset(body)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusCreated, token)
+}
+
+// swagger:route POST /password/reset/confirm with body
+// Sets new password given one-time reset token and newPassword
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+
+//ResetPassword resets password with one-time token service
+func (s *service) ResetPassword(resp http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	err = s.Data.ResetPassword(body)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, "Password changed")
+}
+
+// swagger:route POST /token/refresh with body
+// Rotates refresh token and returns new access and refresh tokens
+// responses:
+// 200: StatusOK
+// 401: StatusUnauthorized
+
+//RefreshToken rotates refresh token service
+func (s *service) RefreshToken(resp http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	token, err := s.Data.RefreshTokens(body)
+	if err != nil {
+		writeError(resp, req, err)
 		return
 	}
 	utils.WriteResponse(resp, http.StatusOK, token)
 }
 
-//Authorize token is authorized and sets role of user
+// swagger:route POST /logout logout
+// Revokes access token and refresh tokens of its session
+// responses:
+// 200: StatusOK
+// 401: StatusUnauthorized
+
+//Logout revokes tokens service
+func (s *service) Logout(resp http.ResponseWriter, req *http.Request) {
+	principal, ok := requirePrincipal(resp, req)
+	if !ok {
+		return
+	}
+	err := s.Data.Logout(principal.Claims)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, "Succesfully logged out")
+}
+
+// swagger:route GET /.well-known/jwks.json jwks
+// Returns public keys verifying tokens
+// responses:
+// 200: StatusOK
+
+//JWKS publishes public signing keys service
+func (s *service) JWKS(resp http.ResponseWriter, req *http.Request) {
+	utils.WriteResponse(resp, http.StatusOK, s.Data.JWKS())
+}
+
+//Authorize token is authorized and sets principal of request context
 func (s *service) Authorize(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
 		resp.Header().Add("Vary", "Authorization")
 		tokenHeader := req.Header.Get("Authorization")
 
 		if tokenHeader == "" {
-			if req.URL.String() == "/token" {
+			if publicRoutes[req.Method+" "+req.URL.Path] {
 				next.ServeHTTP(resp, req)
 				return
 			}
-			utils.WriteResponse(resp, http.StatusUnauthorized, types.NoTokenFound)
+			writeError(resp, req, types.NewUnauthorized(types.CodeNoToken, types.NoTokenFound))
 			return
 		}
 		headerParts := strings.Split(tokenHeader, " ")
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			utils.WriteResponse(resp, http.StatusUnauthorized, types.InvalidAuthenticationTokenResponse)
+			writeError(resp, req, types.NewUnauthorized(types.CodeInvalidAuthorization, types.InvalidAuthenticationTokenResponse))
 			return
 		}
 
 		tokenPart := headerParts[1]
 
-		var mySigningKey = []byte(config.SecretKey)
-		token, err := jwt.Parse(tokenPart, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				logger.Error.Println(types.TokenParseError)
-				return nil, errors.New(types.TokenParseError)
-			}
-			return mySigningKey, nil
-		})
-
+		claims, err := s.Data.VerifyToken(tokenPart)
 		if err != nil {
-			utils.WriteResponse(resp, http.StatusUnauthorized, types.TokenExpired)
+			writeError(resp, req, err)
 			return
 		}
-
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			if claims["role"] == "admin" {
-				s.isAdmin = true
-			} else if claims["role"] == "user" {
-				s.isAdmin = false
-			} else {
-				utils.WriteResponse(resp, http.StatusUnauthorized, types.RoleNotImplemented)
-				return
-			}
+		principal, err := principalFromClaims(claims)
+		if err != nil {
+			writeError(resp, req, err)
+			return
 		}
+		req = req.WithContext(WithPrincipal(req.Context(), principal))
 		next.ServeHTTP(resp, req)
 	})
 }
@@ -390,75 +687,222 @@ func (s *service) CheckCors() http.Handler {
 }
 
 // swagger:route GET /favorites queryparams
-// Gets fovarites from database given userId filter name and genre
+// Gets fovarites of authenticated user from database with title, genre, year, rating and credit filters, sorted with sort, paginated with page and pageSize
 // responses:
 // 200: StatusOK
 // 400: StatusBadRequest
+// 401: StatusUnauthorized
 
-//GetFavorites gets favorites for user with filter
+//GetFavorites gets favorites for authenticated user with filter
 func (s *service) GetFavorites(resp http.ResponseWriter, req *http.Request) {
-	var name, genre, userID string
-	if key, ok := req.URL.Query()["name"]; ok {
-		name = key[0]
+	principal, ok := requireUser(resp, req)
+	if !ok {
+		return
+	}
+	s.writeFavorites(resp, req, strconv.Itoa(int(principal.UserID)))
+}
+
+// swagger:route GET /users/{id}/favorites with id and queryparams
+// Gets fovarites of user given id as admin, with same filters, sort and pagination as /favorites
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 403: StatusForbidden
+// 404: StatusNotFound
+
+//GetUserFavorites gets favorites for user given id as admin
+func (s *service) GetUserFavorites(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	id := mux.Vars(req)["id"]
+	if _, err := s.Data.GetUserByID(id); err != nil {
+		writeError(resp, req, err)
+		return
 	}
-	if key, ok := req.URL.Query()["genre"]; ok {
-		genre = key[0]
+	s.writeFavorites(resp, req, id)
+}
+
+//writeFavorites writes filtered, sorted and paginated favorites of user
+func (s *service) writeFavorites(resp http.ResponseWriter, req *http.Request, userID string) {
+	filter, err := filterFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
+		return
 	}
-	if key, ok := req.URL.Query()["userId"]; ok {
-		userID = key[0]
+	order, err := data.ParseSort(req.URL.Query().Get("sort"))
+	if err != nil {
+		writeError(resp, req, err)
+		return
 	}
-	if userID == "" {
-		utils.WriteResponse(resp, http.StatusBadRequest, types.UserRequired)
+	page, err := pageFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
+		return
 	}
-	favorites, err := s.Data.GetFavorites(userID, name, genre)
+	favorites, err := s.Data.GetFavorites(userID, filter, order, page)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+		writeError(resp, req, err)
+		return
 	}
+	favorites.Next, favorites.Prev = pageLinks(req, page, favorites.Total)
 	utils.WriteResponse(resp, http.StatusOK, favorites)
 }
 
 // swagger:route POST /favorites with jsonbody
-// Adds fovarite to database
+// Adds media given mediaId to fovarites of authenticated user
 // responses:
 // 201: StatusCreated
 // 400: StatusBadRequest
+// 401: StatusUnauthorized
+// 409: StatusConflict
 
-//AddFavorite adds favorite for user given mediaid
+//AddFavorite adds favorite for authenticated user given mediaid
 func (s *service) AddFavorite(resp http.ResponseWriter, req *http.Request) {
+	principal, ok := requireUser(resp, req)
+	if !ok {
+		return
+	}
 	defer req.Body.Close()
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		resStr := fmt.Sprintf("Reading body failed: %s", err)
-		logger.Error.Println(resStr)
-		utils.WriteResponse(resp, http.StatusBadRequest, resStr)
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
 		return
 	}
-	err = s.Data.AddFavorite(body)
+	favorite, err := s.Data.AddFavorite(principal.UserID, body)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+		writeError(resp, req, err)
+		return
 	}
-	utils.WriteResponse(resp, http.StatusCreated, http.StatusText(http.StatusCreated))
-
+	utils.WriteResponse(resp, http.StatusCreated, favorite)
 }
 
 // swagger:route DELETE /favorites/{id} with id
-// Deletes fovarite from database
+// Deletes fovarite of authenticated user from database
 // responses:
 // 200: StatusOK
 // 400: StatusBadRequest
+// 401: StatusUnauthorized
+// 404: StatusNotFound
 
-//DeleteFavoriteByID deletes favorites given id
+//DeleteFavoriteByID deletes favorite of authenticated user given id
 func (s *service) DeleteFavoriteByID(resp http.ResponseWriter, req *http.Request) {
+	principal, ok := requireUser(resp, req)
+	if !ok {
+		return
+	}
 	params := mux.Vars(req)
 	key, ok := params["id"]
 	if !ok {
-		utils.WriteResponse(resp, http.StatusBadRequest, types.KeyRequired)
+		writeError(resp, req, types.NewValidation(types.CodeKeyRequired, types.KeyRequired))
 		return
 	}
-	err := s.Data.DeleteFavoriteByID(key)
+	err := s.Data.DeleteFavoriteByID(principal.UserID, key)
 	if err != nil {
-		utils.WriteResponse(resp, http.StatusBadRequest, err)
+		writeError(resp, req, err)
 		return
 	}
 	utils.WriteResponse(resp, http.StatusOK, "Succesfully deleted")
 }
+
+//pageFromRequest parses page and pageSize query parameters, cursors are rejected since pages are offsets of current rows
+func pageFromRequest(req *http.Request) (data.Page, error) {
+	query := req.URL.Query()
+	if _, ok := query["cursor"]; ok {
+		return data.Page{}, types.NewValidation(types.CodeInvalidCursor, types.InvalidCursor)
+	}
+	number, size := 1, data.MaxPageSize()
+	var err error
+	if value := query.Get("page"); value != "" {
+		if number, err = strconv.Atoi(value); err != nil {
+			return data.Page{}, types.NewValidation(types.CodeInvalidPage, types.InvalidPage)
+		}
+	}
+	if value := query.Get("pageSize"); value != "" {
+		if size, err = strconv.Atoi(value); err != nil {
+			return data.Page{}, types.NewValidation(types.CodeInvalidPage, types.InvalidPage)
+		}
+	}
+	return data.NewPage(number, size)
+}
+
+//pageLinks creates next and prev links of page, links keep the request query
+func pageLinks(req *http.Request, page data.Page, total int) (string, string) {
+	link := func(p data.Page) string {
+		query := req.URL.Query()
+		query.Set("page", strconv.Itoa(p.Number()))
+		query.Set("pageSize", strconv.Itoa(p.Size))
+		return req.URL.Path + "?" + query.Encode()
+	}
+	var next, prev string
+	if page.HasNext(total) {
+		next = link(page.NextPage())
+	}
+	if page.HasPrev() {
+		prev = link(page.PrevPage())
+	}
+	return next, prev
+}
+
+//filterFromRequest parses media filter query parameters, name is kept as alias of title
+func filterFromRequest(req *http.Request) (data.MediaFilter, error) {
+	query := req.URL.Query()
+	filter := data.MediaFilter{
+		Title:    query.Get("title"),
+		Director: query.Get("director"),
+		Writer:   query.Get("writer"),
+		Star:     query.Get("star"),
+		Audio:    query.Get("audio"),
+		Subtitle: query.Get("subtitle"),
+	}
+	if filter.Title == "" {
+		filter.Title = query.Get("name")
+	}
+	for _, value := range query["genre"] {
+		for _, genre := range strings.Split(value, ",") {
+			if genre = strings.TrimSpace(genre); genre != "" {
+				filter.Genres = append(filter.Genres, genre)
+			}
+		}
+	}
+	switch query.Get("genreMatch") {
+	case "", "any":
+	case "all":
+		filter.MatchAllGenres = true
+	default:
+		return filter, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "genreMatch"))
+	}
+	var err error
+	if value := query.Get("yearFrom"); value != "" {
+		if filter.YearFrom, err = strconv.Atoi(value); err != nil || filter.YearFrom < 1 {
+			return filter, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "yearFrom"))
+		}
+	}
+	if value := query.Get("yearTo"); value != "" {
+		if filter.YearTo, err = strconv.Atoi(value); err != nil || filter.YearTo < 1 {
+			return filter, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "yearTo"))
+		}
+	}
+	if filter.YearFrom > 0 && filter.YearTo > 0 && filter.YearFrom > filter.YearTo {
+		return filter, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "yearFrom"))
+	}
+	if value := query.Get("minRating"); value != "" {
+		if filter.MinRating, err = strconv.ParseFloat(value, 64); err != nil || filter.MinRating < 0 || filter.MinRating > 10 {
+			return filter, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "minRating"))
+		}
+	}
+	if value := query.Get("minDuration"); value != "" {
+		if filter.MinDuration, err = strconv.Atoi(value); err != nil || filter.MinDuration < 1 {
+			return filter, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "minDuration"))
+		}
+	}
+	if value := query.Get("maxDuration"); value != "" {
+		if filter.MaxDuration, err = strconv.Atoi(value); err != nil || filter.MaxDuration < 1 {
+			return filter, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "maxDuration"))
+		}
+	}
+	if filter.MinDuration > 0 && filter.MaxDuration > 0 && filter.MinDuration > filter.MaxDuration {
+		return filter, types.NewValidation(types.CodeInvalidFilter, fmt.Sprintf(types.InvalidFilter, "minDuration"))
+	}
+	return filter, nil
+}
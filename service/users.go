@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	types "scaleflixapi/errors"
+	"scaleflixapi/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// swagger:route POST /users with body
+// Registers user with user role given name, email and password
+// responses:
+// 201: StatusCreated
+// 400: StatusBadRequest
+// 409: StatusConflict EmailAlreadyExists
+
+//RegisterUser registers user service
+func (s *service) RegisterUser(resp http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	user, err := s.Data.RegisterUser(body)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusCreated, user)
+}
+
+// swagger:route GET /users users
+// Gets users from database as admin, paginated with page and pageSize
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+
+//GetUsers gets users service
+func (s *service) GetUsers(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	page, err := pageFromRequest(req)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	users, err := s.Data.GetUsers(page)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	users.Next, users.Prev = pageLinks(req, page, users.Total)
+	utils.WriteResponse(resp, http.StatusOK, users)
+}
+
+// swagger:route GET /users/{id} users
+// Gets user from database given id as admin
+// responses:
+// 200: StatusOK
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound
+
+//GetUserByID gets user by id service
+func (s *service) GetUserByID(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	user, err := s.Data.GetUserByID(mux.Vars(req)["id"])
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, user)
+}
+
+// swagger:route PATCH /users/{id} with body
+// Changes name, role or active state of user as admin
+// responses:
+// 200: StatusOK
+// 400: StatusBadRequest
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound
+
+//UpdateUser updates user service
+func (s *service) UpdateUser(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, req, types.NewValidation(types.CodeInvalidBody, fmt.Sprintf(types.InvalidBody, err)))
+		return
+	}
+	user, err := s.Data.UpdateUser(mux.Vars(req)["id"], body)
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, user)
+}
+
+// swagger:route DELETE /users/{id} with id
+// Deactivates user given id as admin
+// responses:
+// 200: StatusOK
+// 403: StatusForbidden NotAllowedAction
+// 404: StatusNotFound
+
+//DeactivateUser deactivates user service
+func (s *service) DeactivateUser(resp http.ResponseWriter, req *http.Request) {
+	if !requireAdmin(resp, req) {
+		return
+	}
+	err := s.Data.DeactivateUser(mux.Vars(req)["id"])
+	if err != nil {
+		writeError(resp, req, err)
+		return
+	}
+	utils.WriteResponse(resp, http.StatusOK, "Succesfully deactivated")
+}
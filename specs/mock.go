@@ -1,7 +1,26 @@
 package specs
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"scaleflixapi/data"
+	"scaleflixapi/metadata"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 //CreateTestMovie for tests
@@ -96,3 +115,233 @@ func CreateUser() data.User {
 		Role:     "user",
 	}
 }
+
+//CreateLogin creates authentication body for given test user
+func CreateLogin(user data.User) data.Authentication {
+	return data.Authentication{
+		Email:    user.Email,
+		Password: user.Password,
+	}
+}
+
+//CreateSigningKeys writes RSA and EC private keys to dir and returns JWT_KEYS value with kids rsa and ec
+func CreateSigningKeys(dir string) (string, error) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	ecBytes, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		return "", err
+	}
+	rsaPath, ecPath := filepath.Join(dir, "rsa.pem"), filepath.Join(dir, "ec.pem")
+	err = ioutil.WriteFile(rsaPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), 0600)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(ecPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecBytes}), 0600)
+	if err != nil {
+		return "", err
+	}
+	return "rsa=" + rsaPath + ",ec=" + ecPath, nil
+}
+
+//ErrStorage storage failure returned by FailingStore
+var ErrStorage = errors.New("connection refused")
+
+//FailingStore wraps store and fails media lookups, deletes and user lookups by email with ErrStorage
+type FailingStore struct {
+	data.Store
+}
+
+//FindMediaByID fails with ErrStorage
+func (f FailingStore) FindMediaByID(mediaType data.MediaType, id uint) (data.Media, error) {
+	return data.Media{}, ErrStorage
+}
+
+//DeleteMedia fails with ErrStorage
+func (f FailingStore) DeleteMedia(id uint, version time.Time) error {
+	return ErrStorage
+}
+
+//FindUserByEmail fails with ErrStorage
+func (f FailingStore) FindUserByEmail(email string) (data.User, error) {
+	return data.User{}, ErrStorage
+}
+
+//FakeOMDbKey api key accepted by fake OMDb server
+const FakeOMDbKey = "test-key"
+
+//fakeSearchResults search results of fake OMDb server, searches of matrix return them
+var fakeSearchResults = func() []map[string]string {
+	results := []map[string]string{
+		{"Title": "The Matrix", "Year": "1999", "imdbID": "tt0133093", "Type": "movie", "Poster": "https://example.com/matrix.jpg"},
+		{"Title": "The Matrix Reloaded", "Year": "2003", "imdbID": "tt0234215", "Type": "movie", "Poster": "https://example.com/reloaded.jpg"},
+		{"Title": "The Matrix Revolutions", "Year": "2003", "imdbID": "tt0242653", "Type": "movie", "Poster": "https://example.com/revolutions.jpg"},
+		{"Title": "Matrix", "Year": "1993", "imdbID": "tt0106062", "Type": "series", "Poster": "N/A"},
+	}
+	for i := 1; i <= 8; i++ {
+		results = append(results, map[string]string{"Title": fmt.Sprintf("Matrix Fan Film %d", i), "Year": "2010", "imdbID": fmt.Sprintf("tt900000%d", i), "Type": "movie", "Poster": "N/A"})
+	}
+	return results
+}()
+
+//NewFakeOMDb creates fake OMDb server with movie The Matrix, series Severance with 2 seasons, a failing title broken and a slow title slow.
+//Searches of matrix return 12 results filtered with y and type, searches of one letter have too many results.
+func NewFakeOMDb() *httptest.Server {
+	write := func(resp http.ResponseWriter, status int, body interface{}) {
+		resp.Header().Set("Content-Type", "application/json")
+		resp.WriteHeader(status)
+		json.NewEncoder(resp).Encode(body)
+	}
+	episodes := map[string][]string{"1": {"tt1", "tt2"}, "2": {"tt3"}}
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if query.Get("apikey") != FakeOMDbKey {
+			write(resp, http.StatusUnauthorized, map[string]string{"Response": "False", "Error": "Invalid API key!"})
+			return
+		}
+		switch title, id, search := query.Get("t"), query.Get("i"), query.Get("s"); {
+		case len(search) == 1:
+			write(resp, http.StatusOK, map[string]string{"Response": "False", "Error": "Too many results."})
+		case strings.Contains(strings.ToLower(search), "matrix"):
+			results := []map[string]string{}
+			for _, result := range fakeSearchResults {
+				if (query.Get("y") == "" || query.Get("y") == result["Year"]) && (query.Get("type") == "" || query.Get("type") == result["Type"]) {
+					results = append(results, result)
+				}
+			}
+			page, _ := strconv.Atoi(query.Get("page"))
+			if page < 1 || len(results) <= (page-1)*10 {
+				write(resp, http.StatusOK, map[string]string{"Response": "False", "Error": "Movie not found!"})
+				return
+			}
+			total := len(results)
+			if len(results) > page*10 {
+				results = results[:page*10]
+			}
+			write(resp, http.StatusOK, map[string]interface{}{"Response": "True", "Search": results[(page-1)*10:], "totalResults": fmt.Sprint(total)})
+		case title == "Matrix" || id == "tt0133093":
+			write(resp, http.StatusOK, map[string]string{"Response": "True", "Type": "movie", "Title": "The Matrix", "imdbID": "tt0133093", "Year": "1999", "Runtime": "136 min", "imdbRating": "8.7", "Released": "31 Mar 1999", "Genre": "Action, Sci-Fi", "Actors": "Keanu Reeves, Laurence Fishburne"})
+		case title == "Severance" || (id == "tt11280740" && query.Get("season") == ""):
+			write(resp, http.StatusOK, map[string]string{"Response": "True", "Type": "series", "Title": "Severance", "imdbID": "tt11280740", "Year": "2022–", "totalSeasons": "2"})
+		case id == "tt11280740":
+			season := query.Get("season")
+			list := []map[string]string{}
+			for i, episode := range episodes[season] {
+				list = append(list, map[string]string{"Title": "Episode " + episode, "imdbID": episode, "Episode": fmt.Sprint(i + 1)})
+			}
+			write(resp, http.StatusOK, map[string]interface{}{"Response": "True", "Title": "Severance", "Season": season, "totalSeasons": "2", "Episodes": list})
+		case len(id) == 3:
+			write(resp, http.StatusOK, map[string]string{"Response": "True", "Type": "episode", "Title": "Episode " + id, "imdbID": id, "Runtime": "55 min"})
+		case title == "broken":
+			resp.WriteHeader(http.StatusInternalServerError)
+			resp.Write([]byte("<html>Internal Server Error</html>"))
+		case title == "slow":
+			select {
+			case <-req.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			write(resp, http.StatusOK, map[string]string{"Response": "True", "Type": "movie", "Title": "slow"})
+		default:
+			write(resp, http.StatusOK, map[string]string{"Response": "False", "Error": "Movie not found!"})
+		}
+	}))
+}
+
+//NewFakeOMDbClient creates OMDb client of fake OMDb server with api key and 200ms timeout
+func NewFakeOMDbClient(server *httptest.Server, apiKey string) metadata.Client {
+	return metadata.NewOMDb(server.URL, apiKey, 200*time.Millisecond, 200*time.Millisecond)
+}
+
+//FakeProvider metadata client of series with Seasons seasons of Episodes episodes, each lookup waits Latency.
+//Season lookups of season numbers and episode lookups of IMDb ids in Failing fail, MaxActive counts most concurrent lookups and Calls all lookups.
+type FakeProvider struct {
+	Seasons   int
+	Episodes  int
+	Latency   time.Duration
+	Failing   map[string]bool
+	mutex     sync.Mutex
+	active    int
+	MaxActive int
+	Calls     int
+}
+
+//Search finds fake series when its title contains query title
+func (p *FakeProvider) Search(ctx context.Context, query metadata.SearchQuery) (metadata.CandidateList, error) {
+	result := metadata.CandidateList{Items: []metadata.Candidate{}, Page: query.Page, PageSize: metadata.SearchPageSize}
+	if err := p.wait(ctx, query.Title); err != nil {
+		return result, err
+	}
+	if series := p.FakeSeries(); strings.Contains(strings.ToLower(series.Title), strings.ToLower(query.Title)) && query.Page <= 1 {
+		result.Items = append(result.Items, metadata.Candidate{Title: series.Title, Type: series.Type, ImdbID: series.ImdbID})
+		result.Total = 1
+	}
+	return result, nil
+}
+
+//FakeSeries series of fake provider
+func (p *FakeProvider) FakeSeries() data.MediaAPIContent {
+	return data.MediaAPIContent{Type: "series", Title: "Fake", ImdbID: "tt0", TotalSeasons: fmt.Sprint(p.Seasons)}
+}
+
+//ByTitle looks up fake series
+func (p *FakeProvider) ByTitle(ctx context.Context, title string) (data.MediaAPIContent, error) {
+	if err := p.wait(ctx, title); err != nil {
+		return data.MediaAPIContent{}, err
+	}
+	return p.FakeSeries(), nil
+}
+
+//ByID looks up fake series given its IMDb id tt0 or episode given other IMDb ids
+func (p *FakeProvider) ByID(ctx context.Context, imdbID string) (data.MediaAPIContent, error) {
+	if err := p.wait(ctx, imdbID); err != nil {
+		return data.MediaAPIContent{}, err
+	}
+	if imdbID == "tt0" {
+		return p.FakeSeries(), nil
+	}
+	return data.MediaAPIContent{Type: "episode", Title: "Episode " + imdbID, ImdbID: imdbID, Runtime: "50 min"}, nil
+}
+
+//Season looks up episodes of season, their IMDb ids are ep<season>-<episode>
+func (p *FakeProvider) Season(ctx context.Context, imdbID string, season int) (data.SeasonsAPIContent, error) {
+	if err := p.wait(ctx, fmt.Sprint(season)); err != nil {
+		return data.SeasonsAPIContent{}, err
+	}
+	result := data.SeasonsAPIContent{Season: fmt.Sprint(season), TotalSeasons: fmt.Sprint(p.Seasons)}
+	for i := 1; i <= p.Episodes; i++ {
+		id := fmt.Sprintf("ep%d-%d", season, i)
+		result.Episodes = append(result.Episodes, &data.EpisodesAPIContent{Title: "Episode " + id, ImdbID: id, EpisodesNumber: fmt.Sprint(i)})
+	}
+	return result, nil
+}
+
+//wait waits latency of lookup until ctx is done and fails lookups of failing keys
+func (p *FakeProvider) wait(ctx context.Context, key string) error {
+	p.mutex.Lock()
+	p.active++
+	p.Calls++
+	if p.active > p.MaxActive {
+		p.MaxActive = p.active
+	}
+	p.mutex.Unlock()
+	defer func() {
+		p.mutex.Lock()
+		p.active--
+		p.mutex.Unlock()
+	}()
+	select {
+	case <-ctx.Done():
+		return &metadata.Error{Kind: metadata.KindUnavailable, Err: ctx.Err()}
+	case <-time.After(p.Latency):
+	}
+	if p.Failing[key] {
+		return &metadata.Error{Kind: metadata.KindRejected, Message: "Error getting data."}
+	}
+	return nil
+}
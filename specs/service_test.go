@@ -2,29 +2,51 @@ package specs
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"scaleflixapi/cli"
 	"scaleflixapi/config"
 	"scaleflixapi/data"
+	types "scaleflixapi/errors"
+	"scaleflixapi/metadata"
 	"scaleflixapi/server"
 	"scaleflixapi/service"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
-
-	"github.com/jinzhu/gorm"
 )
 
-func initDB() *gorm.DB {
-	db := server.SetupDB(config.DBNameTest)
-	db.DropTableIfExists(&data.User{}, &data.Seasons{}, &data.Episodes{}, &data.Media{}, &data.UserMedia{})
-	db.AutoMigrate(&data.User{}, &data.Seasons{}, &data.Episodes{}, &data.Media{}, &data.UserMedia{})
+func initDB() data.Store {
+	var store data.Store
+	if config.StorageTest == data.PostgresStore {
+		db := server.SetupDB(config.DBNameTest)
+		migrator := data.NewMigrator(db)
+		if _, err := migrator.Down(0); err != nil {
+			panic(err)
+		}
+		if _, err := migrator.Up(); err != nil {
+			panic(err)
+		}
+		store = data.NewPostgresStore(db)
+	} else {
+		store = server.SetupStore(config.StorageTest, config.DBNameTest)
+	}
 	user := CreateAdminUser()
-	db.Create(&user)
+	store.CreateUser(&user)
 	user = CreateUser()
-	db.Create(&user)
-	return db
+	store.CreateUser(&user)
+	return store
 }
 func TestGetMovies(t *testing.T) {
 
@@ -47,21 +69,290 @@ func TestGetMovies(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	var response []data.Media
+	var response data.MediaList
 	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
 		t.Errorf("got invalid response, expected list of movies, got: %v", rr.Body.String())
 	}
-	if len(response) < 1 {
-		t.Errorf("expected at least 1 movie, got %v", len(response))
+	if len(response.Items) < 1 {
+		t.Errorf("expected at least 1 movie, got %v", len(response.Items))
 	}
 
-	for _, movie := range response {
+	for _, movie := range response.Items {
 		if movie.ID == 0 {
 			t.Errorf("expected movie id %d to  have a source path, was empty", movie.ID)
 		}
 	}
 }
 
+func TestGetMoviesPagination(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	byteMovie, _ := json.Marshal(CreateTestMovie())
+	for i := 0; i < 3; i++ {
+		data.New(db).AddMovie(byteMovie)
+	}
+	handler := http.HandlerFunc(s.GetMovies)
+
+	req, _ := http.NewRequest("GET", "/movies?pageSize=2", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var response data.MediaList
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("got invalid response, expected page of movies, got: %v", rr.Body.String())
+	}
+	if response.Total != 3 || len(response.Items) != 2 || response.Page != 1 {
+		t.Errorf("expected first page with 2 of 3 movies, got %d of %d on page %d", len(response.Items), response.Total, response.Page)
+	}
+	if response.Next != "/movies?page=2&pageSize=2" || response.Prev != "" {
+		t.Errorf("unexpected links next: %q prev: %q", response.Next, response.Prev)
+	}
+
+	req, _ = http.NewRequest("GET", response.Next, nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	response = data.MediaList{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("got invalid response, expected page of movies, got: %v", rr.Body.String())
+	}
+	if len(response.Items) != 1 || response.Items[0].ID != 3 || response.Page != 2 || response.Next != "" || response.Prev != "/movies?page=1&pageSize=2" {
+		t.Errorf("expected last page with movie 3 and prev link, got %v", rr.Body.String())
+	}
+
+	for _, query := range []string{"page=0", "pageSize=abc", "cursor=invalid", "cursor=eyJvIjoxLCJzIjoyfQ"} {
+		req, _ = http.NewRequest("GET", "/movies?"+query, nil)
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("`%v` handler returned wrong status code: got %v want %v", query, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGetMoviesFilters(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	movies := []data.Media{CreateTestMovie(), CreateTestMovie(), CreateTestMovie()}
+	movies[0].Title, movies[0].Year, movies[0].Rating, movies[0].Genre = "The Matrix", "1999", "8.7", "Action, Sci-Fi"
+	movies[1].Title, movies[1].Year, movies[1].Rating, movies[1].Genre = "Matrix Reloaded", "2003", "7.2", "Action"
+	movies[2].Title, movies[2].Year, movies[2].Rating, movies[2].Genre, movies[2].Audio = "Amelie", "2001", "N/A", "Comedy", "French"
+	movies[0].Director, movies[0].Stars = "Lana Wachowski, Lilly Wachowski", "Keanu Reeves, Carrie-Anne Moss"
+	for _, movie := range movies {
+		byteMovie, _ := json.Marshal(movie)
+		data.New(db).AddMovie(byteMovie)
+	}
+	testCases := map[string]struct {
+		query      string
+		statusCode int
+		total      int
+	}{
+		"partial title":    {"title=matrix", http.StatusOK, 2},
+		"name alias":       {"name=AMELIE", http.StatusOK, 1},
+		"any genre":        {"genre=Sci-Fi,Action", http.StatusOK, 2},
+		"all genres":       {"genre=Sci-Fi,Action&genreMatch=all", http.StatusOK, 1},
+		"year range":       {"yearFrom=2000&yearTo=2002", http.StatusOK, 1},
+		"min rating":       {"minRating=7.5", http.StatusOK, 1},
+		"audio language":   {"audio=french", http.StatusOK, 1},
+		"genre slug":       {"genre=sci%20fi", http.StatusOK, 1},
+		"partial genre":    {"genre=act", http.StatusOK, 0},
+		"all same genres":  {"genre=Action,action&genreMatch=all", http.StatusOK, 2},
+		"director":         {"director=lilly", http.StatusOK, 1},
+		"star":             {"star=MOSS", http.StatusOK, 1},
+		"two stars":        {"star=reeves,%20carrie", http.StatusOK, 0},
+		"star as director": {"director=keanu", http.StatusOK, 0},
+		"combined":         {"title=matrix&yearFrom=2000", http.StatusOK, 1},
+		"bad year":         {"yearFrom=abc", http.StatusBadRequest, 0},
+		"bad year range":   {"yearFrom=2005&yearTo=2000", http.StatusBadRequest, 0},
+		"bad rating":       {"minRating=11", http.StatusBadRequest, 0},
+		"bad genres match": {"genreMatch=some", http.StatusBadRequest, 0},
+	}
+	handler := http.HandlerFunc(s.GetMovies)
+
+	for tc, tp := range testCases {
+		req, _ := http.NewRequest("GET", "/movies?"+tp.query, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != tp.statusCode {
+			t.Errorf("`%v` failed, handler returned wrong status code: got %v want %v", tc, status, tp.statusCode)
+			continue
+		}
+		if tp.statusCode != http.StatusOK {
+			continue
+		}
+		var response data.MediaList
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Errorf("`%v` got invalid response, got: %v", tc, rr.Body.String())
+		}
+		if response.Total != tp.total {
+			t.Errorf("`%v` failed, expected %d movies, got %d", tc, tp.total, response.Total)
+		}
+	}
+
+	series := []data.Media{CreateTestSeries(), CreateTestSeries()}
+	series[0].Title, series[0].Year = "Ended Series", "1998–2004"
+	series[1].Title, series[1].Year = "Running Series", "2019–"
+	for _, item := range series {
+		byteSeries, _ := json.Marshal(item)
+		data.New(db).AddSeries(byteSeries)
+	}
+	seriesCases := map[string]struct {
+		query  string
+		titles []string
+	}{
+		"range inside series":   {"yearFrom=2000&yearTo=2002", []string{"Ended Series"}},
+		"range overlaps end":    {"yearFrom=2004&yearTo=2010", []string{"Ended Series"}},
+		"range after end":       {"yearFrom=2005&yearTo=2010", []string{}},
+		"running series":        {"yearFrom=2030", []string{"Running Series"}},
+		"range before start":    {"yearTo=1997", []string{}},
+		"range overlaps start":  {"yearFrom=1990&yearTo=1998", []string{"Ended Series"}},
+		"single year of series": {"yearFrom=2021&yearTo=2021", []string{"Running Series"}},
+	}
+	for tc, tp := range seriesCases {
+		req, _ := http.NewRequest("GET", "/series?"+tp.query, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.GetSeries).ServeHTTP(rr, req)
+		var response data.MediaList
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); rr.Code != http.StatusOK || err != nil {
+			t.Errorf("`%v` failed, got %v %v", tc, rr.Code, rr.Body.String())
+			continue
+		}
+		titles := []string{}
+		for _, item := range response.Items {
+			titles = append(titles, item.Title)
+		}
+		if fmt.Sprint(titles) != fmt.Sprint(tp.titles) {
+			t.Errorf("`%v` failed, expected %v, got %v", tc, tp.titles, titles)
+		}
+	}
+}
+
+func TestGetMoviesSort(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	movies := []data.Media{CreateTestMovie(), CreateTestMovie(), CreateTestMovie(), CreateTestMovie()}
+	movies[0].Title, movies[0].Year, movies[0].Rating = "b", "1999", "7.5"
+	movies[1].Title, movies[1].Year, movies[1].Rating = "a", "2003", "10"
+	movies[2].Title, movies[2].Year, movies[2].Rating = "C", "1999", "8.7"
+	movies[3].Title, movies[3].Year, movies[3].Rating = "d", "2001", "N/A"
+	for _, movie := range movies {
+		byteMovie, _ := json.Marshal(movie)
+		data.New(db).AddMovie(byteMovie)
+	}
+	testCases := map[string]struct {
+		query      string
+		statusCode int
+		titles     []string
+	}{
+		"rating desc":       {"sort=-rating", http.StatusOK, []string{"a", "C", "b", "d"}},
+		"year then title":   {"sort=year,-title", http.StatusOK, []string{"C", "b", "d", "a"}},
+		"title with page":   {"sort=title&page=2&pageSize=2", http.StatusOK, []string{"C", "d"}},
+		"no sort":           {"", http.StatusOK, []string{"b", "a", "C", "d"}},
+		"unknown sort":      {"sort=-plot", http.StatusBadRequest, nil},
+		"unknown sort desc": {"sort=title,+director", http.StatusBadRequest, nil},
+	}
+	handler := http.HandlerFunc(s.GetMovies)
+
+	for tc, tp := range testCases {
+		req, _ := http.NewRequest("GET", "/movies?"+tp.query, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != tp.statusCode {
+			t.Errorf("`%v` failed, handler returned wrong status code: got %v want %v", tc, status, tp.statusCode)
+			continue
+		}
+		if tp.statusCode != http.StatusOK {
+			var response struct {
+				Code    string   `json:"code"`
+				Field   string   `json:"field"`
+				Allowed []string `json:"allowed"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Code != types.CodeInvalidSort || response.Field == "" || len(response.Allowed) == 0 {
+				t.Errorf("`%v` expected structured sort error, got: %v", tc, rr.Body.String())
+			}
+			continue
+		}
+		var response data.MediaList
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Errorf("`%v` got invalid response, got: %v", tc, rr.Body.String())
+		}
+		titles := []string{}
+		for _, movie := range response.Items {
+			titles = append(titles, movie.Title)
+		}
+		if fmt.Sprint(titles) != fmt.Sprint(tp.titles) {
+			t.Errorf("`%v` failed, expected order %v, got %v", tc, tp.titles, titles)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	movie := CreateTestMovie()
+	movie.Title, movie.Description, movie.Stars = "The Matrix", "A hacker learns about the true nature of reality.", "Keanu Reeves"
+	byteMovie, _ := json.Marshal(movie)
+	data.New(db).AddMovie(byteMovie)
+	byteSeries, _ := json.Marshal(CreateTestSeries())
+	data.New(db).AddSeries(byteSeries)
+	movie = CreateTestMovie()
+	movie.Title, movie.Description, movie.Director = "Zebra & Co", `A <b>zebra</b> <script>alert("zebra")</script>`, "Zebra Director"
+	byteMovie, _ = json.Marshal(movie)
+	data.New(db).AddMovie(byteMovie)
+	testCases := map[string]struct {
+		query      string
+		statusCode int
+		titles     []string
+	}{
+		"escaped":      {"q=zebra", http.StatusOK, []string{"Zebra & Co"}},
+		"title":        {"q=matrix", http.StatusOK, []string{"The Matrix"}},
+		"typo":         {"q=matrx", http.StatusOK, []string{"The Matrix"}},
+		"credits":      {"q=keanu%20hacker", http.StatusOK, []string{"The Matrix"}},
+		"ranked":       {"q=episode", http.StatusOK, []string{"test Episode", "test Episode 2"}},
+		"type filter":  {"q=test&type=series", http.StatusOK, []string{"test Series"}},
+		"no match":     {"q=zzzzzz", http.StatusOK, []string{}},
+		"without q":    {"", http.StatusBadRequest, nil},
+		"invalid type": {"q=test&type=book", http.StatusBadRequest, nil},
+	}
+	handler := http.HandlerFunc(s.Search)
+
+	for tc, tp := range testCases {
+		req, _ := http.NewRequest("GET", "/search?"+tp.query, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != tp.statusCode {
+			t.Errorf("`%v` failed, handler returned wrong status code: got %v want %v", tc, status, tp.statusCode)
+			continue
+		}
+		if tp.statusCode != http.StatusOK {
+			continue
+		}
+		var response data.SearchList
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Errorf("`%v` got invalid response, got: %v", tc, rr.Body.String())
+		}
+		titles := []string{}
+		for _, item := range response.Items {
+			titles = append(titles, item.Media.Title)
+		}
+		if fmt.Sprint(titles) != fmt.Sprint(tp.titles) {
+			t.Errorf("`%v` failed, expected %v, got %v", tc, tp.titles, titles)
+		}
+		if tc == "credits" && response.Items[0].Highlights["description"] != "A <mark>hacker</mark> learns about the true nature of reality." {
+			t.Errorf("expected highlighted description, got %v", response.Items[0].Highlights)
+		}
+		if tc == "escaped" {
+			highlights := response.Items[0].Highlights
+			for _, field := range []string{"title", "director", "description"} {
+				if value := highlights[field]; !strings.Contains(value, "<mark>") || strings.Contains(value, "<b>") || strings.Contains(value, "<script>") || strings.Contains(value, " & ") {
+					t.Errorf("expected escaped highlight of %v, got %q", field, value)
+				}
+			}
+		}
+	}
+}
+
 func TestGetSeries(t *testing.T) {
 	req, err := http.NewRequest("GET", "/series", nil)
 	if err != nil {
@@ -82,15 +373,15 @@ func TestGetSeries(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	var response []data.Media
+	var response data.MediaList
 	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
 		t.Errorf("got invalid response, expected list of Series, got: %v", rr.Body.String())
 	}
-	if len(response) < 1 {
-		t.Errorf("expected at least 1 Serie, got %v", len(response))
+	if len(response.Items) < 1 {
+		t.Errorf("expected at least 1 Serie, got %v", len(response.Items))
 	}
 
-	for _, serie := range response {
+	for _, serie := range response.Items {
 		if serie.ID == 0 {
 			t.Errorf("expected Serie id %d to  have a source path, was empty", serie.ID)
 		}
@@ -160,130 +451,1971 @@ func TestGetMoviesById(t *testing.T) {
 
 }
 
-func TestAddMovie(t *testing.T) {
-	byteMovie, _ := json.Marshal(CreateTestMovie())
-	reader := bytes.NewReader(byteMovie)
+func TestMediaLookupErrors(t *testing.T) {
 	db := initDB()
+	byteMovie, _ := json.Marshal(CreateTestMovie())
+	data.New(db).AddMovie(byteMovie)
+	byteSeries, _ := json.Marshal(CreateTestSeries())
+	data.New(db).AddSeries(byteSeries)
 	s := service.New(db)
-	byteUser, _ := json.Marshal(CreateAdminUser())
-	token, _ := data.New(db).GetToken(byteUser)
-	req, err := http.NewRequest("POST", "/movies", reader)
-	if err != nil {
-		t.Fatal(err)
-	}
+	failing := service.New(FailingStore{db})
+	admin := service.Principal{UserID: 1, Role: data.RoleAdmin}
 
-	rr := httptest.NewRecorder()
+	testCases := []struct {
+		name       string
+		handler    http.HandlerFunc
+		method     string
+		id         string
+		statusCode int
+		code       string
+	}{
+		{"movie", s.GetMovieByID, "GET", "1", http.StatusOK, ""},
+		{"missing movie", s.GetMovieByID, "GET", "99", http.StatusNotFound, types.CodeNotFound},
+		{"series as movie", s.GetMovieByID, "GET", "2", http.StatusNotFound, types.CodeNotFound},
+		{"non-numeric movie id", s.GetMovieByID, "GET", "abc", http.StatusBadRequest, types.CodeKeyRequired},
+		{"negative movie id", s.GetMovieByID, "GET", "-1", http.StatusBadRequest, types.CodeKeyRequired},
+		{"zero movie id", s.GetMovieByID, "GET", "0", http.StatusBadRequest, types.CodeKeyRequired},
+		{"movie storage error", failing.GetMovieByID, "GET", "1", http.StatusInternalServerError, types.CodeInternal},
+		{"series", s.GetSeriesByID, "GET", "2", http.StatusOK, ""},
+		{"missing series", s.GetSeriesByID, "GET", "99", http.StatusNotFound, types.CodeNotFound},
+		{"movie as series", s.GetSeriesByID, "GET", "1", http.StatusNotFound, types.CodeNotFound},
+		{"non-numeric series id", s.GetSeriesByID, "GET", "1a", http.StatusBadRequest, types.CodeKeyRequired},
+		{"series storage error", failing.GetSeriesByID, "GET", "2", http.StatusInternalServerError, types.CodeInternal},
+		{"delete missing media", s.DeleteMediaByID, "DELETE", "99", http.StatusNotFound, types.CodeNotFound},
+		{"delete non-numeric id", s.DeleteMediaByID, "DELETE", "abc", http.StatusBadRequest, types.CodeKeyRequired},
+		{"delete storage error", failing.DeleteMediaByID, "DELETE", "1", http.StatusInternalServerError, types.CodeInternal},
+		{"delete media", s.DeleteMediaByID, "DELETE", "1", http.StatusOK, ""},
+		{"deleted movie", s.GetMovieByID, "GET", "1", http.StatusNotFound, types.CodeNotFound},
+	}
+	for _, tc := range testCases {
+		req, _ := http.NewRequest(tc.method, "/media/"+tc.id, nil)
+		req = mux.SetURLVars(req, map[string]string{"id": tc.id})
+		req = req.WithContext(service.WithPrincipal(req.Context(), admin))
+		rr := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rr, req)
+		if rr.Code != tc.statusCode {
+			t.Errorf("`%s` failed, got %v %s want %v", tc.name, rr.Code, rr.Body.String(), tc.statusCode)
+			continue
+		}
+		if tc.statusCode == http.StatusOK {
+			if tc.method == "GET" {
+				var media data.Media
+				if err := json.Unmarshal(rr.Body.Bytes(), &media); err != nil || fmt.Sprint(media.ID) != tc.id {
+					t.Errorf("`%s` expected media %s, got %v", tc.name, tc.id, rr.Body.String())
+				}
+			}
+			continue
+		}
+		var problem types.Problem
+		json.Unmarshal(rr.Body.Bytes(), &problem)
+		if problem.Code != tc.code {
+			t.Errorf("`%s` expected code %v, got %v", tc.name, tc.code, problem.Code)
+		}
+		if tc.statusCode == http.StatusNotFound && problem.Detail != fmt.Sprintf(types.KeyNotFound, tc.id) {
+			t.Errorf("`%s` expected KeyNotFound message, got %v", tc.name, problem.Detail)
+		}
+		if tc.statusCode == http.StatusInternalServerError && strings.Contains(rr.Body.String(), ErrStorage.Error()) {
+			t.Errorf("`%s` expected storage error not to be shown, got %v", tc.name, rr.Body.String())
+		}
+	}
+}
 
-	handler := s.Authorize(http.HandlerFunc(s.AddMovie))
-	req.Header.Set("Authorization", "Bearer "+token.TokenString)
+func TestUpdateMedia(t *testing.T) {
+	db := initDB()
+	byteMovie, _ := json.Marshal(CreateTestMovie())
+	data.New(db).AddMovie(byteMovie)
+	byteSeries, _ := json.Marshal(CreateTestSeries())
+	data.New(db).AddSeries(byteSeries)
+	s := service.New(db)
+	router := mux.NewRouter()
+	router.HandleFunc("/movies/{id}", s.GetMovieByID).Methods("GET")
+	router.HandleFunc("/movies/{id}", s.UpdateMovie).Methods("PUT", "PATCH")
+	router.HandleFunc("/series/{id}", s.GetSeriesByID).Methods("GET")
+	router.HandleFunc("/series/{id}", s.UpdateSeries).Methods("PUT", "PATCH")
+	request := func(method, url string, role string, body string) (int, data.Media) {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req = req.WithContext(service.WithPrincipal(req.Context(), service.Principal{UserID: 1, Role: role}))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var media data.Media
+		json.Unmarshal(rr.Body.Bytes(), &media)
+		return rr.Code, media
+	}
 
-	handler.ServeHTTP(rr, req)
+	status, movie := request("PATCH", "/movies/1", data.RoleAdmin, `{"description":"new plot","stars":null}`)
+	if status != http.StatusOK || movie.Description != "new plot" || movie.Stars != "" || movie.Title != "test movie" || movie.Director != "test director" {
+		t.Errorf("expected plot to be patched and other fields kept, got %v %v", status, movie)
+	}
+	status, movie = request("PUT", "/movies/1", data.RoleAdmin, `{"title":"replaced movie","year":"2022"}`)
+	if status != http.StatusOK || movie.ID != 1 || movie.Type != data.Movie || movie.Title != "replaced movie" || movie.Description != "" || movie.Director != "" {
+		t.Errorf("expected movie fields to be replaced, got %v %v", status, movie)
+	}
+	status, series := request("PATCH", "/series/2", data.RoleAdmin, `{"title":"patched series","seasons":[]}`)
+	if status != http.StatusOK || series.Title != "patched series" || len(series.Seasons) != 1 || len(series.Seasons[0].Episode) != 2 {
+		t.Errorf("expected series to be patched and seasons kept, got %v %v", status, series)
+	}
 
-	// Check the status code is what we expect.
-	if status := rr.Code; status != http.StatusCreated {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+	for _, tc := range []struct {
+		name       string
+		method     string
+		url        string
+		role       string
+		body       string
+		statusCode int
+	}{
+		{"user update", "PATCH", "/movies/1", data.RoleUser, `{"title":"x"}`, http.StatusForbidden},
+		{"missing movie", "PATCH", "/movies/99", data.RoleAdmin, `{"title":"x"}`, http.StatusNotFound},
+		{"series as movie", "PUT", "/movies/2", data.RoleAdmin, `{"title":"x"}`, http.StatusNotFound},
+		{"changed type", "PATCH", "/movies/1", data.RoleAdmin, `{"type":2}`, http.StatusBadRequest},
+		{"invalid patch", "PATCH", "/series/2", data.RoleAdmin, `{"title":`, http.StatusBadRequest},
+		{"invalid field", "PUT", "/series/2", data.RoleAdmin, `{"title":1}`, http.StatusBadRequest},
+	} {
+		if status, _ := request(tc.method, tc.url, tc.role, tc.body); status != tc.statusCode {
+			t.Errorf("`%s` failed, got %v want %v", tc.name, status, tc.statusCode)
+		}
+	}
+	if _, movie = request("GET", "/movies/1", data.RoleUser, ""); movie.Title != "replaced movie" || movie.Type != data.Movie {
+		t.Errorf("expected failed updates to keep movie, got %v", movie)
 	}
 }
 
-func TestAddSeries(t *testing.T) {
-	byteMovie, _ := json.Marshal(CreateTestSeries())
-	reader := bytes.NewReader(byteMovie)
+func TestMediaETags(t *testing.T) {
 	db := initDB()
+	byteMovie, _ := json.Marshal(CreateTestMovie())
+	data.New(db).AddMovie(byteMovie)
+	byteSeries, _ := json.Marshal(CreateTestSeries())
+	data.New(db).AddSeries(byteSeries)
 	s := service.New(db)
-	byteUser, _ := json.Marshal(CreateAdminUser())
-	token, _ := data.New(db).GetToken(byteUser)
-	req, err := http.NewRequest("POST", "/series", reader)
-	if err != nil {
-		t.Fatal(err)
+	router := mux.NewRouter()
+	router.HandleFunc("/movies/{id}", s.GetMovieByID).Methods("GET")
+	router.HandleFunc("/movies/{id}", s.UpdateMovie).Methods("PUT", "PATCH")
+	router.HandleFunc("/movies/{id}", s.DeleteMediaByID).Methods("DELETE")
+	router.HandleFunc("/series/{id}", s.GetSeriesByID).Methods("GET")
+	router.HandleFunc("/series/{id}/seasons/{season}", s.SaveSeason).Methods("PUT", "PATCH")
+	router.HandleFunc("/series/{id}/seasons/{season}", s.DeleteSeason).Methods("DELETE")
+	router.HandleFunc("/series/{id}/seasons/{season}/episodes/{episode}", s.SaveEpisode).Methods("PUT", "PATCH")
+	router.HandleFunc("/series/{id}/seasons/{season}/episodes/{episode}", s.DeleteEpisode).Methods("DELETE")
+	request := func(method, url string, headers map[string]string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req = req.WithContext(service.WithPrincipal(req.Context(), service.Principal{UserID: 1, Role: data.RoleAdmin}))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
 	}
 
-	rr := httptest.NewRecorder()
-	handler := s.Authorize(http.HandlerFunc(s.AddSeries))
-	req.Header.Set("Authorization", "Bearer "+token.TokenString)
+	rr := request("GET", "/movies/1", nil, "")
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected movie with ETag, got %v %v", rr.Code, rr.Header())
+	}
+	if rr = request("GET", "/movies/1", map[string]string{"If-None-Match": "W/" + etag}, ""); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 || rr.Header().Get("ETag") != etag {
+		t.Errorf("expected unchanged movie to return 304, got %v %v", rr.Code, rr.Body.String())
+	}
+	if rr = request("GET", "/movies/1", map[string]string{"If-None-Match": `"other"`}, ""); rr.Code != http.StatusOK {
+		t.Errorf("expected changed ETag to return movie, got %v", rr.Code)
+	}
 
-	handler.ServeHTTP(rr, req)
+	rr = request("PATCH", "/movies/1", map[string]string{"If-Match": etag}, `{"title":"first edit"}`)
+	updated := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || updated == "" || updated == etag {
+		t.Fatalf("expected update with matching ETag to return new ETag, got %v %v", rr.Code, rr.Header())
+	}
+	if rr = request("PATCH", "/movies/1", map[string]string{"If-Match": etag}, `{"title":"second edit"}`); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected update with stale ETag to fail, got %v %v", rr.Code, rr.Body.String())
+	} else {
+		var problem types.Problem
+		json.Unmarshal(rr.Body.Bytes(), &problem)
+		if problem.Code != types.CodePreconditionFailed {
+			t.Errorf("expected precondition_failed code, got %v", problem.Code)
+		}
+	}
+	if rr = request("PATCH", "/movies/1", map[string]string{"If-Match": "W/" + updated}, `{"title":"weak edit"}`); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected weak ETag not to match on update, got %v", rr.Code)
+	}
+	if rr = request("GET", "/movies/1", map[string]string{"If-None-Match": etag}, ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "first edit") {
+		t.Errorf("expected stale ETag to return updated movie, got %v %v", rr.Code, rr.Body.String())
+	}
+	if rr = request("PUT", "/movies/1", map[string]string{"If-Match": "*"}, `{"title":"any edit"}`); rr.Code != http.StatusOK {
+		t.Errorf("expected If-Match * to update existing movie, got %v", rr.Code)
+	}
+	if rr = request("PATCH", "/movies/1", nil, `{"title":"unconditional edit"}`); rr.Code != http.StatusOK {
+		t.Errorf("expected update without If-Match to succeed, got %v", rr.Code)
+	}
 
-	// Check the status code is what we expect.
-	if status := rr.Code; status != http.StatusCreated {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+	movie, _ := db.FindMediaByID(data.Movie, 1)
+	if err := db.UpdateMedia(&movie, movie.UpdatedAt.Add(-time.Second)); !errors.Is(err, data.ErrModified) {
+		t.Errorf("expected store to reject update of modified media, got %v", err)
+	}
+
+	seriesETag := request("GET", "/series/2", nil, "").Header().Get("ETag")
+	if rr = request("PATCH", "/series/2/seasons/1", nil, `{"totalSeasons":3}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected season to be patched, got %v", rr.Code)
+	}
+	if rr = request("GET", "/series/2", map[string]string{"If-None-Match": seriesETag}, ""); rr.Code != http.StatusOK {
+		t.Errorf("expected season change to change ETag of series, got %v", rr.Code)
+	}
+
+	if rr = request("PATCH", "/series/2/seasons/1", map[string]string{"If-Match": seriesETag}, `{"totalSeasons":4}`); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected season update with stale ETag to fail, got %v %v", rr.Code, rr.Body.String())
+	}
+	seriesETag = request("GET", "/series/2", nil, "").Header().Get("ETag")
+	if rr = request("PATCH", "/series/2/seasons/1/episodes/1", map[string]string{"If-Match": seriesETag}, `{"media":{"title":"edited episode"}}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected episode update with matching ETag to succeed, got %v %v", rr.Code, rr.Body.String())
+	}
+	for _, change := range []struct{ method, url, body string }{
+		{"PATCH", "/series/2/seasons/1/episodes/2", `{"media":{"title":"stale episode"}}`},
+		{"PUT", "/series/2/seasons/1/episodes/3", `{"media":{"title":"stale new episode","type":"episode"}}`},
+		{"DELETE", "/series/2/seasons/1/episodes/2", ""},
+		{"PUT", "/series/2/seasons/2", `{"totalSeasons":2}`},
+		{"DELETE", "/series/2/seasons/1", ""},
+	} {
+		if rr = request(change.method, change.url, map[string]string{"If-Match": seriesETag}, change.body); rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected %v %v with stale ETag to fail, got %v %v", change.method, change.url, rr.Code, rr.Body.String())
+		}
+	}
+	seriesETag = request("GET", "/series/2", nil, "").Header().Get("ETag")
+	if rr = request("DELETE", "/series/2/seasons/1/episodes/2", map[string]string{"If-Match": seriesETag}, ""); rr.Code != http.StatusOK {
+		t.Errorf("expected episode delete with matching ETag to succeed, got %v %v", rr.Code, rr.Body.String())
+	}
+
+	series, _ := db.FindMediaByID(data.Series, 2)
+	season, _ := db.FindSeason(2, 1)
+	episode := *season.Episode[0]
+	if err := db.UpdateEpisode(&episode, time.Time{}); err != nil {
+		t.Fatalf("expected episode to be updated, got %v", err)
+	}
+	if err := db.UpdateMedia(&series, series.UpdatedAt); !errors.Is(err, data.ErrModified) {
+		t.Errorf("expected store to reject update of series with changed episode, got %v", err)
+	}
+	if err := db.DeleteMedia(series.ID, series.UpdatedAt); !errors.Is(err, data.ErrModified) {
+		t.Errorf("expected store to reject delete of series with changed episode, got %v", err)
+	}
+	season.Episode = nil
+	if err := db.UpdateSeason(&season, series.UpdatedAt); !errors.Is(err, data.ErrModified) {
+		t.Errorf("expected store to reject update of season with stale series version, got %v", err)
+	}
+
+	etag = request("GET", "/movies/1", nil, "").Header().Get("ETag")
+	if rr = request("DELETE", "/movies/1", map[string]string{"If-Match": seriesETag}, ""); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected delete with stale ETag to fail, got %v", rr.Code)
+	}
+	if rr = request("DELETE", "/movies/1", map[string]string{"If-Match": etag}, ""); rr.Code != http.StatusOK {
+		t.Errorf("expected delete with matching ETag to succeed, got %v %v", rr.Code, rr.Body.String())
+	}
+	if rr = request("PATCH", "/movies/1", map[string]string{"If-Match": "*"}, `{}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected deleted movie not to be found, got %v", rr.Code)
 	}
 }
 
-func TestAddFavorite(t *testing.T) {
-	byteMovie, _ := json.Marshal(CreateFavorites())
-	reader := bytes.NewReader(byteMovie)
+func TestSeasonsAndEpisodes(t *testing.T) {
 	db := initDB()
+	byteSeries, _ := json.Marshal(CreateTestSeries())
+	data.New(db).AddSeries(byteSeries)
 	s := service.New(db)
-	req, err := http.NewRequest("POST", "/favorites", reader)
-	if err != nil {
-		t.Fatal(err)
+	router := mux.NewRouter()
+	router.HandleFunc("/series/{id}", s.GetSeriesByID).Methods("GET")
+	router.HandleFunc("/series/{id}/seasons/{season}", s.GetSeason).Methods("GET")
+	router.HandleFunc("/series/{id}/seasons/{season}", s.SaveSeason).Methods("PUT", "PATCH")
+	router.HandleFunc("/series/{id}/seasons/{season}", s.DeleteSeason).Methods("DELETE")
+	router.HandleFunc("/series/{id}/seasons/{season}/episodes/{episode}", s.GetEpisode).Methods("GET")
+	router.HandleFunc("/series/{id}/seasons/{season}/episodes/{episode}", s.SaveEpisode).Methods("PUT", "PATCH")
+	router.HandleFunc("/series/{id}/seasons/{season}/episodes/{episode}", s.DeleteEpisode).Methods("DELETE")
+	request := func(method, url string, role string, body string, result interface{}) int {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req = req.WithContext(service.WithPrincipal(req.Context(), service.Principal{UserID: 1, Role: role}))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if result != nil {
+			json.Unmarshal(rr.Body.Bytes(), result)
+		}
+		return rr.Code
+	}
+	series := func() data.Media {
+		var media data.Media
+		request("GET", "/series/1", data.RoleUser, "", &media)
+		return media
 	}
 
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(s.AddFavorite)
-
-	handler.ServeHTTP(rr, req)
+	var season data.Seasons
+	status := request("PUT", "/series/1/seasons/2", data.RoleAdmin, `{"season":5,"totalSeasons":2,"episodes":[{"episode":"1","content":{"title":"new episode"}}]}`, &season)
+	if status != http.StatusCreated || season.Season != 2 || len(season.Episode) != 1 || season.Episode[0].Media.Type != data.Episode {
+		t.Fatalf("expected season to be added, got %v %v", status, season)
+	}
+	if media := series(); len(media.Seasons) != 2 || len(media.Seasons[0].Episode) != 2 {
+		t.Errorf("expected season to be added to series, got %v", media)
+	}
+	status = request("PATCH", "/series/1/seasons/1", data.RoleAdmin, `{"totalSeasons":2,"episodes":null}`, &season)
+	if status != http.StatusOK || season.TotalSeasons != 2 || len(season.Episode) != 2 {
+		t.Errorf("expected season to be patched and episodes kept, got %v %v", status, season)
+	}
 
-	// Check the status code is what we expect.
-	if status := rr.Code; status != http.StatusCreated {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+	var episode data.Episodes
+	status = request("PUT", "/series/1/seasons/1/episodes/3", data.RoleAdmin, `{"episode":"9","content":{"title":"third episode"}}`, &episode)
+	if status != http.StatusCreated || episode.Episode != "3" || episode.Media.Title != "third episode" || episode.Media.Type != data.Episode {
+		t.Errorf("expected episode to be added, got %v %v", status, episode)
+	}
+	status = request("PATCH", "/series/1/seasons/1/episodes/1", data.RoleAdmin, `{"content":{"description":"new plot"}}`, &episode)
+	if status != http.StatusOK || episode.Media.Description != "new plot" || episode.Media.Title != "test Episode" {
+		t.Errorf("expected episode content to be patched, got %v %v", status, episode)
+	}
+	if status = request("DELETE", "/series/1/seasons/1/episodes/2", data.RoleAdmin, "", nil); status != http.StatusOK {
+		t.Errorf("expected episode to be deleted, got %v", status)
+	}
+	if status = request("GET", "/series/1/seasons/1", data.RoleUser, "", &season); status != http.StatusOK || len(season.Episode) != 2 {
+		t.Errorf("expected season to have two episodes, got %v %v", status, season)
+	}
+	if status = request("DELETE", "/series/1/seasons/2", data.RoleAdmin, "", nil); status != http.StatusOK {
+		t.Errorf("expected season to be deleted, got %v", status)
+	}
+	if media := series(); media.Title != "test Series" || len(media.Seasons) != 1 || len(media.Seasons[0].Episode) != 2 {
+		t.Errorf("expected rest of series to be kept, got %v", media)
 	}
-}
 
-func TestGetSuggestions(t *testing.T) {
-	testCases := map[string]struct {
-		params     map[string]string
+	for _, tc := range []struct {
+		name       string
+		method     string
+		url        string
+		role       string
+		body       string
 		statusCode int
 	}{
-		"good params": {
-			map[string]string{
-				"name": "Matrix",
-			},
-			http.StatusOK,
-		},
-		"without params": {
-			map[string]string{},
-			http.StatusBadRequest,
-		},
+		{"user season", "PUT", "/series/1/seasons/3", data.RoleUser, `{}`, http.StatusForbidden},
+		{"user episode", "DELETE", "/series/1/seasons/1/episodes/1", data.RoleUser, "", http.StatusForbidden},
+		{"missing series", "PUT", "/series/99/seasons/1", data.RoleAdmin, `{}`, http.StatusNotFound},
+		{"patch missing season", "PATCH", "/series/1/seasons/3", data.RoleAdmin, `{}`, http.StatusNotFound},
+		{"invalid season", "GET", "/series/1/seasons/first", data.RoleUser, "", http.StatusBadRequest},
+		{"deleted season", "GET", "/series/1/seasons/2", data.RoleUser, "", http.StatusNotFound},
+		{"deleted episode", "GET", "/series/1/seasons/1/episodes/2", data.RoleUser, "", http.StatusNotFound},
+		{"patch missing episode", "PATCH", "/series/1/seasons/1/episodes/7", data.RoleAdmin, `{}`, http.StatusNotFound},
+		{"episode without content", "PUT", "/series/1/seasons/1/episodes/7", data.RoleAdmin, `{}`, http.StatusBadRequest},
+		{"removed content", "PATCH", "/series/1/seasons/1/episodes/1", data.RoleAdmin, `{"content":null}`, http.StatusBadRequest},
+		{"movie as episode", "PUT", "/series/1/seasons/1/episodes/8", data.RoleAdmin, `{"content":{"title":"x","type":1}}`, http.StatusBadRequest},
+		{"duplicate episodes", "PUT", "/series/1/seasons/4", data.RoleAdmin, `{"episodes":[{"episode":"1","content":{"title":"x"}},{"episode":"1","content":{"title":"y"}}]}`, http.StatusBadRequest},
+	} {
+		if status := request(tc.method, tc.url, tc.role, tc.body, nil); status != tc.statusCode {
+			t.Errorf("`%s` failed, got %v want %v", tc.name, status, tc.statusCode)
+		}
 	}
+}
+
+func TestMediaValidation(t *testing.T) {
 	db := initDB()
 	s := service.New(db)
-	byteUser, _ := json.Marshal(CreateAdminUser())
-	token, _ := data.New(db).GetToken(byteUser)
+	admin := service.Principal{UserID: 1, Role: data.RoleAdmin}
+	episode := `{"episode":"1","content":{"title":"episode"}}`
 
-	for tc, tp := range testCases {
-		req, err := http.NewRequest("GET", "/suggestions", nil)
-		q := req.URL.Query()
-		for k, v := range tp.params {
-			q.Add(k, v)
+	testCases := []struct {
+		name       string
+		handler    http.HandlerFunc
+		body       string
+		statusCode int
+		fields     []string
+	}{
+		{"movie", s.AddMovie, `{"title":"movie","year":"1999","rating":"8.7"}`, http.StatusCreated, nil},
+		{"movie without type", s.AddMovie, `{"title":"movie","rating":"N/A"}`, http.StatusCreated, nil},
+		{"empty title", s.AddMovie, `{"title":" ","type":1}`, http.StatusBadRequest, []string{"title"}},
+		{"episode as movie", s.AddMovie, `{"title":"movie","type":3}`, http.StatusBadRequest, []string{"type"}},
+		{"series as movie", s.AddMovie, `{"title":"movie","type":2}`, http.StatusBadRequest, []string{"type"}},
+		{"movie with seasons", s.AddMovie, `{"title":"movie","seasons":[{"season":1}]}`, http.StatusBadRequest, []string{"seasons"}},
+		{"invalid year and rating", s.AddMovie, `{"title":"movie","year":"99","rating":"11"}`, http.StatusBadRequest, []string{"rating", "year"}},
+		{"invalid typed fields", s.AddMovie, `{"title":"movie","ratingValue":11,"durationMinutes":-1,"yearFrom":2005,"yearTo":2000}`, http.StatusBadRequest, []string{"durationMinutes", "ratingValue", "yearTo"}},
+		{"series", s.AddSeries, `{"title":"series","year":"2011–2019","seasons":[{"season":1,"episodes":[` + episode + `]},{"season":2}]}`, http.StatusCreated, nil},
+		{"movie as series", s.AddSeries, `{"title":"series","type":1}`, http.StatusBadRequest, []string{"type"}},
+		{"duplicate seasons", s.AddSeries, `{"title":"series","seasons":[{"season":1},{"season":1}]}`, http.StatusBadRequest, []string{"seasons"}},
+		{"season without number", s.AddSeries, `{"title":"series","seasons":[{"totalSeasons":1}]}`, http.StatusBadRequest, []string{"seasons[0].season"}},
+		{"duplicate episodes", s.AddSeries, `{"title":"series","seasons":[{"season":1,"episodes":[` + episode + `,` + episode + `]}]}`, http.StatusBadRequest, []string{"seasons[0].episodes"}},
+		{"invalid episodes", s.AddSeries, `{"title":"series","seasons":[{"season":1,"episodes":[{"content":{"title":"x","type":1}},{"episode":"2"},{"episode":"3","content":{"year":"x"}}]}]}`, http.StatusBadRequest,
+			[]string{"seasons[0].episodes[0].episode", "seasons[0].episodes[0].content.type", "seasons[0].episodes[1].content", "seasons[0].episodes[2].content.title", "seasons[0].episodes[2].content.year"}},
+		{"favorite without media", s.AddFavorite, `{}`, http.StatusBadRequest, []string{"mediaId"}},
+	}
+	for _, tc := range testCases {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(tc.body))
+		req = req.WithContext(service.WithPrincipal(req.Context(), admin))
+		rr := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rr, req)
+		if rr.Code != tc.statusCode {
+			t.Errorf("`%s` failed, got %v %s want %v", tc.name, rr.Code, rr.Body.String(), tc.statusCode)
+			continue
 		}
-		req.URL.RawQuery = q.Encode()
-		if err != nil {
+		if tc.fields == nil {
+			continue
+		}
+		var problem struct {
+			Code   string            `json:"code"`
+			Errors []data.FieldError `json:"errors"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &problem)
+		fields := []string{}
+		for _, fieldError := range problem.Errors {
+			fields = append(fields, fieldError.Field)
+		}
+		sort.Strings(fields)
+		sort.Strings(tc.fields)
+		if problem.Code != types.CodeInvalidFields || strings.Join(fields, ",") != strings.Join(tc.fields, ",") {
+			t.Errorf("`%s` expected invalid fields %v, got %v", tc.name, tc.fields, rr.Body.String())
+		}
+	}
+}
+
+func TestCreditsAndGenres(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	for _, movie := range []string{
+		`{"title":"The Matrix","director":"Lana Wachowski, Lilly Wachowski","stars":"Keanu Reeves, Carrie-Anne Moss","genre":"Action, Sci-Fi"}`,
+		`{"title":"John Wick","director":"Chad Stahelski","stars":"Keanu Reeves","genre":"Action"}`,
+		`{"title":"Reevesville","stars":"Keanu Reevesson","genre":"action, Drama"}`,
+	} {
+		if err := data.New(db).AddMovie([]byte(movie)); err != nil {
 			t.Fatal(err)
 		}
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/movies/{id}", s.GetMovieByID).Methods("GET")
+	router.HandleFunc("/movies/{id}", s.UpdateMovie).Methods("PATCH")
+	router.HandleFunc("/movies/{id}", s.DeleteMediaByID).Methods("DELETE")
+	router.HandleFunc("/people/{id}", s.GetPerson).Methods("GET")
+	router.HandleFunc("/genres/{slug}", s.GetGenre).Methods("GET")
+	request := func(method, url, body string, result interface{}) int {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req = req.WithContext(service.WithPrincipal(req.Context(), service.Principal{UserID: 1, Role: data.RoleAdmin}))
 		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if result != nil {
+			json.Unmarshal(rr.Body.Bytes(), result)
+		}
+		return rr.Code
+	}
 
+	var movie data.Media
+	request("GET", "/movies/1", "", &movie)
+	if movie.Stars != "Keanu Reeves, Carrie-Anne Moss" || movie.Director != "Lana Wachowski, Lilly Wachowski" || movie.Genre != "Action, Sci-Fi" {
+		t.Errorf("expected string fields to be computed from credits, got %v", movie)
+	}
+	if len(movie.Credits) != 4 || len(movie.Genres) != 2 || movie.Genres[1].Slug != "sci-fi" {
+		t.Fatalf("expected credits and genres of movie, got %v %v", movie.Credits, movie.Genres)
+	}
+	var keanu uint
+	for _, credit := range movie.Credits {
+		if credit.Role == data.CreditStar && credit.Person.Name == "Keanu Reeves" {
+			keanu = credit.Person.ID
+		}
+	}
+	person := fmt.Sprintf("/people/%d", keanu)
+
+	var credits data.CreditList
+	if status := request("GET", person, "", &credits); status != http.StatusOK || credits.Person.Name != "Keanu Reeves" || credits.Total != 2 ||
+		credits.Items[0].Media.Title != "The Matrix" || credits.Items[1].Media.Title != "John Wick" || credits.Items[1].Role != data.CreditStar {
+		t.Errorf("expected exact credits of person, got %v %v", status, credits)
+	}
+	var genre data.GenreMediaList
+	if status := request("GET", "/genres/action", "", &genre); status != http.StatusOK || genre.Genre.Name != "Action" || genre.Total != 3 {
+		t.Errorf("expected media of genre, got %v %v", status, genre)
+	}
+	if status := request("GET", "/genres/Sci-Fi?pageSize=1", "", &genre); status != http.StatusOK || genre.Total != 1 || genre.Items[0].Title != "The Matrix" {
+		t.Errorf("expected genre given name to be found, got %v %v", status, genre)
+	}
+
+	var patched data.Media
+	if status := request("PATCH", "/movies/2", `{"stars":"Ian McShane, Keanu Reeves","genre":null}`, &patched); status != http.StatusOK || patched.Stars != "Ian McShane, Keanu Reeves" || patched.Genre != "" || len(patched.Genres) != 0 {
+		t.Errorf("expected credits to be updated with fields, got %v %v", status, patched)
+	}
+	request("GET", "/genres/action", "", &genre)
+	if genre.Total != 2 {
+		t.Errorf("expected updated movie to leave genre, got %v", genre)
+	}
+	if status := request("DELETE", "/movies/1", "", nil); status != http.StatusOK {
+		t.Fatalf("expected movie to be deleted, got %v", status)
+	}
+	request("GET", person, "", &credits)
+	if credits.Total != 1 || credits.Items[0].Media.Title != "John Wick" || credits.Items[0].Position != 1 {
+		t.Errorf("expected deleted movie to be removed from credits, got %v", credits)
+	}
+
+	for _, tc := range []struct {
+		url        string
+		statusCode int
+	}{
+		{"/people/99", http.StatusNotFound},
+		{"/people/abc", http.StatusBadRequest},
+		{"/genres/western", http.StatusNotFound},
+		{person + "?page=0", http.StatusBadRequest},
+	} {
+		if status := request("GET", tc.url, "", nil); status != tc.statusCode {
+			t.Errorf("`%s` failed, got %v want %v", tc.url, status, tc.statusCode)
+		}
+	}
+}
+
+func TestTypedFields(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	for _, media := range []struct {
+		add  func([]byte) error
+		body string
+	}{
+		{data.New(db).AddMovie, `{"title":"Inception","duration":"148 min","rating":"8.8","year":"2010"}`},
+		{data.New(db).AddSeries, `{"title":"Game of Thrones","durationMinutes":57,"ratingValue":9.2,"yearFrom":2011,"yearTo":2019}`},
+		{data.New(db).AddSeries, `{"title":"Severance","year":"2022–","rating":"N/A"}`},
+		{data.New(db).AddMovie, `{"title":"Amelie","duration":"122 min","yearFrom":2001}`},
+	} {
+		if err := media.add([]byte(media.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/movies", s.GetMovies).Methods("GET")
+	router.HandleFunc("/movies/{id}", s.GetMovieByID).Methods("GET")
+	router.HandleFunc("/movies/{id}", s.UpdateMovie).Methods("PATCH")
+	router.HandleFunc("/series/{id}", s.GetSeriesByID).Methods("GET")
+	request := func(method, url, body string, result interface{}) int {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req = req.WithContext(service.WithPrincipal(req.Context(), service.Principal{UserID: 1, Role: data.RoleAdmin}))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if result != nil {
+			json.Unmarshal(rr.Body.Bytes(), result)
+		}
+		return rr.Code
+	}
+	typed := func(media data.Media) string {
+		values := []string{}
+		for _, value := range []interface{}{media.DurationMinutes, media.RatingValue, media.YearFrom, media.YearTo} {
+			switch value := value.(type) {
+			case *int:
+				if value != nil {
+					values = append(values, fmt.Sprint(*value))
+					continue
+				}
+			case *float64:
+				if value != nil {
+					values = append(values, fmt.Sprint(*value))
+					continue
+				}
+			}
+			values = append(values, "null")
+		}
+		return fmt.Sprintf("%s|%s|%s %s", media.Duration, media.Rating, media.Year, strings.Join(values, ","))
+	}
+
+	for _, tc := range []struct {
+		url      string
+		expected string
+	}{
+		{"/movies/1", "148 min|8.8|2010 148,8.8,2010,2010"},
+		{"/series/2", "57 min|9.2|2011–2019 57,9.2,2011,2019"},
+		{"/series/3", "|N/A|2022– null,null,2022,null"},
+		{"/movies/4", "122 min||2001 122,null,2001,null"},
+	} {
+		var media data.Media
+		request("GET", tc.url, "", &media)
+		if typed(media) != tc.expected {
+			t.Errorf("`%s` expected raw and typed fields %s, got %s", tc.url, tc.expected, typed(media))
+		}
+	}
+
+	var list data.MediaList
+	request("GET", "/movies?minDuration=100&sort=-duration", "", &list)
+	if list.Total != 2 || list.Items[0].Title != "Inception" || list.Items[1].Title != "Amelie" {
+		t.Errorf("expected movies filtered by duration, got %v", list)
+	}
+	if status := request("GET", "/movies?minDuration=130&maxDuration=100", "", nil); status != http.StatusBadRequest {
+		t.Errorf("expected invalid duration range to be rejected, got %v", status)
+	}
+
+	for _, tc := range []struct {
+		body     string
+		expected string
+	}{
+		{`{"ratingValue":9}`, "148 min|9.0|2010 148,9,2010,2010"},
+		{`{"rating":"7.5","durationMinutes":150}`, "150 min|7.5|2010 150,7.5,2010,2010"},
+		{`{"rating":"8.1","ratingValue":2}`, "150 min|8.1|2010 150,8.1,2010,2010"},
+		{`{"year":null,"duration":null}`, "|8.1| null,8.1,null,null"},
+	} {
+		var media data.Media
+		if status := request("PATCH", "/movies/1", tc.body, &media); status != http.StatusOK || typed(media) != tc.expected {
+			t.Errorf("`%s` expected raw and typed fields %s, got %v %s", tc.body, tc.expected, status, typed(media))
+		}
+	}
+	if status := request("PATCH", "/movies/1", `{"ratingValue":10.5}`, nil); status != http.StatusBadRequest {
+		t.Errorf("expected rating above 10 to be rejected, got %v", status)
+	}
+
+	media := data.New(db).ConvertToMedia(data.MediaAPIContent{Type: "movie", Title: "Inception", Runtime: "N/A", Released: "16 Jul 2010", ImdbRating: "8.8", Year: "2010"}, nil)
+	if media.ReleaseDate == nil || media.ReleaseDate.Format("2006-01-02") != "2010-07-16" || media.DurationMinutes != nil || *media.RatingValue != 8.8 || *media.YearFrom != 2010 {
+		t.Errorf("expected typed fields of converted media, got %v", typed(*media))
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	migrations := data.NewMigrator(nil).Migrations
+	if len(migrations) == 0 || migrations[0].Name != "initial_schema" {
+		t.Fatalf("expected initial schema migration, got %v", migrations)
+	}
+	names := map[string]bool{}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) || migration.Up == nil || migration.Down == nil || migration.Name == "" || names[migration.Name] {
+			t.Errorf("expected migration %d with unique name, up and down steps, got %d %s", i+1, migration.Version, migration.Name)
+		}
+		names[migration.Name] = true
+	}
+}
+
+func TestMigrationsUpAndDown(t *testing.T) {
+	if config.StorageTest != data.PostgresStore {
+		t.Skip("migrations need postgres, run with STORAGE_TEST=postgres")
+	}
+	db := server.SetupDB(config.DBNameTest)
+	migrator := data.NewMigrator(db)
+	total := len(migrator.Migrations)
+	applied := func() int {
+		statuses, err := migrator.Status()
+		if err != nil || len(statuses) != total {
+			t.Fatalf("expected status of %d migrations, got %v %v", total, statuses, err)
+		}
+		count := 0
+		for i, status := range statuses {
+			if status.Version != int64(i+1) {
+				t.Errorf("expected status in version order, got %d at %d", status.Version, i)
+			}
+			if status.AppliedAt != nil {
+				count++
+			}
+		}
+		return count
+	}
+
+	if _, err := migrator.Down(0); err != nil {
+		t.Fatal(err)
+	}
+	if count := applied(); count != 0 {
+		t.Fatalf("expected all migrations to be rolled back, got %d applied", count)
+	}
+	if done, err := migrator.Up(); err != nil || len(done) != total {
+		t.Fatalf("expected %d migrations to be applied, got %d %v", total, len(done), err)
+	}
+	if count := applied(); count != total {
+		t.Errorf("expected all migrations to be applied, got %d", count)
+	}
+
+	done, err := migrator.Down(total - 2)
+	if err != nil || len(done) != total-2 || done[0].Version != int64(total) {
+		t.Fatalf("expected latest %d migrations to be rolled back, got %v %v", total-2, done, err)
+	}
+	if count := applied(); count != 2 {
+		t.Fatalf("expected 2 migrations to stay applied, got %d", count)
+	}
+	err = db.Exec(`INSERT INTO media (created_at, updated_at, type, title, director, stars, genre, rating, duration, year)
+		VALUES (now(), now(), ?, 'Legacy series', 'Jane Doe', 'John Roe, Ann Poe', 'Drama, Crime', '8.1', '42 min', '2001–2004')`, data.Series).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done, err = migrator.Up(); err != nil || len(done) != total-2 {
+		t.Fatalf("expected %d migrations to be applied again, got %d %v", total-2, len(done), err)
+	}
+	if done, err = migrator.Up(); err != nil || len(done) != 0 {
+		t.Errorf("expected no pending migrations, got %v %v", done, err)
+	}
+
+	var id uint
+	if err = db.Table("media").Where("title = ?", "Legacy series").Select("id").Row().Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	media, err := data.NewPostgresStore(db).FindMediaByID(data.Series, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(media.Credits) != 3 || len(media.Genres) != 2 {
+		t.Errorf("expected credits and genres to be backfilled, got %d credits and %d genres", len(media.Credits), len(media.Genres))
+	}
+	if media.RatingValue == nil || *media.RatingValue != 8.1 || media.DurationMinutes == nil || *media.DurationMinutes != 42 ||
+		media.YearFrom == nil || *media.YearFrom != 2001 || media.YearTo == nil || *media.YearTo != 2004 {
+		t.Errorf("expected typed fields to be backfilled, got %v %v %v %v", media.RatingValue, media.DurationMinutes, media.YearFrom, media.YearTo)
+	}
+}
+
+func TestCLI(t *testing.T) {
+	db := initDB()
+	if err := data.New(db).AddMovie([]byte(`{"title":"Inception","year":"2010"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.New(db).AddSeries([]byte(`{"title":"Severance","seasons":[{"season":1,"episodes":[{"episode":"1","content":{"title":"Good News About Hell"}}]}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	openStore, stdin := cli.OpenStore, cli.Stdin
+	defer func() { cli.OpenStore, cli.Stdin = openStore, stdin }()
+	cli.OpenStore = func() data.Store { return db }
+	cli.Stdin = strings.NewReader("secret-password\n")
+
+	for _, tc := range []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"user", "create", "-name", "Ops", "-email", "ops@example.com", "-role", "admin"}, 0, "created user 3 ops@example.com admin"},
+		{[]string{"user", "create", "-name", "Ops", "-email", "ops@example.com", "-password", "secret-password"}, 1, "Email already exists"},
+		{[]string{"user", "create", "-email", "x@example.com", "-role", "owner"}, 2, "role must be user or admin"},
+		{[]string{"user", "set-role", "3", "user"}, 0, "user 3 ops@example.com is user"},
+		{[]string{"user", "set-role", "99", "user"}, 1, "not found"},
+		{[]string{"user", "list", "-pageSize", "2", "-page", "2"}, 0, "ops@example.com"},
+		{[]string{"media", "export", "-output", "-"}, 0, "Good News About Hell"},
+		{[]string{"media", "export", "-type", "episode"}, 2, "type must be all, movie or series"},
+		{[]string{"media", "import"}, 2, "usage: scaleflixapi media import [-dry-run] IMDBID"},
+		{[]string{"config", "print"}, 0, "SECRET_KEY=*****"},
+		{[]string{"migrate", "sideways"}, 2, "usage: scaleflixapi migrate"},
+		{[]string{"unknown"}, 2, "unknown command unknown"},
+	} {
+		var out, errOut bytes.Buffer
+		code := cli.Run(tc.args, &out, &errOut)
+		if code != tc.code || !strings.Contains(out.String()+errOut.String(), tc.expected) {
+			t.Errorf("`%s` expected %d %q, got %d %s %s", strings.Join(tc.args, " "), tc.code, tc.expected, code, out.String(), errOut.String())
+		}
+	}
+
+	token, err := data.New(db).GetToken([]byte(`{"email":"ops@example.com","password":"secret-password"}`))
+	if err != nil || token.TokenString == "" {
+		t.Errorf("expected user created by cli to get token with password of stdin, got %v", err)
+	}
+	var out bytes.Buffer
+	cli.Run([]string{"media", "export", "-type", "series", "-output", "-"}, &out, &out)
+	var exported []data.Media
+	if err := json.Unmarshal(out.Bytes(), &exported); err != nil || len(exported) != 1 || len(exported[0].Seasons) != 1 || len(exported[0].Seasons[0].Episode) != 1 {
+		t.Errorf("expected series exported with seasons and episodes, got %v %s", err, out.String())
+	}
+}
+
+func TestAddMovie(t *testing.T) {
+	byteMovie, _ := json.Marshal(CreateTestMovie())
+	reader := bytes.NewReader(byteMovie)
+	db := initDB()
+	s := service.New(db)
+	byteUser, _ := json.Marshal(CreateLogin(CreateAdminUser()))
+	token, _ := data.New(db).GetToken(byteUser)
+	req, err := http.NewRequest("POST", "/movies", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler := s.Authorize(http.HandlerFunc(s.AddMovie))
+	req.Header.Set("Authorization", "Bearer "+token.TokenString)
+
+	handler.ServeHTTP(rr, req)
+
+	// Check the status code is what we expect.
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+}
+
+func TestAddSeries(t *testing.T) {
+	byteMovie, _ := json.Marshal(CreateTestSeries())
+	reader := bytes.NewReader(byteMovie)
+	db := initDB()
+	s := service.New(db)
+	byteUser, _ := json.Marshal(CreateLogin(CreateAdminUser()))
+	token, _ := data.New(db).GetToken(byteUser)
+	req, err := http.NewRequest("POST", "/series", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := s.Authorize(http.HandlerFunc(s.AddSeries))
+	req.Header.Set("Authorization", "Bearer "+token.TokenString)
+
+	handler.ServeHTTP(rr, req)
+
+	// Check the status code is what we expect.
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+}
+
+func TestPasswordLifecycle(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	manager := data.New(db)
+	user := CreateUser()
+	byteUser, _ := json.Marshal(CreateLogin(user))
+	token, err := manager.GetToken(byteUser)
+	if err != nil {
+		t.Fatalf("expected plaintext password login, got %v", err)
+	}
+	stored, _ := db.FindUserByEmail(user.Email)
+	if !strings.HasPrefix(stored.Password, "$2") {
+		t.Errorf("expected password to be migrated to bcrypt hash, got %v", stored.Password)
+	}
+	if byteStored, _ := json.Marshal(stored); strings.Contains(string(byteStored), "password") {
+		t.Errorf("expected password not to be serialized, got %s", byteStored)
+	}
+	if _, err = manager.GetToken(byteUser); err != nil {
+		t.Errorf("expected hashed password login, got %v", err)
+	}
+
+	testCases := []struct {
+		name       string
+		method     string
+		url        string
+		token      string
+		body       string
+		handler    http.HandlerFunc
+		statusCode int
+	}{
+		{"wrong current password", "PUT", "/password", token.TokenString, `{"currentPassword":"wrong","newPassword":"newpassword1"}`, s.ChangePassword, http.StatusUnauthorized},
+		{"short new password", "PUT", "/password", token.TokenString, `{"currentPassword":"user2111","newPassword":"short"}`, s.ChangePassword, http.StatusBadRequest},
+		{"reset as user", "POST", "/password/reset", token.TokenString, `{"email":"user2@gmail.com"}`, s.CreatePasswordReset, http.StatusForbidden},
+		{"change password", "PUT", "/password", token.TokenString, `{"currentPassword":"user2111","newPassword":"newpassword1"}`, s.ChangePassword, http.StatusOK},
+		{"token before password change", "PUT", "/password", token.TokenString, `{"currentPassword":"newpassword1","newPassword":"newpassword2"}`, s.ChangePassword, http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		req, _ := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		rr := httptest.NewRecorder()
+		s.Authorize(tc.handler).ServeHTTP(rr, req)
+		if status := rr.Code; status != tc.statusCode {
+			t.Errorf("`%v` failed, handler returned wrong status code: got %v want %v", tc.name, status, tc.statusCode)
+		}
+	}
+	if err = data.New(FailingStore{db}).ChangePassword(user.Email, []byte(`{"currentPassword":"wrong","newPassword":"newpassword1"}`)); !errors.Is(err, ErrStorage) {
+		t.Errorf("expected storage failure of password change to be returned, got %v", err)
+	}
+	if _, err = manager.GetToken(byteUser); err == nil {
+		t.Errorf("expected old password to be rejected")
+	}
+	if _, err = manager.RefreshTokens([]byte(`{"refreshToken":"` + token.RefreshToken + `"}`)); err == nil {
+		t.Errorf("expected refresh token issued before password change to be revoked")
+	}
+	byteChanged, _ := json.Marshal(data.Authentication{Email: user.Email, Password: "newpassword1"})
+	changedToken, err := manager.GetToken(byteChanged)
+	if err != nil {
+		t.Fatalf("expected login with changed password, got %v", err)
+	}
+
+	byteAdmin, _ := json.Marshal(CreateLogin(CreateAdminUser()))
+	adminToken, _ := manager.GetToken(byteAdmin)
+	req, _ := http.NewRequest("POST", "/password/reset", strings.NewReader(`{"email":"user2@gmail.com"}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken.TokenString)
+	rr := httptest.NewRecorder()
+	s.Authorize(http.HandlerFunc(s.CreatePasswordReset)).ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var reset data.PasswordResetToken
+	if err := json.Unmarshal(rr.Body.Bytes(), &reset); err != nil || reset.Token == "" {
+		t.Fatalf("expected reset token, got %v", rr.Body.String())
+	}
+
+	body := `{"token":"` + reset.Token + `","newPassword":"resetpassword1"}`
+	for i, statusCode := range []int{http.StatusOK, http.StatusBadRequest} {
+		req, _ = http.NewRequest("POST", "/password/reset/confirm", strings.NewReader(body))
+		rr = httptest.NewRecorder()
+		s.Authorize(http.HandlerFunc(s.ResetPassword)).ServeHTTP(rr, req)
+		if status := rr.Code; status != statusCode {
+			t.Errorf("reset %d handler returned wrong status code: got %v want %v", i+1, status, statusCode)
+		}
+	}
+	byteUser, _ = json.Marshal(data.Authentication{Email: user.Email, Password: "resetpassword1"})
+	if _, err = manager.GetToken(byteUser); err != nil {
+		t.Errorf("expected login with reset password, got %v", err)
+	}
+	if _, err = manager.VerifyToken(changedToken.TokenString); err == nil {
+		t.Errorf("expected access token issued before password reset to be revoked")
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	keys, err := CreateSigningKeys(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(keys, signingKeyID string) {
+		config.JWTKeys, config.JWTSigningKeyID = keys, signingKeyID
+	}(config.JWTKeys, config.JWTSigningKeyID)
+	db := initDB()
+	byteUser, _ := json.Marshal(CreateLogin(CreateUser()))
+	login := func(keys, signingKeyID string) (*mux.Router, data.Token) {
+		config.JWTKeys, config.JWTSigningKeyID = keys, signingKeyID
+		s := service.New(db)
+		router := mux.NewRouter()
+		router.HandleFunc("/token", s.GetToken).Methods("POST")
+		router.HandleFunc("/.well-known/jwks.json", s.JWKS).Methods("GET")
+		router.HandleFunc("/favorites", s.GetFavorites).Methods("GET")
+		router.Use(s.Authorize)
+		req, _ := http.NewRequest("POST", "/token", bytes.NewBuffer(byteUser))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var token data.Token
+		json.Unmarshal(rr.Body.Bytes(), &token)
+		return router, token
+	}
+	header := func(token string) map[string]interface{} {
+		part, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+		result := map[string]interface{}{}
+		json.Unmarshal(part, &result)
+		return result
+	}
+	authorized := func(router *mux.Router, token string) int {
+		req, _ := http.NewRequest("GET", "/favorites", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	_, oldToken := login(keys, "")
+	if h := header(oldToken.TokenString); h["kid"] != "rsa" || h["alg"] != "RS256" {
+		t.Fatalf("expected token signed by first key, got %v", h)
+	}
+	router, newToken := login(keys, "ec")
+	if h := header(newToken.TokenString); h["kid"] != "ec" || h["alg"] != "ES256" {
+		t.Fatalf("expected token signed by ec key, got %v", h)
+	}
+	if status := authorized(router, oldToken.TokenString); status != http.StatusOK {
+		t.Errorf("expected token of previous key to stay valid, got %v", status)
+	}
+	if status := authorized(router, newToken.TokenString); status != http.StatusOK {
+		t.Errorf("expected token of current key to be valid, got %v", status)
+	}
+	forged := strings.Replace(newToken.TokenString, strings.Split(newToken.TokenString, ".")[0],
+		base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"unknown","typ":"JWT"}`)), 1)
+	if status := authorized(router, forged); status != http.StatusUnauthorized {
+		t.Errorf("expected token of unknown kid to be rejected, got %v", status)
+	}
+	hmacRouter, _ := login("", "")
+	if status := authorized(hmacRouter, newToken.TokenString); status != http.StatusUnauthorized {
+		t.Errorf("expected asymmetric token to be rejected without keys, got %v", status)
+	}
+
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var jwks data.JWKSet
+	json.Unmarshal(rr.Body.Bytes(), &jwks)
+	if rr.Code != http.StatusOK || len(jwks.Keys) != 2 {
+		t.Fatalf("expected two public keys, got %v %v", rr.Code, rr.Body.String())
+	}
+	for _, key := range jwks.Keys {
+		if key.Kid == "ec" && (key.Kty != "EC" || key.Crv != "P-256" || len(key.X) != 43 || len(key.Y) != 43) {
+			t.Errorf("unexpected ec key %v", key)
+		}
+		if key.Kid == "rsa" && (key.Kty != "RSA" || key.Alg != "RS256" || key.N == "" || key.E != "AQAB") {
+			t.Errorf("unexpected rsa key %v", key)
+		}
+	}
+	if strings.Contains(rr.Body.String(), "\"d\"") {
+		t.Errorf("expected private keys not to be published, got %v", rr.Body.String())
+	}
+}
+
+func TestRefreshTokens(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	byteUser, _ := json.Marshal(CreateLogin(CreateUser()))
+	router := mux.NewRouter()
+	router.HandleFunc("/token", s.GetToken).Methods("POST")
+	router.HandleFunc("/token/refresh", s.RefreshToken).Methods("POST")
+	router.HandleFunc("/logout", s.Logout).Methods("POST")
+	router.HandleFunc("/favorites", s.GetFavorites).Methods("GET")
+	router.Use(s.Authorize)
+	request := func(method, url, token, body string) (int, data.Token) {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var response data.Token
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr.Code, response
+	}
+	refreshBody := func(token data.Token) string {
+		return `{"refreshToken":"` + token.RefreshToken + `"}`
+	}
+
+	status, first := request("POST", "/token", "", string(byteUser))
+	if status != http.StatusOK || first.TokenString == "" || first.RefreshToken == "" {
+		t.Fatalf("expected access and refresh tokens, got %v %v", status, first)
+	}
+	status, second := request("POST", "/token/refresh", "", refreshBody(first))
+	if status != http.StatusOK || second.TokenString == first.TokenString || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("expected rotated tokens, got %v %v", status, second)
+	}
+	if status, _ = request("GET", "/favorites", second.TokenString, ""); status != http.StatusOK {
+		t.Errorf("expected rotated access token to be valid, got %v", status)
+	}
+	if status, _ = request("POST", "/token/refresh", "", refreshBody(first)); status != http.StatusUnauthorized {
+		t.Errorf("expected reused refresh token to be rejected, got %v", status)
+	}
+	if status, _ = request("POST", "/token/refresh", "", refreshBody(second)); status != http.StatusUnauthorized {
+		t.Errorf("expected refresh token family to be revoked after reuse, got %v", status)
+	}
+	if status, _ = request("GET", "/favorites", second.TokenString, ""); status != http.StatusUnauthorized {
+		t.Errorf("expected access token family to be revoked after reuse, got %v", status)
+	}
+
+	_, third := request("POST", "/token", "", string(byteUser))
+	if status, _ = request("POST", "/logout", third.TokenString, ""); status != http.StatusOK {
+		t.Errorf("expected logout, got %v", status)
+	}
+	if status, _ = request("GET", "/favorites", third.TokenString, ""); status != http.StatusUnauthorized {
+		t.Errorf("expected access token to be revoked after logout, got %v", status)
+	}
+	if status, _ = request("POST", "/token/refresh", "", refreshBody(third)); status != http.StatusUnauthorized {
+		t.Errorf("expected refresh token to be revoked after logout, got %v", status)
+	}
+	if status, _ = request("POST", "/token/refresh", "", `{"refreshToken":"`+third.TokenString+`"}`); status != http.StatusUnauthorized {
+		t.Errorf("expected access token not to be accepted as refresh token, got %v", status)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	manager := data.New(db)
+	byteAdmin, _ := json.Marshal(CreateLogin(CreateAdminUser()))
+	adminToken, _ := manager.GetToken(byteAdmin)
+	byteUser, _ := json.Marshal(CreateLogin(CreateUser()))
+	userToken, _ := manager.GetToken(byteUser)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users", s.RegisterUser).Methods("POST")
+	router.HandleFunc("/users", s.GetUsers).Methods("GET")
+	router.HandleFunc("/users/{id}", s.GetUserByID).Methods("GET")
+	router.HandleFunc("/users/{id}", s.UpdateUser).Methods("PATCH")
+	router.HandleFunc("/users/{id}", s.DeactivateUser).Methods("DELETE")
+	router.Use(s.Authorize)
+
+	testCases := []struct {
+		name       string
+		method     string
+		url        string
+		token      string
+		body       string
+		statusCode int
+	}{
+		{"register", "POST", "/users", "", `{"name":"new","email":"new@gmail.com","password":"newpassword","role":"admin"}`, http.StatusCreated},
+		{"duplicate email", "POST", "/users", "", `{"name":"new","email":"new@gmail.com","password":"newpassword"}`, http.StatusConflict},
+		{"invalid email", "POST", "/users", "", `{"name":"new","email":"new.gmail.com","password":"newpassword"}`, http.StatusBadRequest},
+		{"short password", "POST", "/users", "", `{"name":"new","email":"new2@gmail.com","password":"new"}`, http.StatusBadRequest},
+		{"list as user", "GET", "/users", userToken.TokenString, "", http.StatusForbidden},
+		{"list as admin", "GET", "/users", adminToken.TokenString, "", http.StatusOK},
+		{"get unknown", "GET", "/users/100", adminToken.TokenString, "", http.StatusNotFound},
+		{"invalid role", "PATCH", "/users/3", adminToken.TokenString, `{"role":"owner"}`, http.StatusBadRequest},
+		{"change role", "PATCH", "/users/3", adminToken.TokenString, `{"role":"admin"}`, http.StatusOK},
+		{"deactivate as user", "DELETE", "/users/3", userToken.TokenString, "", http.StatusForbidden},
+		{"deactivate", "DELETE", "/users/3", adminToken.TokenString, "", http.StatusOK},
+	}
+	for _, tc := range testCases {
+		req, _ := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != tc.statusCode {
+			t.Errorf("`%v` failed, handler returned wrong status code: got %v want %v, %v", tc.name, status, tc.statusCode, rr.Body.String())
+		}
+		if tc.name == "register" || tc.name == "change role" {
+			var user data.User
+			json.Unmarshal(rr.Body.Bytes(), &user)
+			if (tc.name == "register" && user.Role != "user") || (tc.name == "change role" && user.Role != "admin") {
+				t.Errorf("`%v` failed, unexpected role %v", tc.name, user.Role)
+			}
+		}
+	}
+	byteNew, _ := json.Marshal(data.Authentication{Email: "new@gmail.com", Password: "newpassword"})
+	if _, err := manager.GetToken(byteNew); err == nil {
+		t.Errorf("expected deactivated user not to get token")
+	}
+
+	request := func(method, url, token string) int {
+		req, _ := http.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	old, err := manager.RegisterUser([]byte(`{"name":"old","email":"old@gmail.com","password":"oldpassword"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byteOld, _ := json.Marshal(data.Authentication{Email: "old@gmail.com", Password: "oldpassword"})
+	oldToken, _ := manager.GetToken(byteOld)
+	if code := request("GET", "/users", oldToken.TokenString); code != http.StatusForbidden {
+		t.Errorf("expected user token to be valid before role change, got %v", code)
+	}
+	if _, err := manager.UpdateUser(fmt.Sprint(old.ID), []byte(`{"role":"admin"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if code := request("GET", "/users", oldToken.TokenString); code != http.StatusUnauthorized {
+		t.Errorf("expected token issued before role change to get 401, got %v", code)
+	}
+	if _, err := manager.RefreshTokens([]byte(`{"refreshToken":"` + oldToken.RefreshToken + `"}`)); err == nil {
+		t.Errorf("expected refresh token issued before role change to be revoked")
+	}
+	adminOld, _ := manager.GetToken(byteOld)
+	if code := request("GET", "/users", adminOld.TokenString); code != http.StatusOK {
+		t.Errorf("expected promoted user to list users, got %v", code)
+	}
+	if code := request("DELETE", fmt.Sprintf("/users/%d", old.ID), adminToken.TokenString); code != http.StatusOK {
+		t.Fatalf("expected user to be deactivated, got %v", code)
+	}
+	if code := request("GET", "/users", adminOld.TokenString); code != http.StatusUnauthorized {
+		t.Errorf("expected token issued before deactivation to get 401, got %v", code)
+	}
+	if _, err := manager.RefreshTokens([]byte(`{"refreshToken":"` + adminOld.RefreshToken + `"}`)); err == nil {
+		t.Errorf("expected refresh token issued before deactivation to be revoked")
+	}
+}
+
+func TestAddFavorite(t *testing.T) {
+	byteMovie, _ := json.Marshal(CreateFavorites())
+	reader := bytes.NewReader(byteMovie)
+	db := initDB()
+	s := service.New(db)
+	movie, _ := json.Marshal(CreateTestMovie())
+	data.New(db).AddMovie(movie)
+	byteUser, _ := json.Marshal(CreateLogin(CreateUser()))
+	token, _ := data.New(db).GetToken(byteUser)
+	req, err := http.NewRequest("POST", "/favorites", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := s.Authorize(http.HandlerFunc(s.AddFavorite))
+	req.Header.Set("Authorization", "Bearer "+token.TokenString)
+
+	handler.ServeHTTP(rr, req)
+
+	// Check the status code is what we expect.
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusCreated)
+	}
+	var favorite data.UserMedia
+	json.Unmarshal(rr.Body.Bytes(), &favorite)
+	if favorite.UserID == nil || *favorite.UserID != 2 {
+		t.Errorf("expected favorite of authenticated user 2, got %v", rr.Body.String())
+	}
+
+	codes := make(chan int, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "/favorites", bytes.NewReader(byteMovie))
+			req.Header.Set("Authorization", "Bearer "+token.TokenString)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			codes <- rr.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusConflict {
+			t.Errorf("expected duplicate favorites to conflict, got %v", code)
+		}
+	}
+	favorites, _ := data.New(db).GetFavorites("2", data.MediaFilter{}, data.Sort{}, data.Page{Size: 10})
+	if favorites.Total != 1 {
+		t.Errorf("expected one favorite, got %d", favorites.Total)
+	}
+	if err := data.New(db).DeleteMediaByID(fmt.Sprint(*favorite.MediaID), ""); err != nil {
+		t.Fatal(err)
+	}
+	favorites, _ = data.New(db).GetFavorites("2", data.MediaFilter{}, data.Sort{}, data.Page{Size: 10})
+	if _, err := db.FindFavorite(favorite.ID); favorites.Total != 0 || !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected favorites of deleted media to be deleted, got %d %v", favorites.Total, err)
+	}
+}
+
+func TestFavoritesOwnership(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	movie, _ := json.Marshal(CreateTestMovie())
+	data.New(db).AddMovie(movie)
+	data.New(db).AddMovie(movie)
+	byteAdmin, _ := json.Marshal(CreateLogin(CreateAdminUser()))
+	adminToken, _ := data.New(db).GetToken(byteAdmin)
+	byteUser, _ := json.Marshal(CreateLogin(CreateUser()))
+	userToken, _ := data.New(db).GetToken(byteUser)
+	router := mux.NewRouter()
+	router.HandleFunc("/favorites", s.AddFavorite).Methods("POST")
+	router.HandleFunc("/favorites", s.GetFavorites).Methods("GET")
+	router.HandleFunc("/favorites/{id}", s.DeleteFavoriteByID).Methods("DELETE")
+	router.HandleFunc("/users/{id}/favorites", s.GetUserFavorites).Methods("GET")
+	router.Use(s.Authorize)
+	request := func(method, url, token, body string) (int, []byte) {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code, rr.Body.Bytes()
+	}
+	favorites := func(url, token string) (int, data.FavoriteList) {
+		status, body := request("GET", url, token, "")
+		var list data.FavoriteList
+		json.Unmarshal(body, &list)
+		return status, list
+	}
+
+	for _, tc := range []struct {
+		name       string
+		token      string
+		body       string
+		statusCode int
+	}{
+		{"user favorite", userToken.TokenString, `{"mediaId":1,"userId":1}`, http.StatusCreated},
+		{"admin favorite", adminToken.TokenString, `{"mediaId":2}`, http.StatusCreated},
+		{"duplicate favorite", userToken.TokenString, `{"mediaId":1}`, http.StatusConflict},
+		{"unknown media", userToken.TokenString, `{"mediaId":99}`, http.StatusBadRequest},
+		{"without media", userToken.TokenString, `{}`, http.StatusBadRequest},
+		{"invalid body", userToken.TokenString, `{"mediaId":"1"}`, http.StatusBadRequest},
+	} {
+		if status, body := request("POST", "/favorites", tc.token, tc.body); status != tc.statusCode {
+			t.Errorf("`%s` failed, got %v %s want %v", tc.name, status, body, tc.statusCode)
+		}
+	}
+
+	status, list := favorites("/favorites?userId=1", userToken.TokenString)
+	if status != http.StatusOK || list.Total != 1 || *list.Items[0].UserID != 2 || *list.Items[0].MediaID != 1 {
+		t.Fatalf("expected only own favorite, got %v %v", status, list)
+	}
+	userFavorite := list.Items[0].ID
+	_, list = favorites("/favorites", adminToken.TokenString)
+	adminFavorite := list.Items[0].ID
+
+	if status, list = favorites("/users/2/favorites", adminToken.TokenString); status != http.StatusOK || list.Total != 1 || list.Items[0].ID != userFavorite {
+		t.Errorf("expected admin to get favorites of user, got %v %v", status, list)
+	}
+	if status, _ = favorites("/users/1/favorites", userToken.TokenString); status != http.StatusForbidden {
+		t.Errorf("expected user to be forbidden from favorites of other users, got %v", status)
+	}
+	if status, _ = favorites("/users/99/favorites", adminToken.TokenString); status != http.StatusNotFound {
+		t.Errorf("expected unknown user not to be found, got %v", status)
+	}
+
+	if status, _ := request("DELETE", fmt.Sprintf("/favorites/%d", adminFavorite), userToken.TokenString, ""); status != http.StatusNotFound {
+		t.Errorf("expected favorite of other user not to be found, got %v", status)
+	}
+	if status, _ := request("DELETE", "/favorites/99", userToken.TokenString, ""); status != http.StatusNotFound {
+		t.Errorf("expected unknown favorite not to be found, got %v", status)
+	}
+	if status, _ := request("DELETE", fmt.Sprintf("/favorites/%d", userFavorite), userToken.TokenString, ""); status != http.StatusOK {
+		t.Errorf("expected own favorite to be deleted, got %v", status)
+	}
+	if status, list = favorites("/favorites", adminToken.TokenString); list.Total != 1 {
+		t.Errorf("expected favorite of admin to be kept, got %v %v", status, list)
+	}
+	if status, _ := request("POST", "/favorites", userToken.TokenString, `{"mediaId":1}`); status != http.StatusCreated {
+		t.Errorf("expected deleted favorite to be added again, got %v", status)
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	byteMovie, _ := json.Marshal(CreateTestMovie())
+	data.New(db).AddMovie(byteMovie)
+	byteAdmin, _ := json.Marshal(CreateLogin(CreateAdminUser()))
+	adminToken, _ := data.New(db).GetToken(byteAdmin)
+	byteUser, _ := json.Marshal(CreateLogin(CreateUser()))
+	userToken, _ := data.New(db).GetToken(byteUser)
+	router := mux.NewRouter()
+	router.HandleFunc("/movies", s.AddMovie).Methods("POST")
+	router.HandleFunc("/movies/{id}", s.GetMovieByID).Methods("GET")
+	router.HandleFunc("/users", s.RegisterUser).Methods("POST")
+	router.HandleFunc("/token", s.GetToken).Methods("POST")
+	router.Use(s.RequestID)
+	router.Use(s.Authorize)
+
+	testCases := []struct {
+		name       string
+		method     string
+		url        string
+		token      string
+		body       string
+		statusCode int
+		code       string
+	}{
+		{"invalid id", "GET", "/movies/abc", userToken.TokenString, "", http.StatusBadRequest, types.CodeKeyRequired},
+		{"unknown id", "GET", "/movies/99", userToken.TokenString, "", http.StatusNotFound, types.CodeNotFound},
+		{"without token", "GET", "/movies/1", "", "", http.StatusUnauthorized, types.CodeNoToken},
+		{"invalid token", "GET", "/movies/1", "invalid", "", http.StatusUnauthorized, types.CodeInvalidToken},
+		{"user adds movie", "POST", "/movies", userToken.TokenString, string(byteMovie), http.StatusForbidden, types.CodeNotAllowed},
+		{"invalid movie body", "POST", "/movies", adminToken.TokenString, `{"title":1}`, http.StatusBadRequest, types.CodeInvalidBody},
+		{"duplicate email", "POST", "/users", "", `{"name":"user","email":"user2@gmail.com","password":"password1"}`, http.StatusConflict, types.CodeEmailExists},
+		{"wrong password", "POST", "/token", "", `{"email":"user2@gmail.com","password":"wrong"}`, http.StatusUnauthorized, types.CodeInvalidCredentials},
+		{"unknown email", "POST", "/token", "", `{"email":"unknown@gmail.com","password":"wrong"}`, http.StatusUnauthorized, types.CodeInvalidCredentials},
+	}
+	for _, tc := range testCases {
+		req, _ := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		req.Header.Set(service.RequestIDHeader, "request-"+tc.name)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tc.statusCode {
+			t.Errorf("`%s` failed, got %v want %v", tc.name, rr.Code, tc.statusCode)
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != types.ProblemContentType {
+			t.Errorf("`%s` expected problem content type, got %v", tc.name, contentType)
+		}
+		decoder := json.NewDecoder(rr.Body)
+		var problem types.Problem
+		if err := decoder.Decode(&problem); err != nil {
+			t.Errorf("`%s` expected problem body, got %v", tc.name, err)
+			continue
+		}
+		if decoder.More() {
+			t.Errorf("`%s` expected single response body", tc.name)
+		}
+		if problem.Code != tc.code || problem.Status != tc.statusCode || problem.Title != http.StatusText(tc.statusCode) || problem.Detail == "" {
+			t.Errorf("`%s` unexpected problem %+v", tc.name, problem)
+		}
+		if problem.RequestID != "request-"+tc.name || rr.Header().Get(service.RequestIDHeader) != problem.RequestID {
+			t.Errorf("`%s` expected request id to be kept, got %v %v", tc.name, problem.RequestID, rr.Header().Get(service.RequestIDHeader))
+		}
+		if problem.Instance != tc.url {
+			t.Errorf("`%s` expected instance %v, got %v", tc.name, tc.url, problem.Instance)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/movies/99", nil)
+	req.Header.Set("Authorization", "Bearer "+userToken.TokenString)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var problem types.Problem
+	json.Unmarshal(rr.Body.Bytes(), &problem)
+	if problem.RequestID == "" || rr.Header().Get(service.RequestIDHeader) != problem.RequestID {
+		t.Errorf("expected generated request id, got %v", rr.Body.String())
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	wrapped := fmt.Errorf("lookup failed: %w", types.NewNotFound(types.CodeNotFound, "missing"))
+	testCases := []struct {
+		err        error
+		statusCode int
+	}{
+		{types.NewValidation(types.CodeInvalidBody, "invalid"), http.StatusBadRequest},
+		{wrapped, http.StatusNotFound},
+		{data.ErrEmailExists, http.StatusConflict},
+		{types.NewUnauthorized(types.CodeInvalidToken, "invalid"), http.StatusUnauthorized},
+		{types.NewForbidden(types.CodeNotAllowed, "forbidden"), http.StatusForbidden},
+		{types.NewUpstream(types.CodeUpstreamFailed, "failed", fmt.Errorf("timeout")), http.StatusBadGateway},
+		{fmt.Errorf("database is down"), http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		if status := types.StatusOf(tc.err); status != tc.statusCode {
+			t.Errorf("expected status %v of %v, got %v", tc.statusCode, tc.err, status)
+		}
+	}
+	if problem := types.NewProblem(fmt.Errorf("password=secret"), "/", "id"); problem.Detail != types.InternalServerError || problem.Code != types.CodeInternal {
+		t.Errorf("expected internal error details to be hidden, got %+v", problem)
+	}
+	if err := fmt.Errorf("register: %w", types.NewConflict(types.CodeEmailExists, "other message")); !errors.Is(err, data.ErrEmailExists) {
+		t.Errorf("expected errors with same kind and code to match")
+	}
+}
+
+func TestConcurrentRoles(t *testing.T) {
+	db := initDB()
+	s := service.New(db)
+	byteAdmin, _ := json.Marshal(CreateLogin(CreateAdminUser()))
+	adminToken, _ := data.New(db).GetToken(byteAdmin)
+	byteUser, _ := json.Marshal(CreateLogin(CreateUser()))
+	userToken, _ := data.New(db).GetToken(byteUser)
+	byteMovie, _ := json.Marshal(CreateTestMovie())
+	handler := s.Authorize(http.HandlerFunc(s.AddMovie))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		for _, tp := range []struct {
+			token      string
+			statusCode int
+		}{
+			{adminToken.TokenString, http.StatusCreated},
+			{userToken.TokenString, http.StatusForbidden},
+		} {
+			wg.Add(1)
+			go func(token string, statusCode int) {
+				defer wg.Done()
+				req, _ := http.NewRequest("POST", "/movies", bytes.NewReader(byteMovie))
+				req.Header.Set("Authorization", "Bearer "+token)
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				if status := rr.Code; status != statusCode {
+					t.Errorf("handler returned wrong status code: got %v want %v", status, statusCode)
+				}
+			}(tp.token, tp.statusCode)
+		}
+	}
+	wg.Wait()
+
+	movies, _ := data.New(db).GetMovies(data.MediaFilter{}, nil, data.Page{Size: 100})
+	if movies.Total != 50 {
+		t.Errorf("expected 50 movies added by admin requests, got %d", movies.Total)
+	}
+}
+
+func TestGetSuggestions(t *testing.T) {
+	omdb := NewFakeOMDb()
+	defer omdb.Close()
+	testCases := map[string]struct {
+		name       string
+		apiKey     string
+		statusCode int
+		code       string
+	}{
+		"movie":           {"Matrix", FakeOMDbKey, http.StatusOK, ""},
+		"series":          {"Severance", FakeOMDbKey, http.StatusOK, ""},
+		"without params":  {"", FakeOMDbKey, http.StatusBadRequest, types.CodeKeyRequired},
+		"not found":       {"Unknown", FakeOMDbKey, http.StatusNotFound, types.CodeNotFound},
+		"invalid api key": {"Matrix", "wrong-key", http.StatusBadGateway, types.CodeUpstreamFailed},
+		"provider error":  {"broken", FakeOMDbKey, http.StatusBadGateway, types.CodeUpstreamFailed},
+		"timeout":         {"slow", FakeOMDbKey, http.StatusBadGateway, types.CodeUpstreamFailed},
+	}
+	db := initDB()
+	byteUser, _ := json.Marshal(CreateLogin(CreateAdminUser()))
+	token, _ := data.New(db).GetToken(byteUser)
+
+	for tc, tp := range testCases {
+		s := service.NewWithMetadata(db, NewFakeOMDbClient(omdb, tp.apiKey))
+		req, err := http.NewRequest("GET", "/suggestions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tp.name != "" {
+			req.URL.RawQuery = url.Values{"name": {tp.name}}.Encode()
+		}
+		rr := httptest.NewRecorder()
 		handler := s.Authorize(http.HandlerFunc(s.GetSuggestions))
 		req.Header.Set("Authorization", "Bearer "+token.TokenString)
-
 		handler.ServeHTTP(rr, req)
 
-		// Check the status code is what we expect.
 		if status := rr.Code; status != tp.statusCode {
-			t.Errorf("`%v` failed, handler returned wrong status code: got %v want %v",
-				tc, status, tp.statusCode)
+			t.Errorf("`%v` failed, handler returned wrong status code: got %v want %v", tc, status, tp.statusCode)
+			continue
+		}
+		if tp.code != "" {
+			var problem types.Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if problem.Code != tp.code || strings.Contains(rr.Body.String(), tp.apiKey) {
+				t.Errorf("`%v` expected problem %s without api key, got %v", tc, tp.code, rr.Body.String())
+			}
+			continue
+		}
+		var response data.Media
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Errorf("`%v` got invalid response, expected media, got: %v", tc, rr.Body.String())
+		}
+		switch tc {
+		case "movie":
+			if response.Title != "The Matrix" || response.Type != data.Movie || response.ImdbID != "tt0133093" || *response.DurationMinutes != 136 {
+				t.Errorf("expected movie The Matrix, got %v", rr.Body.String())
+			}
+		case "series":
+			titles := []string{}
+			for _, season := range response.Seasons {
+				for _, episode := range season.Episode {
+					titles = append(titles, fmt.Sprintf("%d/%s/%s", season.Season, episode.Episode, episode.Media.Title))
+				}
+			}
+			if response.Type != data.Series || fmt.Sprint(titles) != "[1/1/Episode tt1 1/2/Episode tt2 2/1/Episode tt3]" {
+				t.Errorf("expected series with seasons and episodes in order, got %v", titles)
+			}
+		}
+	}
+}
+
+func TestOMDbClient(t *testing.T) {
+	omdb := NewFakeOMDb()
+	defer omdb.Close()
+	ctx := context.Background()
+	client := NewFakeOMDbClient(omdb, FakeOMDbKey)
+
+	movie, err := client.ByID(ctx, "tt0133093")
+	if err != nil || movie.Title != "The Matrix" || movie.Released != "31 Mar 1999" || movie.Actors != "Keanu Reeves, Laurence Fishburne" {
+		t.Errorf("expected movie given IMDb id, got %v %v", movie, err)
+	}
+	season, err := client.Season(ctx, "tt11280740", 1)
+	if err != nil || season.Season != "1" || len(season.Episodes) != 2 || season.Episodes[1].ImdbID != "tt2" {
+		t.Errorf("expected episodes of season, got %v %v", season, err)
+	}
+	for _, tc := range []struct {
+		title    string
+		client   metadata.Client
+		expected error
+	}{
+		{"Unknown", client, metadata.ErrNotFound},
+		{"Matrix", NewFakeOMDbClient(omdb, "wrong-key"), metadata.ErrUnauthorized},
+		{"broken", client, metadata.ErrUnavailable},
+		{"slow", client, metadata.ErrUnavailable},
+	} {
+		_, err := tc.client.ByTitle(ctx, tc.title)
+		if !errors.Is(err, tc.expected) || strings.Contains(fmt.Sprint(err), "apikey") {
+			t.Errorf("`%s` expected %v without api key, got %v", tc.title, tc.expected, err)
+		}
+	}
+	_, err = client.ByTitle(ctx, "broken")
+	var lookupErr *metadata.Error
+	if !errors.As(err, &lookupErr) || lookupErr.Status != http.StatusInternalServerError {
+		t.Errorf("expected status of failed response, got %v", err)
+	}
+	unreachable := metadata.NewOMDb("http://127.0.0.1:1", FakeOMDbKey, time.Second, time.Second)
+	if _, err = unreachable.ByTitle(ctx, "Matrix"); !errors.Is(err, metadata.ErrUnavailable) {
+		t.Errorf("expected unreachable provider to be unavailable, got %v", err)
+	}
+}
+
+func TestFetchSeasons(t *testing.T) {
+	ctx := context.Background()
+	provider := &FakeProvider{Seasons: 3, Episodes: 4, Latency: 5 * time.Millisecond}
+	fetcher := &metadata.Fetcher{Client: provider, Workers: 3, Timeout: time.Second}
+	seasons, failures, err := fetcher.FetchSeasons(ctx, provider.FakeSeries())
+	ids := []string{}
+	for _, season := range seasons {
+		for _, episode := range season.Episodes {
+			ids = append(ids, season.Season+"/"+episode.EpisodeContent.ImdbID)
 		}
-		if tc == "good params" {
-			var response data.Media
-			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-				t.Errorf("got invalid response, expected list of movies, got: %v", rr.Body.String())
+	}
+	if err != nil || len(failures) != 0 || fmt.Sprint(ids) != "[1/ep1-1 1/ep1-2 1/ep1-3 1/ep1-4 2/ep2-1 2/ep2-2 2/ep2-3 2/ep2-4 3/ep3-1 3/ep3-2 3/ep3-3 3/ep3-4]" {
+		t.Errorf("expected seasons and episodes in order, got %v %v %v", ids, failures, err)
+	}
+	if provider.MaxActive < 2 || provider.MaxActive > fetcher.Workers {
+		t.Errorf("expected at most %d concurrent lookups, got %d", fetcher.Workers, provider.MaxActive)
+	}
+
+	provider = &FakeProvider{Seasons: 3, Episodes: 2, Failing: map[string]bool{"2": true, "ep3-1": true}}
+	seasons, failures, err = (&metadata.Fetcher{Client: provider, Workers: 2}).FetchSeasons(ctx, provider.FakeSeries())
+	if err != nil || len(seasons) != 2 || seasons[1].Season != "3" || seasons[1].Episodes[0].EpisodeContent.Title != "Episode ep3-1" || seasons[1].Episodes[0].EpisodeContent.Runtime != "" {
+		t.Errorf("expected failed season left out and failed episode with title of season, got %v %v", seasons, err)
+	}
+	if len(failures) != 2 || failures[0].Season != 2 || failures[0].Episode != "" || failures[1].Season != 3 || failures[1].Episode != "1" || failures[1].ImdbID != "ep3-1" || failures[1].Error == "" {
+		t.Errorf("expected failures of season 2 and episode 1 of season 3, got %v", failures)
+	}
+
+	provider = &FakeProvider{Seasons: 1000000, Failing: map[string]bool{"3": true}}
+	seasons, failures, err = (&metadata.Fetcher{Client: provider, Workers: 8}).FetchSeasons(ctx, provider.FakeSeries())
+	if err != nil || len(seasons) != metadata.MaxSeasons-1 || provider.Calls != metadata.MaxSeasons {
+		t.Errorf("expected only %d seasons to be looked up, got %d seasons with %d lookups %v", metadata.MaxSeasons, len(seasons), provider.Calls, err)
+	}
+	if len(failures) != 2 || failures[0].Season != 3 || failures[1].Season != metadata.MaxSeasons+1 || !strings.Contains(failures[1].Error, "1000000") {
+		t.Errorf("expected failure of season 3 and of seasons after %d, got %v", metadata.MaxSeasons, failures)
+	}
+
+	provider = &FakeProvider{Seasons: 5, Episodes: 10, Latency: 20 * time.Millisecond}
+	timeout, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err = (&metadata.Fetcher{Client: provider, Workers: 2}).FetchSeasons(timeout, provider.FakeSeries())
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 300*time.Millisecond {
+		t.Errorf("expected lookups to stop when context is done, got %v after %v", err, time.Since(start))
+	}
+
+	db := initDB()
+	byteUser, _ := json.Marshal(CreateLogin(CreateAdminUser()))
+	token, _ := data.New(db).GetToken(byteUser)
+	provider = &FakeProvider{Seasons: 2, Episodes: 2, Failing: map[string]bool{"ep2-2": true}}
+	s := service.NewWithMetadata(db, provider)
+	req, _ := http.NewRequest("GET", "/suggestions?name=Fake", nil)
+	req.Header.Set("Authorization", "Bearer "+token.TokenString)
+	rr := httptest.NewRecorder()
+	s.Authorize(http.HandlerFunc(s.GetSuggestions)).ServeHTTP(rr, req)
+	var response metadata.Suggestion
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if rr.Code != http.StatusOK || response.Media == nil || len(response.Seasons) != 2 || len(response.Failures) != 1 || response.Failures[0].ImdbID != "ep2-2" {
+		t.Errorf("expected series with failed episode in failures, got %v %v", rr.Code, rr.Body.String())
+	}
+}
+
+func BenchmarkFetchSeasons(b *testing.B) {
+	provider := &FakeProvider{Seasons: 4, Episodes: 8, Latency: 2 * time.Millisecond}
+	for _, bc := range []struct {
+		name    string
+		workers int
+	}{
+		{"serial", 1},
+		{"pool-4", 4},
+		{"pool-8", 8},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			fetcher := &metadata.Fetcher{Client: provider, Workers: bc.workers, Timeout: time.Second}
+			for i := 0; i < b.N; i++ {
+				if _, failures, err := fetcher.FetchSeasons(context.Background(), provider.FakeSeries()); err != nil || len(failures) > 0 {
+					b.Fatal(failures, err)
+				}
 			}
-			if response.Title != "Matrix" {
-				t.Errorf("expected at least 1 movie named Matrix, got %v", response.Title)
+		})
+	}
+}
+
+func TestMetadataCache(t *testing.T) {
+	ctx := context.Background()
+	provider := &FakeProvider{Seasons: 2, Episodes: 2, Failing: map[string]bool{"2": true}}
+	store, err := metadata.NewFileCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := metadata.NewCache(provider, store, 2, time.Hour)
+
+	for _, title := range []string{"Fake", "fake "} {
+		if series, err := cache.ByTitle(ctx, title); err != nil || series.ImdbID != "tt0" {
+			t.Errorf("expected series of title %s, got %v %v", title, series, err)
+		}
+	}
+	season, _ := cache.Season(ctx, "tt0", 1)
+	season.Episodes[0].Title = "changed"
+	season, _ = cache.Season(ctx, "tt0", 1)
+	if season.Episodes[0].Title != "Episode ep1-1" {
+		t.Errorf("expected cached season to be unchanged by callers, got %v", season.Episodes[0].Title)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Season(ctx, "tt0", 2); err == nil {
+			t.Errorf("expected failed lookup of season 2")
+		}
+	}
+	if stats := cache.Stats(); provider.Calls != 4 || stats.Hits != 2 || stats.Misses != 4 || stats.Entries != 2 {
+		t.Errorf("expected failed lookups not to be cached, got %d calls and %+v", provider.Calls, stats)
+	}
+
+	cache.ByID(ctx, "ep1-1")
+	cache.ByID(ctx, "ep1-2")
+	cache.ByTitle(ctx, "Fake")
+	if provider.Calls != 6 || cache.Stats().Entries != 2 {
+		t.Errorf("expected least recently used entries to be evicted from memory and loaded from store, got %d calls and %+v", provider.Calls, cache.Stats())
+	}
+	restarted := metadata.NewCache(provider, store, 10, time.Hour)
+	restarted.Season(ctx, "tt0", 1)
+	if provider.Calls != 6 || restarted.Stats().Hits != 1 {
+		t.Errorf("expected stored entries to outlive cache, got %d calls and %+v", provider.Calls, restarted.Stats())
+	}
+	expiring := metadata.NewCache(provider, nil, 10, 10*time.Millisecond)
+	expiring.ByID(ctx, "ep2-1")
+	time.Sleep(20 * time.Millisecond)
+	expiring.ByID(ctx, "ep2-1")
+	if provider.Calls != 8 {
+		t.Errorf("expected expired entries to be looked up again, got %d calls", provider.Calls)
+	}
+
+	db := initDB()
+	var admin, user data.Token
+	for _, tc := range []struct {
+		user  data.User
+		token *data.Token
+	}{{CreateAdminUser(), &admin}, {CreateUser(), &user}} {
+		byteUser, _ := json.Marshal(CreateLogin(tc.user))
+		*tc.token, _ = data.New(db).GetToken(byteUser)
+	}
+	s := service.NewWithMetadata(db, cache)
+	request := func(method, query string, token data.Token, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/admin/cache?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token.TokenString)
+		rr := httptest.NewRecorder()
+		s.Authorize(handler).ServeHTTP(rr, req)
+		return rr
+	}
+	var stats metadata.CacheStats
+	rr := request("GET", "", admin, s.GetMetadataCache)
+	json.Unmarshal(rr.Body.Bytes(), &stats)
+	if rr.Code != http.StatusOK || stats.Hits != 3 || stats.Misses != 6 || stats.Entries != 2 {
+		t.Errorf("expected cache counters, got %v %v", rr.Code, rr.Body.String())
+	}
+	if rr = request("DELETE", "", user, s.PurgeMetadataCache); rr.Code != http.StatusForbidden {
+		t.Errorf("expected purge of user to be forbidden, got %v", rr.Code)
+	}
+	for _, query := range []string{"", "all=false", "title=%20"} {
+		var problem types.Problem
+		rr = request("DELETE", query, admin, s.PurgeMetadataCache)
+		json.Unmarshal(rr.Body.Bytes(), &problem)
+		if rr.Code != http.StatusBadRequest || problem.Code != types.CodePurgeSelectorRequired {
+			t.Errorf("expected purge without selector %q to fail, got %v %v", query, rr.Code, rr.Body.String())
+		}
+	}
+	cache.Search(ctx, metadata.SearchQuery{Title: "fak", Page: 1})
+	cache.Search(ctx, metadata.SearchQuery{Title: "other", Page: 1})
+	var purge service.CachePurge
+	rr = request("DELETE", "imdbId=tt0", admin, s.PurgeMetadataCache)
+	json.Unmarshal(rr.Body.Bytes(), &purge)
+	if rr.Code != http.StatusOK || purge.Purged != 3 {
+		t.Errorf("expected season, title and search resolving to tt0 to be purged, got %v %v", rr.Code, rr.Body.String())
+	}
+	cache.ByTitle(ctx, "Fake")
+	if provider.Calls != 11 {
+		t.Errorf("expected title of purged IMDb id to be looked up again, got %d calls", provider.Calls)
+	}
+	rr = request("DELETE", "all=true", admin, s.PurgeMetadataCache)
+	json.Unmarshal(rr.Body.Bytes(), &purge)
+	if rr.Code != http.StatusOK || purge.Purged != 4 || cache.Stats().Entries != 0 {
+		t.Errorf("expected all entries to be purged, got %v %v", rr.Code, rr.Body.String())
+	}
+	cache.ByTitle(ctx, "Fake")
+	if provider.Calls != 12 {
+		t.Errorf("expected purged entries to be looked up again, got %d calls", provider.Calls)
+	}
+	s = service.NewWithMetadata(db, provider)
+	if rr = request("GET", "", admin, s.GetMetadataCache); rr.Code != http.StatusNotFound {
+		t.Errorf("expected not found without cache, got %v", rr.Code)
+	}
+}
+
+func TestImports(t *testing.T) {
+	omdb := NewFakeOMDb()
+	defer omdb.Close()
+	db := initDB()
+	var admin, user data.Token
+	for _, tc := range []struct {
+		user  data.User
+		token *data.Token
+	}{{CreateAdminUser(), &admin}, {CreateUser(), &user}} {
+		byteUser, _ := json.Marshal(CreateLogin(tc.user))
+		*tc.token, _ = data.New(db).GetToken(byteUser)
+	}
+	request := func(s service.Manager, body string, token data.Token) (*httptest.ResponseRecorder, service.Import) {
+		req, _ := http.NewRequest("POST", "/imports", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token.TokenString)
+		rr := httptest.NewRecorder()
+		s.Authorize(http.HandlerFunc(s.ImportMedia)).ServeHTTP(rr, req)
+		var result service.Import
+		json.Unmarshal(rr.Body.Bytes(), &result)
+		return rr, result
+	}
+	s := service.NewWithMetadata(db, NewFakeOMDbClient(omdb, FakeOMDbKey))
+	var seriesID uint
+	for _, tc := range []struct {
+		name       string
+		body       string
+		token      data.Token
+		statusCode int
+		expected   string
+	}{
+		{"dry run", `{"title":"Severance","dryRun":true}`, admin, http.StatusOK, data.ImportDryRun},
+		{"series", `{"imdbId":"tt11280740"}`, admin, http.StatusCreated, data.ImportCreated},
+		{"existing series", `{"title":"Severance"}`, admin, http.StatusOK, data.ImportExists},
+		{"dry run of existing series", `{"imdbId":"tt11280740","dryRun":true}`, admin, http.StatusOK, data.ImportExists},
+		{"movie", `{"title":"Matrix"}`, admin, http.StatusCreated, data.ImportCreated},
+		{"without key", `{"dryRun":true}`, admin, http.StatusBadRequest, types.CodeKeyRequired},
+		{"both keys", `{"title":"Matrix","imdbId":"tt0133093"}`, admin, http.StatusBadRequest, types.CodeKeyRequired},
+		{"invalid body", `{"title":`, admin, http.StatusBadRequest, types.CodeInvalidBody},
+		{"episode", `{"imdbId":"tt1"}`, admin, http.StatusBadRequest, types.CodeInvalidFields},
+		{"not found", `{"title":"Unknown"}`, admin, http.StatusNotFound, types.CodeNotFound},
+		{"provider error", `{"title":"broken"}`, admin, http.StatusBadGateway, types.CodeUpstreamFailed},
+		{"user", `{"title":"Matrix"}`, user, http.StatusForbidden, types.CodeNotAllowed},
+	} {
+		rr, result := request(s, tc.body, tc.token)
+		if rr.Code != tc.statusCode {
+			t.Errorf("`%s` expected status %d, got %d %s", tc.name, tc.statusCode, rr.Code, rr.Body.String())
+			continue
+		}
+		if rr.Code >= http.StatusBadRequest {
+			var problem types.Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if problem.Code != tc.expected {
+				t.Errorf("`%s` expected problem %s, got %s", tc.name, tc.expected, rr.Body.String())
+			}
+			continue
+		}
+		if result.Status != tc.expected || result.Media == nil {
+			t.Errorf("`%s` expected %s, got %s", tc.name, tc.expected, rr.Body.String())
+			continue
+		}
+		switch tc.name {
+		case "dry run":
+			if result.Media.ID != 0 || result.Seasons != 2 || result.Episodes != 3 {
+				t.Errorf("expected series with 2 seasons and 3 episodes that is not stored, got %s", rr.Body.String())
+			}
+		case "series":
+			seriesID = result.Media.ID
+			stored, err := data.New(db).GetSeriesByID(fmt.Sprint(seriesID))
+			if err != nil || len(stored.Seasons) != 2 || len(stored.Seasons[0].Episode) != 2 || stored.Seasons[1].Episode[0].Media.Title != "Episode tt3" {
+				t.Errorf("expected series stored with seasons and episodes, got %v %v", stored, err)
+			}
+		case "movie":
+			stored, err := data.New(db).GetMovieByID(fmt.Sprint(result.Media.ID))
+			stars := []string{}
+			for _, credit := range stored.Credits {
+				if credit.Role == data.CreditStar {
+					stars = append(stars, credit.Person.Name)
+				}
+			}
+			if err != nil || stored.Stars != "Keanu Reeves, Laurence Fishburne" || fmt.Sprint(stars) != "[Keanu Reeves Laurence Fishburne]" {
+				t.Errorf("expected movie stored with star credits, got %v %v", stored, err)
+			}
+		case "existing series", "dry run of existing series":
+			if result.Media.ID != seriesID || result.Seasons != 2 {
+				t.Errorf("`%s` expected existing series %d, got %s", tc.name, seriesID, rr.Body.String())
+			}
+		}
+	}
+
+	provider := &FakeProvider{Seasons: 2, Episodes: 2, Failing: map[string]bool{"ep1-1": true}}
+	s = service.NewWithMetadata(db, provider)
+	rr, result := request(s, `{"title":"Fake","dryRun":true}`, admin)
+	if rr.Code != http.StatusOK || result.Status != data.ImportDryRun || len(result.Failures) != 1 {
+		t.Errorf("expected dry run to list failures, got %v %s", rr.Code, rr.Body.String())
+	}
+	rr, _ = request(s, `{"title":"Fake"}`, admin)
+	if rr.Code != http.StatusBadGateway || !strings.Contains(rr.Body.String(), types.CodeImportIncomplete) {
+		t.Errorf("expected incomplete import to fail, got %v %s", rr.Code, rr.Body.String())
+	}
+
+	provider.Failing = nil
+	codes := make(chan int, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr, _ := request(s, `{"imdbId":"tt0"}`, admin)
+			codes <- rr.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	created := 0
+	for code := range codes {
+		if code == http.StatusCreated {
+			created++
+		}
+	}
+	series, _ := data.New(db).GetSeries(data.MediaFilter{Title: "Fake"}, data.Sort{}, data.Page{Size: 10})
+	if created != 1 || series.Total != 1 {
+		t.Errorf("expected concurrent imports to create series once, got %d created and %d stored", created, series.Total)
+	}
+}
+
+func TestSearchSuggestions(t *testing.T) {
+	omdb := NewFakeOMDb()
+	defer omdb.Close()
+	db := initDB()
+	var admin, user data.Token
+	for _, tc := range []struct {
+		user  data.User
+		token *data.Token
+	}{{CreateAdminUser(), &admin}, {CreateUser(), &user}} {
+		byteUser, _ := json.Marshal(CreateLogin(tc.user))
+		*tc.token, _ = data.New(db).GetToken(byteUser)
+	}
+	s := service.NewWithMetadata(db, NewFakeOMDbClient(omdb, FakeOMDbKey))
+	for _, tc := range []struct {
+		name       string
+		query      string
+		token      data.Token
+		client     metadata.Client
+		statusCode int
+		expected   string
+	}{
+		{"first page", "name=matrix", admin, nil, http.StatusOK, "12 1 10 The Matrix/1999/movie/tt0133093 next"},
+		{"second page", "name=matrix&page=2", admin, nil, http.StatusOK, "12 2 2 Matrix Fan Film 7/2010/movie/tt9000007 prev"},
+		{"year", "name=Matrix&year=2003", admin, nil, http.StatusOK, "2 1 2 The Matrix Reloaded/2003/movie/tt0234215"},
+		{"type", "name=matrix&type=series", admin, nil, http.StatusOK, "1 1 1 Matrix/1993/series/tt0106062"},
+		{"no results", "name=Unknown", admin, nil, http.StatusOK, "0 1 0"},
+		{"too many results", "name=a", admin, nil, http.StatusBadRequest, types.CodeInvalidFilter},
+		{"without name", "year=1999", admin, nil, http.StatusBadRequest, types.CodeKeyRequired},
+		{"invalid year", "name=matrix&year=99", admin, nil, http.StatusBadRequest, types.CodeInvalidFilter},
+		{"invalid type", "name=matrix&type=episode", admin, nil, http.StatusBadRequest, types.CodeInvalidFilter},
+		{"invalid page", "name=matrix&page=101", admin, nil, http.StatusBadRequest, types.CodeInvalidPage},
+		{"invalid api key", "name=matrix", admin, NewFakeOMDbClient(omdb, "wrong-key"), http.StatusBadGateway, types.CodeUpstreamFailed},
+		{"user", "name=matrix", user, nil, http.StatusForbidden, types.CodeNotAllowed},
+	} {
+		handler := s
+		if tc.client != nil {
+			handler = service.NewWithMetadata(db, tc.client)
+		}
+		req, _ := http.NewRequest("GET", "/suggestions/search?"+tc.query, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token.TokenString)
+		rr := httptest.NewRecorder()
+		handler.Authorize(http.HandlerFunc(handler.SearchSuggestions)).ServeHTTP(rr, req)
+		if rr.Code != tc.statusCode {
+			t.Errorf("`%s` expected status %d, got %d %s", tc.name, tc.statusCode, rr.Code, rr.Body.String())
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			var problem types.Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if problem.Code != tc.expected {
+				t.Errorf("`%s` expected problem %s, got %s", tc.name, tc.expected, rr.Body.String())
 			}
+			continue
+		}
+		var candidates metadata.CandidateList
+		json.Unmarshal(rr.Body.Bytes(), &candidates)
+		got := fmt.Sprintf("%d %d %d", candidates.Total, candidates.Page, len(candidates.Items))
+		if len(candidates.Items) > 0 {
+			first := candidates.Items[0]
+			got += fmt.Sprintf(" %s/%s/%s/%s", first.Title, first.Year, first.Type, first.ImdbID)
+		}
+		if candidates.Next != "" {
+			got += " next"
+		}
+		if candidates.Prev != "" {
+			got += " prev"
+		}
+		if got != tc.expected || candidates.Items == nil {
+			t.Errorf("`%s` expected %s, got %s", tc.name, tc.expected, rr.Body.String())
+		}
+		if tc.name == "first page" && (candidates.Items[0].Poster == "" || candidates.Items[3].Poster != "" || !strings.Contains(candidates.Next, "page=2")) {
+			t.Errorf("expected posters without N/A and link to page 2, got %s", rr.Body.String())
+		}
+	}
+
+	cache := metadata.NewCache(NewFakeOMDbClient(omdb, FakeOMDbKey), nil, 10, time.Hour)
+	query := metadata.SearchQuery{Title: "Matrix", Type: "movie", Page: 1}
+	first, _ := cache.Search(context.Background(), query)
+	second, _ := cache.Search(context.Background(), query)
+	if stats := cache.Stats(); stats.Hits != 1 || first.Total != 11 || fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Errorf("expected cached search, got %+v %v", stats, second)
+	}
+	if purged, _ := cache.Purge("matrix", ""); purged != 1 {
+		t.Errorf("expected searches of title to be purged, got %d", purged)
+	}
+}
+
+func TestAccessTokenClaims(t *testing.T) {
+	db := initDB()
+	manager := data.New(db)
+	keys, err := data.LoadKeySet(config.JWTKeys, config.JWTSigningKeyID, config.SecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, _ := db.FindUserByEmail(CreateAdminUser().Email)
+	claims := func(typ, jti string) jwt.MapClaims {
+		result := jwt.MapClaims{"uid": admin.ID, "email": admin.Email, "role": admin.Role, "fam": "family", "exp": time.Now().Add(time.Hour).Unix()}
+		if typ != "" {
+			result["typ"] = typ
+		}
+		if jti != "" {
+			result["jti"] = jti
+		}
+		return result
+	}
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"access token", claims("access", "jti-1"), true},
+		{"without typ", claims("", "jti-2"), false},
+		{"without jti", claims("access", ""), false},
+		{"refresh token", claims("refresh", "jti-3"), false},
+	} {
+		token, err := keys.Sign(tc.claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = manager.VerifyToken(token); (err == nil) != tc.valid {
+			t.Errorf("`%s` expected valid %v, got %v", tc.name, tc.valid, err)
 		}
 	}
 }
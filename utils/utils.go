@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"os"
+	types "scaleflixapi/errors"
 	"scaleflixapi/logger"
 )
 
@@ -26,10 +27,23 @@ func CheckError(err error) bool {
 
 //WriteResponse writes response with given status and body
 func WriteResponse(resp http.ResponseWriter, statusCode int, value interface{}) {
-	resp.Header().Set("Content-Type", "application/json")
-	resp.Header().Set("Access-Control-Allow-Origin", "*")
-	resp.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, DELETE, POST")
-	resp.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	writeJSON(resp, statusCode, "application/json", value)
+}
+
+//WriteProblem writes RFC 7807 problem response
+func WriteProblem(resp http.ResponseWriter, problem types.Problem) {
+	writeJSON(resp, problem.Status, types.ProblemContentType, problem)
+}
+
+//WriteNotModified writes 304 response without body
+func WriteNotModified(resp http.ResponseWriter) {
+	setCors(resp)
+	resp.WriteHeader(http.StatusNotModified)
+}
+
+func writeJSON(resp http.ResponseWriter, statusCode int, contentType string, value interface{}) {
+	resp.Header().Set("Content-Type", contentType)
+	setCors(resp)
 	resp.WriteHeader(statusCode)
 	if err := json.NewEncoder(resp).Encode(value); err != nil {
 		logger.Error.Println(err)
@@ -37,3 +51,10 @@ func WriteResponse(resp http.ResponseWriter, statusCode int, value interface{})
 	}
 
 }
+
+func setCors(resp http.ResponseWriter) {
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+	resp.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, DELETE, POST, PUT, PATCH")
+	resp.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, X-Request-ID")
+	resp.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
+}